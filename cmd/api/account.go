@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/longlnOff/social/internal/export"
+	"github.com/longlnOff/social/internal/mailer"
+	"github.com/longlnOff/social/internal/media"
+	"github.com/longlnOff/social/internal/store"
+)
+
+// purgeBatchSize bounds the accounts purged by a single run of the job.
+const purgeBatchSize = 100
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required,max=50"`
+}
+
+type DeletionScheduledResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// deleteAccountHandler godoc
+//
+//	@Summary		Delete my account
+//	@Description	Schedules the deletion of the authenticated user's account once the grace period is over. Until then the deletion can be cancelled
+//	@Tags			users,account
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		DeleteAccountPayload		true	"Password confirmation"
+//	@Success		202		{object}	DeletionScheduledResponse	"Deletion scheduled"
+//	@Failure		400		{object}	Problem						"Invalid request payload"
+//	@Failure		401		{object}	Problem						"Wrong password"
+//	@Failure		409		{object}	Problem						"Deletion already scheduled"
+//	@Failure		500		{object}	Problem						"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [delete]
+func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DeleteAccountPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the cached user does not carry the password hash
+	ctx := r.Context()
+	user, err := app.store.User.GetByUserID(ctx, getUserFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := user.Password.Check(payload.Password); err != nil {
+		app.unauthorizedJWTStatelessErrorResponse(w, r, err)
+		return
+	}
+
+	at := time.Now().Add(app.configuration.Account.ACCOUNT_DELETION_GRACE)
+	if err := app.store.User.ScheduleDeletion(ctx, user.ID, at); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.invalidateUser(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, DeletionScheduledResponse{DeletionScheduledAt: at}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// cancelAccountDeletionHandler godoc
+//
+//	@Summary		Cancel the deletion of my account
+//	@Description	Cancels the scheduled deletion of the authenticated user's account
+//	@Tags			users,account
+//	@Accept			json
+//	@Produce		json
+//	@Success		204	{string}	string	"Deletion cancelled"
+//	@Failure		404	{object}	Problem	"No deletion scheduled"
+//	@Failure		500	{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/cancel-deletion [put]
+func (app *application) cancelAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := getUserFromCtx(r).ID
+	if err := app.store.User.CancelDeletion(ctx, userID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.invalidateUser(ctx, userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestDataExportHandler godoc
+//
+//	@Summary		Export my data
+//	@Description	Requests a copy of the authenticated user's data. The archive is built in the background and a time-limited download link is emailed once it is ready
+//	@Tags			users,account
+//	@Accept			json
+//	@Produce		json
+//	@Success		202	{object}	store.DataExport	"Export requested"
+//	@Failure		409	{object}	Problem				"An export is already on its way"
+//	@Failure		500	{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/export [post]
+func (app *application) requestDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	dataExport, err := app.store.Export.Create(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, dataExport); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// downloadDataExportHandler godoc
+//
+//	@Summary		Download a data export
+//	@Description	Downloads the ZIP archive of a data export with the token of the emailed link
+//	@Tags			users,account
+//	@Produce		application/zip
+//	@Param			token	path		string	true	"Download token"
+//	@Success		200		{file}		file	"ZIP archive"
+//	@Failure		404		{object}	Problem	"Export not found or expired"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Router			/users/export/{token} [get]
+func (app *application) downloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	dataExport, err := app.store.Export.GetByToken(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	file, err := app.exports.Open(ctx, dataExport.FileKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gophersocial-export-%d.zip"`, dataExport.ID))
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := io.Copy(w, file); err != nil {
+		app.loggerFor(r.Context()).Error("Error sending data export:", zap.String("error", err.Error()), zap.Int64("export", dataExport.ID))
+	}
+}
+
+// purgeAccounts deletes the accounts whose grace period is over.
+func (app *application) purgeAccounts(ctx context.Context) error {
+	policy := store.DeletionPolicy(app.configuration.Account.ACCOUNT_DELETION_POLICY)
+
+	userIDs, err := app.store.User.GetDueDeletions(ctx, purgeBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		files, err := app.store.User.Purge(ctx, userID, policy)
+		if err != nil {
+			// the deletion was cancelled in the meantime
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+
+		if key, ok := app.media.Key(files.AvatarURL); ok {
+			if err := app.media.Delete(ctx, key); err != nil {
+				app.loggerFor(ctx).Error("Error deleting avatar:", zap.String("error", err.Error()), zap.String("key", key))
+			}
+		}
+		for _, key := range files.ExportKeys {
+			if err := app.exports.Delete(ctx, key); err != nil {
+				app.loggerFor(ctx).Error("Error deleting data export:", zap.String("error", err.Error()), zap.String("key", key))
+			}
+		}
+		if err := app.invalidateUser(ctx, userID); err != nil {
+			app.loggerFor(ctx).Error("Error invalidating user:", zap.String("error", err.Error()), zap.Int64("user", userID))
+		}
+		event := store.AuditEvent{
+			Action:     "user.purged",
+			TargetType: "user",
+			TargetID:   userID,
+			Details:    map[string]any{"policy": string(policy)},
+		}
+		if err := app.store.Audit.Create(ctx, &event); err != nil {
+			app.loggerFor(ctx).Error("Error writing audit event:", zap.String("error", err.Error()), zap.String("action", event.Action), zap.Int64("target", userID))
+		}
+		app.loggerFor(ctx).Info("Account purged:", zap.Int64("user", userID), zap.String("policy", string(policy)))
+	}
+	return nil
+}
+
+// processDataExports removes the expired archives and builds the pending ones.
+func (app *application) processDataExports(ctx context.Context) error {
+	keys, err := app.store.Export.Expire(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := app.exports.Delete(ctx, key); err != nil {
+			app.loggerFor(ctx).Error("Error deleting data export:", zap.String("error", err.Error()), zap.String("key", key))
+		}
+	}
+
+	for {
+		dataExport, err := app.store.Export.Claim(ctx)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		if err := app.buildDataExport(ctx, dataExport); err != nil {
+			app.loggerFor(ctx).Error("Error building data export:", zap.String("error", err.Error()), zap.Int64("export", dataExport.ID))
+			if err := app.store.Export.Fail(ctx, dataExport.ID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// buildDataExport writes the archive of the export and emails its link.
+func (app *application) buildDataExport(ctx context.Context, dataExport *store.DataExport) error {
+	data, err := app.store.Export.GetData(ctx, dataExport.UserID)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = export.WriteZIP(&buf, []export.File{
+		{Name: "profile.json", Data: data.Profile},
+		{Name: "posts.json", Data: data.Posts},
+		{Name: "comments.json", Data: data.Comments},
+		{Name: "followers.json", Data: data.Followers},
+		{Name: "following.json", Data: data.Following},
+		{Name: "sessions.json", Data: data.Sessions},
+	})
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%d/%s.zip", dataExport.UserID, uuid.New().String())
+	if _, err := app.exports.Put(ctx, key, "application/zip", buf.Bytes()); err != nil {
+		return err
+	}
+
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	expiry := time.Now().Add(app.configuration.Account.EXPORT_LINK_EXP)
+	if err := app.store.Export.Complete(ctx, dataExport.ID, key, hex.EncodeToString(hash[:]), expiry); err != nil {
+		app.exports.Delete(ctx, key)
+		return err
+	}
+
+	isProduction := app.configuration.Server.ENVIRONMENT == "production"
+	vars := struct {
+		Username    string
+		DownloadURL string
+		Expiry      string
+	}{
+		Username:    data.Profile.Username,
+		DownloadURL: app.configuration.Server.FRONTEND_URL + "/download-export/" + plainToken,
+		Expiry:      expiry.UTC().Format(time.RFC1123),
+	}
+
+	status, err := app.mailer.Send(ctx, mailer.DataExportTemplate, data.Profile.Username, data.Profile.Email, vars, !isProduction)
+	if err != nil {
+		app.exports.Delete(ctx, key)
+		return err
+	}
+	app.loggerFor(ctx).Info("Email sent to:", zap.String("email", data.Profile.Email), zap.Int("status", status))
+	return nil
+}
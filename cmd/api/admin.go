@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/longlnOff/social/internal/mailer"
+	"github.com/longlnOff/social/internal/store"
+)
+
+// adminActivityLimit is the number of posts and comments shown in the recent
+// activity of a user.
+const adminActivityLimit = 50
+
+var (
+	errSelfAdministration = errors.New("administrators cannot change their own role or status")
+	errUserAlreadyActive  = errors.New("user is already active")
+)
+
+type TargetCTX string
+
+var Targetctx TargetCTX = "target"
+
+// AdminUserProfile is a user as seen by the administrators, along with the
+// suspension in effect.
+type AdminUserProfile struct {
+	UserProfile
+	Suspension *store.Suspension `json:"suspension"`
+}
+
+type UpdateRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
+// adminListUsersHandler godoc
+//
+//	@Summary		List users
+//	@Description	Searches the users by username or email, filtered by role and status
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			search	query		string	false	"Username or email contains"
+//	@Param			role	query		string	false	"Role"		Enums(user, moderator, admin)
+//	@Param			status	query		string	false	"Status"	Enums(active, inactive, pending_deletion, suspended)
+//	@Param			limit	query		int		false	"Limit"		default(20)
+//	@Param			offset	query		int		false	"Offset"	default(0)
+//	@Success		200		{array}		store.User
+//	@Failure		400		{object}	Problem	"Invalid query"
+//	@Failure		403		{object}	Problem	"Not an administrator"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users [get]
+func (app *application) adminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	p := store.PaginatedUsers{Limit: 20}
+	p, err := p.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(p); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, err := app.store.User.Search(r.Context(), p)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// adminGetUserHandler godoc
+//
+//	@Summary		Get a user
+//	@Description	Retrieves a user with its counters
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int			true	"User ID"
+//	@Success		200		{object}	AdminUserProfile	"User details"
+//	@Failure		403		{object}	Problem		"Not an administrator"
+//	@Failure		404		{object}	Problem		"User not found"
+//	@Failure		500		{object}	Problem		"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID} [get]
+func (app *application) adminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	target := getTargetFromCtx(r)
+	stats, err := app.store.User.GetStats(r.Context(), target.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	profile := AdminUserProfile{
+		UserProfile: UserProfile{User: target, UserStats: *stats},
+		Suspension:  target.Restriction(time.Now()),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// adminUpdateRoleHandler godoc
+//
+//	@Summary		Change the role of a user
+//	@Description	Gives another role to the user
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int					true	"User ID"
+//	@Param			request	body		UpdateRolePayload	true	"New role"
+//	@Success		204		{object}	nil					"No content"
+//	@Failure		400		{object}	Problem				"Invalid role"
+//	@Failure		403		{object}	Problem				"Not an administrator, or own account"
+//	@Failure		404		{object}	Problem				"User not found"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/role [put]
+func (app *application) adminUpdateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	target := getTargetFromCtx(r)
+	if target.ID == getUserFromCtx(r).ID {
+		app.forbiddenErrorResponse(w, r, errSelfAdministration)
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.store.User.SetRole(ctx, target.ID, payload.Role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.recordAudit(r, store.AuditEvent{
+		Action:     "user.role_changed",
+		TargetType: "user",
+		TargetID:   target.ID,
+		Before:     map[string]any{"role": target.Role.Name},
+		After:      map[string]any{"role": payload.Role},
+	})
+	if err := app.invalidateUser(ctx, target.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminDeactivateUserHandler godoc
+//
+//	@Summary		Deactivate a user
+//	@Description	Deactivates the user, who is logged out everywhere and cannot log in anymore
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		403		{object}	Problem	"Not an administrator, or own account"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/deactivate [put]
+func (app *application) adminDeactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, false)
+}
+
+// adminReactivateUserHandler godoc
+//
+//	@Summary		Reactivate a user
+//	@Description	Lets a deactivated user log in again
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		403		{object}	Problem	"Not an administrator, or own account"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/reactivate [put]
+func (app *application) adminReactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, true)
+}
+
+func (app *application) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	target := getTargetFromCtx(r)
+	if target.ID == getUserFromCtx(r).ID {
+		app.forbiddenErrorResponse(w, r, errSelfAdministration)
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.store.User.SetActive(ctx, target.ID, active); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	action := "user.deactivated"
+	if active {
+		action = "user.reactivated"
+	}
+	app.recordAudit(r, store.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   target.ID,
+		Before:     map[string]any{"is_active": target.IsActive},
+		After:      map[string]any{"is_active": active},
+	})
+	if err := app.invalidateUser(ctx, target.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminLogoutUserHandler godoc
+//
+//	@Summary		Log a user out
+//	@Description	Revokes every token issued to the user until now
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		403		{object}	Problem	"Not an administrator"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/logout [put]
+func (app *application) adminLogoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	target := getTargetFromCtx(r)
+	ctx := r.Context()
+	if err := app.store.User.RevokeTokens(ctx, target.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.recordAudit(r, store.AuditEvent{Action: "user.logged_out", TargetType: "user", TargetID: target.ID})
+	if err := app.invalidateUser(ctx, target.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminResendActivationHandler godoc
+//
+//	@Summary		Resend the activation email
+//	@Description	Sends a new activation link to a user who did not activate the account yet
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		403		{object}	Problem	"Not an administrator"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		409		{object}	Problem	"User already active"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/activation [post]
+func (app *application) adminResendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	target := getTargetFromCtx(r)
+
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashedToken := hex.EncodeToString(hash[:])
+
+	ctx := r.Context()
+	if err := app.store.User.CreateInvitation(ctx, hashedToken, target.ID, app.configuration.Mail.EXP); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, errUserAlreadyActive)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	isProduction := app.configuration.Server.ENVIRONMENT == "production"
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      target.Username,
+		ActivationURL: app.configuration.Server.FRONTEND_URL + "/confirm/" + plainToken,
+	}
+	status, err := app.mailer.Send(ctx, mailer.UserWelcomeTemplate, target.Username, target.Email, vars, !isProduction)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.loggerFor(r.Context()).Info("Email sent to:", zap.String("email", target.Email), zap.Int("status", status))
+
+	app.recordAudit(r, store.AuditEvent{Action: "user.activation_resent", TargetType: "user", TargetID: target.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminGetSessionsHandler godoc
+//
+//	@Summary		List the sessions of a user
+//	@Description	Lists the logins of the user, newest first
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Limit"									default(20)
+//	@Param			before	query		int	false	"ID of the last session of the previous page"
+//	@Success		200		{array}		store.Session
+//	@Failure		400		{object}	Problem	"Invalid query"
+//	@Failure		403		{object}	Problem	"Not an administrator"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/sessions [get]
+func (app *application) adminGetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	p := store.PaginatedKeyset{Limit: 20}
+	p, err := p.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(p); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	sessions, err := app.store.Session.GetByUserID(r.Context(), getTargetFromCtx(r).ID, p)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, sessions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// adminGetActivityHandler godoc
+//
+//	@Summary		Get the recent activity of a user
+//	@Description	Lists the latest posts and comments of the user
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{array}		store.UserActivity
+//	@Failure		403		{object}	Problem	"Not an administrator"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/activity [get]
+func (app *application) adminGetActivityHandler(w http.ResponseWriter, r *http.Request) {
+	activities, err := app.store.User.GetRecentActivity(r.Context(), getTargetFromCtx(r).ID, adminActivityLimit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, activities); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// requireRole lets through the users with at least the given role.
+func (app *application) requireRole(requiredRole string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.checkRolePrecedence(r.Context(), getUserFromCtx(r), requiredRole)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			if !allowed {
+				app.forbiddenErrorResponse(w, r, errPermissionDenied)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *application) targetUserContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idParam := chi.URLParam(r, "userID")
+		userID, err := strconv.ParseInt(idParam, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		target, err := app.store.User.GetByUserID(ctx, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, Targetctx, target)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getTargetFromCtx(r *http.Request) *store.User {
+	return r.Context().Value(Targetctx).(*store.User)
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -10,9 +16,15 @@ import (
 	"github.com/longlnOff/social/cmd/configuration"
 	"github.com/longlnOff/social/docs"
 	"github.com/longlnOff/social/internal/auth"
+	"github.com/longlnOff/social/internal/health"
 	"github.com/longlnOff/social/internal/mailer"
+	"github.com/longlnOff/social/internal/media"
+	"github.com/longlnOff/social/internal/moderation"
+	"github.com/longlnOff/social/internal/ratelimit"
 	"github.com/longlnOff/social/internal/store"
 	"github.com/longlnOff/social/internal/store/cache"
+	"github.com/longlnOff/social/internal/stream"
+	"github.com/longlnOff/social/internal/trending"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 	"go.uber.org/zap"
 )
@@ -22,38 +34,104 @@ type application struct {
 	store         store.Storage
 	cacheStore    cache.Storage
 	logger        *zap.Logger
+	// logLevel is the level of logger, changed by the administrators.
+	logLevel      zap.AtomicLevel
 	mailer        mailer.Client
 	authenticator auth.Authenticator
+	broker        stream.Broker
+	trending      trending.Store
+	media         media.Storage
+	exports       media.Storage
+	filters       *moderation.Pipeline
+	limiter       ratelimit.Limiter
+	rateLimits    map[string]ratelimit.Rule
+	// trustedProxies are the proxies whose forwarding headers are believed.
+	trustedProxies []netip.Prefix
+	// roleLevels caches the level of the roles by name.
+	roleLevels sync.Map
+	// jobs tracks the background jobs, to wait for them on shutdown.
+	jobs sync.WaitGroup
+	// shutdown is closed when the server stops, so the streams end.
+	shutdown chan struct{}
+	health   *health.Checker
+	// draining is set once the server is asked to stop, it is no longer
+	// ready.
+	draining atomic.Bool
+	metrics  *metrics
 }
 
+// defaultShutdownTimeout is used when no shutdown timeout is configured.
+const defaultShutdownTimeout = 30 * time.Second
+
 func (app *application) routes() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.Logger)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Timeout(time.Second * 60))
+	r.Use(app.realIP)
+	r.Use(app.trace)
+	r.Use(app.accessLog)
+	r.Use(middleware.Recoverer)
+	r.Use(app.metrics.instrument)
+
+	// Probes, open to the orchestrator
+	r.Get("/livez", app.livezHandler)
+	r.Get("/readyz", app.readyzHandler)
+	if app.metrics != nil && app.configuration.Metrics.METRICS_ADDRESS == "" {
+		r.Handle("/metrics", app.metrics.handler(app.configuration.Metrics.METRICS_TOKEN))
+	}
 
+	// Every version serves the same routes, the handlers shape their
+	// responses after the version of the request
 	r.Route("/v1", func(r chi.Router) {
+		r.Use(withAPIVersion(apiV1))
+		app.apiRoutes(r)
+	})
+	r.Route("/v2", func(r chi.Router) {
+		r.Use(withAPIVersion(apiV2))
+		app.apiRoutes(r)
+	})
+
+	return r
+}
+
+// apiRoutes mounts the routes of a version of the API on r.
+func (app *application) apiRoutes(r chi.Router) {
+	// limited before the authentication, a user key falls back to the IP
+	r.Use(app.rateLimit(rateLimitGlobal))
+
+	// Long-lived connections, they must not be cut by the timeout
+	r.Route("/stream", func(r chi.Router) {
+		r.Use(app.AuthTokenMiddleware)
+		r.Get("/", app.streamHandler)
+		r.Get("/ws", app.streamWebSocketHandler)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(time.Second * 60))
 
 		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthcheckHandler)
 
 		docsURL := fmt.Sprintf("%s/swagger/doc.json",
 			app.configuration.Server.SERVER_PORT)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL((docsURL))))
+		// Uploaded files, when stored by the API itself
+		if local, ok := app.media.(*media.LocalStorage); ok {
+			r.Get("/media/*", app.mediaHandler(local))
+		}
+
 		// Post API
 		r.Route("/posts", func(r chi.Router) {
+			r.Use(app.deprecatedIn(apiV1))
 			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+			r.With(app.requireWriteAccess, app.rateLimit(rateLimitWrite), app.idempotent).Post("/", app.createPostHandler)
 			r.Route("/{postID}", func(r chi.Router) {
 				r.Use(app.postContextMiddleware)
 
 				r.Get("/", app.getPostsHandler)
-				r.Patch("/", app.checkPostownership("moderator", app.updatePostHandler))
+				r.With(app.requireWriteAccess).Patch("/", app.checkPostownership("moderator", app.updatePostHandler))
 				r.Delete("/", app.checkPostownership("admin", app.deletePostHandler))
 
 				// Create comment for post
-				r.Post("/comments", app.createCommentHandler)
+				r.With(app.requireWriteAccess, app.rateLimit(rateLimitWrite), app.idempotent).Post("/comments", app.createCommentHandler)
 			})
 
 			r.Group(func(r chi.Router) {
@@ -64,6 +142,28 @@ func (app *application) routes() http.Handler {
 		// User API
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/email/verify/{token}", app.verifyEmailHandler)
+			r.Get("/export/{token}", app.downloadDataExportHandler)
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Get("/", app.getMeHandler)
+				r.With(app.requireWriteAccess).Patch("/", app.updateMeHandler)
+				r.With(app.requireWriteAccess).Put("/avatar", app.updateAvatarHandler)
+				r.Delete("/", app.deleteAccountHandler)
+				r.Put("/cancel-deletion", app.cancelAccountDeletionHandler)
+				r.Post("/export", app.requestDataExportHandler)
+			})
+			r.With(app.AuthTokenMiddleware).Get("/username/{username}", app.getUserByUsernameHandler)
+			r.With(app.AuthTokenMiddleware).Get("/blocked", app.getBlockedUsersHandler)
+			r.With(app.AuthTokenMiddleware).Get("/muted", app.getMutedUsersHandler)
+			r.With(app.AuthTokenMiddleware).Put("/privacy", app.updatePrivacyHandler)
+			r.With(app.AuthTokenMiddleware).Get("/suggestions", app.getSuggestionsHandler)
+			r.Route("/follow-requests", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Get("/", app.getFollowRequestsHandler)
+				r.Put("/{userID}/approve", app.approveFollowRequestHandler)
+				r.Put("/{userID}/reject", app.rejectFollowRequestHandler)
+			})
 
 			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
@@ -72,30 +172,216 @@ func (app *application) routes() http.Handler {
 				// Follow & Unfollow
 				r.Put("/follow", app.followUserHandler)
 				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Get("/followers", app.getFollowersHandler)
+				r.Get("/following", app.getFollowingHandler)
+				r.Get("/relationship", app.getRelationshipHandler)
+				// Block & Mute
+				r.Put("/block", app.blockUserHandler)
+				r.Put("/unblock", app.unblockUserHandler)
+				r.Put("/mute", app.muteUserHandler)
+				r.Put("/unmute", app.unmuteUserHandler)
+			})
+		})
+
+		// Notification API
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/", app.getNotificationsHandler)
+			r.Get("/grouped", app.getGroupedNotificationsHandler)
+			r.Put("/read", app.markAllNotificationsReadHandler)
+			r.Put("/{notificationID}/read", app.markNotificationReadHandler)
+			r.Get("/preferences", app.getNotificationPreferencesHandler)
+			r.Patch("/preferences", app.updateNotificationPreferencesHandler)
+		})
+
+		// Conversation API
+		r.Route("/conversations", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.With(app.requireWriteAccess, app.rateLimit(rateLimitWrite)).Post("/", app.createConversationHandler)
+			r.Get("/", app.getConversationsHandler)
+			r.Get("/unread", app.getUnreadMessagesCountHandler)
+			r.Get("/settings", app.getMessagingSettingsHandler)
+			r.Patch("/settings", app.updateMessagingSettingsHandler)
+
+			r.Route("/{conversationID}", func(r chi.Router) {
+				r.Use(app.conversationContextMiddleware)
+
+				r.Get("/", app.getConversationHandler)
+				r.Get("/messages", app.getMessagesHandler)
+				r.With(app.requireWriteAccess, app.rateLimit(rateLimitWrite)).Post("/messages", app.sendMessageHandler)
+				r.Put("/read", app.markConversationReadHandler)
+			})
+		})
+
+		// Trending API
+		r.Route("/trending", func(r chi.Router) {
+			r.Use(app.deprecatedIn(apiV1))
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/posts", app.getTrendingPostsHandler)
+			r.Get("/tags", app.getTrendingTagsHandler)
+		})
+
+		// Report API
+		r.Route("/reports", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.With(app.requireWriteAccess, app.rateLimit(rateLimitWrite)).Post("/", app.createReportHandler)
+		})
+
+		// Moderation API
+		r.Route("/moderation", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.requireRole("moderator"))
+			r.Route("/cases", func(r chi.Router) {
+				r.Get("/", app.getModerationCasesHandler)
+				r.Route("/{caseID}", func(r chi.Router) {
+					r.Use(app.caseContextMiddleware)
+					r.Get("/", app.getModerationCaseHandler)
+					r.Put("/assign", app.assignModerationCaseHandler)
+					r.Post("/resolve", app.resolveModerationCaseHandler)
+				})
+			})
+			r.Get("/decisions", app.getFilterDecisionsHandler)
+		})
+
+		// Admin API
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.requireRole("admin"))
+			r.Get("/audit", app.getAuditEventsHandler)
+			r.Get("/audit/verify", app.verifyAuditLogHandler)
+			r.Get("/log-level", app.getLogLevelHandler)
+			r.Put("/log-level", app.updateLogLevelHandler)
+			r.Route("/users", func(r chi.Router) {
+				r.Get("/", app.adminListUsersHandler)
+				r.Route("/{userID}", func(r chi.Router) {
+					r.Use(app.targetUserContextMiddleware)
+					r.Get("/", app.adminGetUserHandler)
+					r.Put("/role", app.adminUpdateRoleHandler)
+					r.Put("/deactivate", app.adminDeactivateUserHandler)
+					r.Put("/reactivate", app.adminReactivateUserHandler)
+					r.Put("/logout", app.adminLogoutUserHandler)
+					r.Post("/activation", app.adminResendActivationHandler)
+					r.Get("/sessions", app.adminGetSessionsHandler)
+					r.Get("/activity", app.adminGetActivityHandler)
+					r.Get("/suspensions", app.adminGetSuspensionsHandler)
+					r.Post("/suspensions", app.adminSuspendUserHandler)
+					r.Delete("/suspensions/{suspensionID}", app.adminLiftSuspensionHandler)
+				})
 			})
 		})
 
 		// Public routes
 		r.Route("/authentication", func(r chi.Router) {
-			r.Post("/user", app.registerUserHandler)
+			r.Use(app.rateLimit(rateLimitAuth))
+			r.With(app.idempotent).Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
 		})
 	})
-
-	return r
 }
 
-func (app *application) run(mux http.Handler) error {
+// run serves mux until ctx is done, then stops accepting connections and
+// waits for the requests in flight to finish, within the shutdown timeout.
+func (app *application) run(ctx context.Context, mux http.Handler) error {
 
 	// Setting docs swagger
 	docs.SwaggerInfo.Version = app.configuration.Server.VERSION
 	docs.SwaggerInfo.Host = app.configuration.Server.EXTERNAL_ADDRESS + ":" + app.configuration.Server.EXTERNAL_PORT
 	docs.SwaggerInfo.BasePath = "/v1"
 
-	server := http.Server{
-		Addr:    app.configuration.Server.SERVER_ADDRESS + ":" + app.configuration.Server.SERVER_PORT,
-		Handler: mux,
+	cfg := app.configuration.Server
+	server := &http.Server{
+		Addr:              cfg.SERVER_ADDRESS + ":" + cfg.SERVER_PORT,
+		Handler:           mux,
+		ReadTimeout:       cfg.SERVER_READ_TIMEOUT,
+		ReadHeaderTimeout: cfg.SERVER_READ_HEADER_TIMEOUT,
+		WriteTimeout:      cfg.SERVER_WRITE_TIMEOUT,
+		IdleTimeout:       cfg.SERVER_IDLE_TIMEOUT,
+		MaxHeaderBytes:    cfg.SERVER_MAX_HEADER_BYTES,
+		ErrorLog:          zap.NewStdLog(app.logger),
+	}
+
+	useTLS := cfg.SERVER_TLS_CERT_FILE != "" && cfg.SERVER_TLS_KEY_FILE != ""
+	if useTLS {
+		certs, err := newCertReloader(cfg.SERVER_TLS_CERT_FILE, cfg.SERVER_TLS_KEY_FILE, app.logger)
+		if err != nil {
+			return err
+		}
+		go certs.watchSignals(ctx)
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	// the streams never go idle, they are told to end
+	app.shutdown = make(chan struct{})
+	server.RegisterOnShutdown(func() {
+		close(app.shutdown)
+	})
+
+	// the metrics have their own listener, apart from the API
+	var metricsServer *http.Server
+	if app.metrics != nil && app.configuration.Metrics.METRICS_ADDRESS != "" {
+		metricsServer = &http.Server{
+			Addr:              app.configuration.Metrics.METRICS_ADDRESS,
+			Handler:           app.metrics.handler(app.configuration.Metrics.METRICS_TOKEN),
+			ReadHeaderTimeout: cfg.SERVER_READ_HEADER_TIMEOUT,
+			ErrorLog:          server.ErrorLog,
+		}
+		go func() {
+			app.logger.Info("Serving metrics on:", zap.String("address", metricsServer.Addr))
+			if err := metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				app.logger.Error("Metrics server failed:", zap.String("error", err.Error()))
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		app.logger.Info("Starting server on:", zap.String("port", cfg.SERVER_PORT), zap.Bool("tls", useTLS))
+		if useTLS {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// the load balancers get some time to stop sending requests
+	app.draining.Store(true)
+	if delay := app.configuration.Server.SERVER_SHUTDOWN_DELAY; delay > 0 {
+		app.logger.Info("Draining server.", zap.Duration("delay", delay))
+		time.Sleep(delay)
+	}
+
+	timeout := app.shutdownTimeout()
+	app.logger.Info("Shutting down server.", zap.Duration("timeout", timeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if metricsServer != nil {
+		defer metricsServer.Shutdown(shutdownCtx)
+	}
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// the requests still in flight are cut off
+		server.Close()
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (app *application) shutdownTimeout() time.Duration {
+	if app.configuration.Server.SERVER_SHUTDOWN_TIMEOUT <= 0 {
+		return defaultShutdownTimeout
 	}
-	app.logger.Info("Starting server on:", zap.String("port", app.configuration.Server.SERVER_PORT))
-	return server.ListenAndServe()
+	return app.configuration.Server.SERVER_SHUTDOWN_TIMEOUT
 }
@@ -4,7 +4,9 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -40,7 +42,7 @@ type CreateUserTokenPayload struct {
 //	@Produce		json
 //	@Param			payload	body		CreateUserTokenPayload	true	"User credentials"
 //	@Success		201		{object}	UserWithToken			"Created token"
-//	@Failure		500		{object}	string					"Internal Server Error"
+//	@Failure		500		{object}	Problem					"Internal Server Error"
 //	@Router			/authentication/token [post]
 func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
 	// 1. parse payload
@@ -60,7 +62,13 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
-			app.unauthorizedJWTStatelessErrorResponse(w, r, err)
+			app.recordAudit(r, store.AuditEvent{
+				Action:     "auth.login_failed",
+				TargetType: "user",
+				Details:    map[string]any{"email_hash": hashEmail(payload.Email)},
+			})
+			// the same answer as a wrong password, not to tell which emails are known
+			app.unauthorizedJWTStatelessErrorResponse(w, r, fmt.Errorf("%w: %w", errInvalidCredentials, err))
 		default:
 			app.internalServerError(w, r, err)
 		}
@@ -69,16 +77,28 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 
 	// 4. check if password is correct or not
 	if err := user.Password.Check(payload.Password); err != nil {
-		app.unauthorizedJWTStatelessErrorResponse(w, r, err)
+		app.recordAudit(r, store.AuditEvent{
+			Action:     "auth.login_failed",
+			TargetType: "user",
+			TargetID:   user.ID,
+			Details:    map[string]any{"email": payload.Email},
+		})
+		app.unauthorizedJWTStatelessErrorResponse(w, r, fmt.Errorf("%w: %w", errInvalidCredentials, err))
+		return
+	}
+	if suspension := user.Restriction(time.Now()); suspension != nil && suspension.Kind == store.SuspensionFull {
+		app.accountRestrictedResponse(w, r, suspension)
 		return
 	}
 
 	// 5. generate the token --> add claims
+	now := time.Now()
+	expiresAt := now.Add(app.configuration.Auth.Token.AUTH_TOKEN_EXP)
 	claims := jwt.MapClaims{
 		"sub": user.ID,
-		"exp": time.Now().Add(app.configuration.Auth.Token.AUTH_TOKEN_EXP).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
+		"exp": expiresAt.Unix(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
 		"iss": app.configuration.Auth.Token.AUTH_TOKEN_ISS,
 		"aud": app.configuration.Auth.Token.AUTH_TOKEN_ISS,
 	}
@@ -88,7 +108,26 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// 6. return to client
+	// 6. record the session
+	session := store.Session{
+		UserID:    user.ID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: expiresAt,
+	}
+	if err := app.store.Session.Create(r.Context(), &session); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.recordAudit(r, store.AuditEvent{
+		ActorID:    user.ID,
+		Action:     "auth.login",
+		TargetType: "user",
+		TargetID:   user.ID,
+		Details:    map[string]any{"session_id": session.ID},
+	})
+
+	// 7. return to client
 	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -103,10 +142,11 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 //	@Tags			authentication
 //	@Accept			json
 //	@Produce		json
-//	@Param			request	body		RegisterUserPayload	true	"User registration data"
-//	@Success		201		{object}	UserWithToken		"Registered user"
-//	@Failure		400		{object}	string				"Invalid request payload"
-//	@Failure		500		{object}	string				"Internal Server Error"
+//	@Param			request			body		RegisterUserPayload	true	"User registration data"
+//	@Param			Idempotency-Key	header		string				false	"Key making the request safe to retry"
+//	@Success		201		{object}	store.User			"Registered user, the activation link is sent by email"
+//	@Failure		400		{object}	Problem				"Invalid request payload"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
 //	@Router			/authentication/user [post]
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	var payload RegisterUserPayload
@@ -149,11 +189,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	userWithToken := UserWithToken{
-		User:  user,
-		Token: plainToken,
-	}
-
 	isProduction := app.configuration.Server.ENVIRONMENT == "production"
 	activationURL := app.configuration.Server.FRONTEND_URL + "/confirm/" + plainToken
 	vars := struct {
@@ -164,23 +199,32 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		ActivationURL: activationURL,
 	}
 	// send email
-	status, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProduction)
+	status, err := app.mailer.Send(r.Context(), mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProduction)
 	if err != nil {
-		app.logger.Error("Error sending email:", zap.String("error", err.Error()))
+		app.loggerFor(r.Context()).Error("Error sending email:", zap.String("error", err.Error()))
 
 		// rollback user creation if email fails (SAGA pattern) - delete user and user's invitation
 		if err := app.store.User.Delete(r.Context(), user.ID); err != nil {
-			app.logger.Error("Error rolling back user creation:", zap.String("error", err.Error()))
+			app.loggerFor(r.Context()).Error("Error rolling back user creation:", zap.String("error", err.Error()))
 			return
 		}
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	app.logger.Info("Email sent to:", zap.String("email", user.Email), zap.Int("status", status))
+	app.loggerFor(r.Context()).Info("Email sent to:", zap.String("email", user.Email), zap.Int("status", status))
 
-	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
+	// the activation token is only sent by email: the response is kept
+	// along with the Idempotency-Key, where the token must not be
+	if err := app.jsonResponse(w, http.StatusCreated, user); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
+
+// hashEmail returns the hex SHA-256 of the lowercased email, so the failed
+// logins for an unknown email are told apart without keeping the email.
+func hashEmail(email string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(hash[:])
+}
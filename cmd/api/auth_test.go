@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/longlnOff/social/internal/store"
+)
+
+// recordingAuditStore keeps the audit events written.
+type recordingAuditStore struct {
+	store.MockAuditStore
+	events []store.AuditEvent
+}
+
+func (s *recordingAuditStore) Create(ctx context.Context, event *store.AuditEvent) error {
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func TestLoginAudit(t *testing.T) {
+	app := newTestApplication(t)
+	audit := &recordingAuditStore{}
+	app.store.Audit = audit
+	mux := app.routes()
+
+	t.Run("should not record the email of unknown users", func(t *testing.T) {
+		body := strings.NewReader(`{"email": "ghost@example.com", "password": "password"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+		if len(audit.events) != 1 {
+			t.Fatalf("WANT 1 audit event BUT GOT %d", len(audit.events))
+		}
+		details := audit.events[0].Details
+		if _, ok := details["email"]; ok {
+			t.Errorf("WANT no email in the audit event BUT GOT %v", details)
+		}
+		if details["email_hash"] != hashEmail("ghost@example.com") {
+			t.Errorf("WANT the hash of the email BUT GOT %v", details)
+		}
+	})
+}
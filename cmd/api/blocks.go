@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/longlnOff/social/internal/store"
+)
+
+var errSelfRelationship = errors.New("cannot block or mute yourself")
+
+// blockUserHandler godoc
+//
+//	@Summary		Block a user
+//	@Description	Blocks the target user. Follow relationships between both users are removed
+//	@Tags			users,blocks
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID to block"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		400		{object}	Problem	"Invalid user ID"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	targetID, ok := app.parseTargetUserID(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Block.Block(r.Context(), user.ID, targetID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.invalidateSuggestions(r.Context(), user.ID)
+	app.invalidateSuggestions(r.Context(), targetID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unblockUserHandler godoc
+//
+//	@Summary		Unblock a user
+//	@Description	Removes the block of the target user
+//	@Tags			users,blocks
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID to unblock"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		400		{object}	Problem	"Invalid user ID"
+//	@Failure		404		{object}	Problem	"User not blocked"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/unblock [put]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	targetID, ok := app.parseTargetUserID(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Block.Unblock(r.Context(), user.ID, targetID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// muteUserHandler godoc
+//
+//	@Summary		Mute a user
+//	@Description	Hides the posts and notifications of the target user without telling them
+//	@Tags			users,blocks
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID to mute"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		400		{object}	Problem	"Invalid user ID"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	targetID, ok := app.parseTargetUserID(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Block.Mute(r.Context(), user.ID, targetID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unmuteUserHandler godoc
+//
+//	@Summary		Unmute a user
+//	@Description	Removes the mute of the target user
+//	@Tags			users,blocks
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID to unmute"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		400		{object}	Problem	"Invalid user ID"
+//	@Failure		404		{object}	Problem	"User not muted"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/unmute [put]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	targetID, ok := app.parseTargetUserID(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Block.Unmute(r.Context(), user.ID, targetID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getBlockedUsersHandler godoc
+//
+//	@Summary		Get blocked users
+//	@Description	Retrieves the users blocked by the authenticated user
+//	@Tags			users,blocks
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		store.User	"Blocked users"
+//	@Failure		500	{object}	Problem		"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/blocked [get]
+func (app *application) getBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	users, err := app.store.Block.GetBlocked(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getMutedUsersHandler godoc
+//
+//	@Summary		Get muted users
+//	@Description	Retrieves the users muted by the authenticated user
+//	@Tags			users,blocks
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		store.User	"Muted users"
+//	@Failure		500	{object}	Problem		"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/muted [get]
+func (app *application) getMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	users, err := app.store.Block.GetMuted(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// parseTargetUserID reads the target user of a block or a mute, which cannot
+// be the authenticated user.
+func (app *application) parseTargetUserID(w http.ResponseWriter, r *http.Request, userID int64) (int64, bool) {
+	targetID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return 0, false
+	}
+	if targetID == userID {
+		app.badRequestResponse(w, r, errSelfRelationship)
+		return 0, false
+	}
+	return targetID, true
+}
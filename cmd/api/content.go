@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/longlnOff/social/cmd/configuration"
+	"github.com/longlnOff/social/internal/content"
+	"github.com/longlnOff/social/internal/moderation"
+	"github.com/longlnOff/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// processContent extracts the mentions and hashtags of text and resolves the
+// mentions against existing users. Mentions of unknown users and of users
+// having a block with the author are dropped.
+func (app *application) processContent(ctx context.Context, authorID int64, text string) (content.Entities, error) {
+	entities := content.Parse(text)
+
+	ids, err := app.store.User.GetIDsByUsernames(ctx, entities.Usernames(), authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	return entities.Resolve(ids), nil
+}
+
+// newContentFilters builds the pipeline of content filters in the order of
+// the configuration.
+func newContentFilters(cfg configuration.ModerationConfiguration) (*moderation.Pipeline, error) {
+	onError, err := moderation.ParseVerdict(cfg.MODERATION_ON_ERROR)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make([]moderation.Filter, 0, len(cfg.MODERATION_FILTERS))
+	for _, name := range cfg.MODERATION_FILTERS {
+		switch name {
+		case "blocklist":
+			verdict, err := moderation.ParseVerdict(cfg.MODERATION_BLOCKLIST_VERDICT)
+			if err != nil {
+				return nil, err
+			}
+			patterns := []string{}
+			if cfg.MODERATION_BLOCKED_PATTERN != "" {
+				patterns = append(patterns, cfg.MODERATION_BLOCKED_PATTERN)
+			}
+			blocklist, err := moderation.NewBlocklist(cfg.MODERATION_BLOCKED_WORDS, patterns, verdict)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, blocklist)
+		case "links":
+			filters = append(filters, moderation.NewLinkFilter(cfg.MODERATION_BLOCKED_DOMAINS, cfg.MODERATION_SUSPICIOUS_DOMAINS))
+		case "burst":
+			filters = append(filters, moderation.NewBurstDetector(cfg.MODERATION_BURST_WINDOW, cfg.MODERATION_BURST_LIMIT))
+		case "classifier":
+			if cfg.MODERATION_CLASSIFIER_URL == "" {
+				return nil, fmt.Errorf("the classifier filter needs MODERATION_CLASSIFIER_URL")
+			}
+			filters = append(filters, moderation.NewClassifier(cfg.MODERATION_CLASSIFIER_URL, cfg.MODERATION_CLASSIFIER_TIMEOUT))
+		default:
+			return nil, fmt.Errorf("unknown content filter %q", name)
+		}
+	}
+
+	return moderation.NewPipeline(onError, filters...), nil
+}
+
+// screenContent runs the content filters, the failures of the filters are
+// logged and get the verdict configured for them.
+func (app *application) screenContent(ctx context.Context, c *moderation.Content) moderation.Result {
+	result := app.filters.Run(ctx, c)
+	for _, d := range result.Decisions {
+		if d.Err != nil {
+			app.loggerFor(ctx).Error("Content filter failed:", zap.String("filter", d.Filter), zap.String("error", d.Err.Error()))
+		}
+	}
+	return result
+}
+
+// recordContent tells the filters that the content was saved, so that only
+// the saved content counts towards duplicates and bursts.
+func (app *application) recordContent(c *moderation.Content) {
+	app.filters.Record(c)
+}
+
+// recordFilterDecisions saves the decisions of the filters about the
+// content, targetID is zero for rejected content that was never saved.
+// Failures are only logged.
+func (app *application) recordFilterDecisions(ctx context.Context, c *moderation.Content, targetID int64, result moderation.Result) {
+	if len(result.Decisions) == 0 {
+		return
+	}
+
+	var target *int64
+	if targetID != 0 {
+		target = &targetID
+	}
+	decisions := make([]store.FilterDecision, 0, len(result.Decisions))
+	for _, d := range result.Decisions {
+		decisions = append(decisions, store.FilterDecision{
+			TargetType: c.Kind,
+			TargetID:   target,
+			UserID:     c.UserID,
+			Filter:     d.Filter,
+			Verdict:    d.Verdict.String(),
+			Reason:     d.Reason,
+		})
+	}
+	if err := app.store.FilterDecision.Create(ctx, decisions); err != nil {
+		app.loggerFor(ctx).Error("Failed to record content filter decisions:", zap.String("kind", c.Kind), zap.Int64("user", c.UserID), zap.String("error", err.Error()))
+	}
+}
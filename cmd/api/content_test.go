@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/longlnOff/social/internal/moderation"
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestContentFilters(t *testing.T) {
+	app := newTestApplication(t)
+	blocklist, err := moderation.NewBlocklist([]string{"spam"}, nil, moderation.Reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.filters = moderation.NewPipeline(moderation.Hold, blocklist)
+	mux := app.routes()
+
+	t.Run("should reject a post with a blocked word", func(t *testing.T) {
+		body := strings.NewReader(`{"title": "hello", "content": "buy my spam", "tags": []}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should reject an edit bringing a blocked word", func(t *testing.T) {
+		ctx := context.Background()
+		post := &store.Post{UserID: 1, Title: "hello", Content: "nothing to see"}
+		if err := app.store.Post.Create(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+
+		body := strings.NewReader(`{"content": "buy my spam"}`)
+		req, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("/v1/posts/%d", post.ID), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+		saved, err := app.store.Post.GetByID(ctx, post.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Content != "nothing to see" {
+			t.Errorf("WANT the post unchanged BUT GOT %q", saved.Content)
+		}
+	})
+}
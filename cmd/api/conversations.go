@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/longlnOff/social/internal/store"
+	"github.com/longlnOff/social/internal/stream"
+)
+
+var errMissingParticipant = errors.New("a conversation needs another participant")
+
+type CreateConversationPayload struct {
+	UserIDs []int64 `json:"user_ids" validate:"required,min=1,max=9,dive,gt=0"`
+	Content string  `json:"content" validate:"required,min=1,max=2000"`
+}
+
+type SendMessagePayload struct {
+	Content string `json:"content" validate:"required,min=1,max=2000"`
+}
+
+type MarkConversationReadPayload struct {
+	MessageID int64 `json:"message_id" validate:"required,gt=0"`
+}
+
+type UpdateMessagingSettingsPayload struct {
+	FollowedOnly *bool `json:"followed_only"`
+}
+
+type UnreadCountResponse struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
+type ConversationCTX string
+
+var Conversationctx ConversationCTX = "conversation"
+
+// createConversationHandler godoc
+//
+//	@Summary		Start a conversation
+//	@Description	Starts a 1:1 or small group conversation with a first message. A 1:1 conversation that already exists is reused
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateConversationPayload	true	"Participants and first message"
+//	@Success		201		{object}	store.Conversation			"Conversation"
+//	@Failure		400		{object}	Problem						"Invalid request payload"
+//	@Failure		403		{object}	Problem						"A participant does not accept messages"
+//	@Failure		404		{object}	Problem						"Participant not found"
+//	@Failure		500		{object}	Problem						"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [post]
+func (app *application) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateConversationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	participantIDs := []int64{}
+	seen := map[int64]bool{user.ID: true}
+	for _, userID := range payload.UserIDs {
+		if !seen[userID] {
+			seen[userID] = true
+			participantIDs = append(participantIDs, userID)
+		}
+	}
+	if len(participantIDs) == 0 {
+		app.badRequestResponse(w, r, errMissingParticipant)
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.store.Conversation.CanMessage(ctx, user.ID, participantIDs); err != nil {
+		app.messagingErrorResponse(w, r, err)
+		return
+	}
+
+	message := &store.Message{SenderID: user.ID, Content: payload.Content}
+
+	// reuse the 1:1 conversation if there is one
+	if len(participantIDs) == 1 {
+		conversation, err := app.store.Conversation.FindDirect(ctx, user.ID, participantIDs[0])
+		switch {
+		case err == nil:
+			message.ConversationID = conversation.ID
+			if err := app.store.Conversation.CreateMessage(ctx, message); err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			conversation.LastMessage = message
+			app.publishMessage(ctx, conversation, message)
+
+			if err := app.jsonResponse(w, http.StatusCreated, conversation); err != nil {
+				app.internalServerError(w, r, err)
+			}
+			return
+		case !errors.Is(err, store.ErrNotFound):
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	conversation := &store.Conversation{CreatedBy: user.ID, IsGroup: len(participantIDs) > 1}
+	if err := app.store.Conversation.Create(ctx, conversation, participantIDs, message); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	conversation, err := app.store.Conversation.GetByID(ctx, conversation.ID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.publishMessage(ctx, conversation, message)
+
+	if err := app.jsonResponse(w, http.StatusCreated, conversation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getConversationsHandler godoc
+//
+//	@Summary		List conversations
+//	@Description	Lists the conversations of the authenticated user, most recently active first
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int					false	"Limit number of results"							default(20)
+//	@Param			before	query		int					false	"ID of the last message of the previous page"
+//	@Success		200		{array}		store.Conversation	"Conversations"
+//	@Failure		400		{object}	Problem				"Invalid pagination parameters"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [get]
+func (app *application) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := app.parseKeysetPagination(w, r)
+	if !ok {
+		return
+	}
+
+	user := getUserFromCtx(r)
+	conversations, err := app.store.Conversation.GetByUserID(r.Context(), user.ID, pagination)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, conversations); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getUnreadMessagesCountHandler godoc
+//
+//	@Summary		Count unread messages
+//	@Description	Counts the unread messages of the authenticated user over every conversation
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	UnreadCountResponse	"Unread messages count"
+//	@Failure		500	{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/unread [get]
+func (app *application) getUnreadMessagesCountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	count, err := app.store.Conversation.CountUnread(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, UnreadCountResponse{UnreadCount: count}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getConversationHandler godoc
+//
+//	@Summary		Get a conversation
+//	@Description	Retrieves a conversation with its participants and their read receipts
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int					true	"Conversation ID"
+//	@Success		200				{object}	store.Conversation	"Conversation"
+//	@Failure		404				{object}	Problem				"Conversation not found"
+//	@Failure		500				{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID} [get]
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, conversation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getMessagesHandler godoc
+//
+//	@Summary		List messages
+//	@Description	Lists the messages of a conversation, newest first
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int				true	"Conversation ID"
+//	@Param			limit			query		int				false	"Limit number of results"					default(20)
+//	@Param			before			query		int				false	"ID of the last message of the previous page"
+//	@Success		200				{array}		store.Message	"Messages"
+//	@Failure		400				{object}	Problem			"Invalid pagination parameters"
+//	@Failure		404				{object}	Problem			"Conversation not found"
+//	@Failure		500				{object}	Problem			"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [get]
+func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := app.parseKeysetPagination(w, r)
+	if !ok {
+		return
+	}
+
+	conversation := getConversationFromCtx(r)
+	messages, err := app.store.Conversation.GetMessages(r.Context(), conversation.ID, pagination)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, messages); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// sendMessageHandler godoc
+//
+//	@Summary		Send a message
+//	@Description	Sends a message to a conversation
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int					true	"Conversation ID"
+//	@Param			request			body		SendMessagePayload	true	"Message"
+//	@Success		201				{object}	store.Message		"Sent message"
+//	@Failure		400				{object}	Problem				"Invalid request payload"
+//	@Failure		404				{object}	Problem				"Conversation not found"
+//	@Failure		500				{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [post]
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	var payload SendMessagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	conversation := getConversationFromCtx(r)
+
+	message := &store.Message{ConversationID: conversation.ID, SenderID: user.ID, Content: payload.Content}
+	if err := app.store.Conversation.CreateMessage(r.Context(), message); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.publishMessage(r.Context(), conversation, message)
+
+	if err := app.jsonResponse(w, http.StatusCreated, message); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// markConversationReadHandler godoc
+//
+//	@Summary		Mark a conversation as read
+//	@Description	Moves the read receipt of the authenticated user up to a message
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int							true	"Conversation ID"
+//	@Param			request			body		MarkConversationReadPayload	true	"Last read message"
+//	@Success		204				{object}	nil							"No content"
+//	@Failure		400				{object}	Problem						"Invalid request payload"
+//	@Failure		404				{object}	Problem						"Message not found"
+//	@Failure		500				{object}	Problem						"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/read [put]
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MarkConversationReadPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	conversation := getConversationFromCtx(r)
+
+	if err := app.store.Conversation.MarkRead(r.Context(), conversation.ID, user.ID, payload.MessageID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getMessagingSettingsHandler godoc
+//
+//	@Summary		Get messaging settings
+//	@Description	Retrieves who can start a conversation with the authenticated user
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	store.MessagingSettings	"Messaging settings"
+//	@Failure		500	{object}	Problem					"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/settings [get]
+func (app *application) getMessagingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	settings, err := app.store.Conversation.GetSettings(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// updateMessagingSettingsHandler godoc
+//
+//	@Summary		Update messaging settings
+//	@Description	Restricts new conversations to the users the authenticated user follows
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		UpdateMessagingSettingsPayload	true	"Messaging settings"
+//	@Success		200		{object}	store.MessagingSettings			"Updated messaging settings"
+//	@Failure		400		{object}	Problem							"Invalid request payload"
+//	@Failure		500		{object}	Problem							"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/settings [patch]
+func (app *application) updateMessagingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateMessagingSettingsPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+	settings, err := app.store.Conversation.GetSettings(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.FollowedOnly != nil {
+		settings.FollowedOnly = *payload.FollowedOnly
+	}
+
+	if err := app.store.Conversation.UpdateSettings(ctx, user.ID, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) conversationContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversationID, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		// only the participants can see a conversation
+		user := getUserFromCtx(r)
+		ctx := r.Context()
+		conversation, err := app.store.Conversation.GetByID(ctx, conversationID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, Conversationctx, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getConversationFromCtx(r *http.Request) *store.Conversation {
+	return r.Context().Value(Conversationctx).(*store.Conversation)
+}
+
+func (app *application) messagingErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundResponse(w, r, err)
+	case errors.Is(err, store.ErrMessagingNotAllowed):
+		app.forbiddenErrorResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// publishMessage pushes a new message to the participants of its conversation.
+func (app *application) publishMessage(ctx context.Context, conversation *store.Conversation, message *store.Message) {
+	for _, participant := range conversation.Participants {
+		app.publish(ctx, stream.UserTopic(participant.UserID), stream.EventMessage, message)
+	}
+}
+
+func (app *application) parseKeysetPagination(w http.ResponseWriter, r *http.Request) (store.PaginatedKeyset, bool) {
+	pagination := store.PaginatedKeyset{
+		Limit:  20,
+		Before: 0,
+	}
+
+	pagination, err := pagination.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return pagination, false
+	}
+
+	if err := Validate.Struct(pagination); err != nil {
+		app.badRequestResponse(w, r, err)
+		return pagination, false
+	}
+
+	return pagination, true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestConversations(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+
+	newRequest := func(t *testing.T, method, url string, body io.Reader) *http.Request {
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+		return req
+	}
+
+	t.Run("should start a conversation with a first message", func(t *testing.T) {
+		body := strings.NewReader(`{"user_ids": [2], "content": "hello"}`)
+		rr := executeRequest(newRequest(t, http.MethodPost, "/v1/conversations", body), mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		body = strings.NewReader(`{"content": "again"}`)
+		rr = executeRequest(newRequest(t, http.MethodPost, "/v1/conversations/1/messages", body), mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("should not message users who blocked the sender", func(t *testing.T) {
+		if err := app.store.Block.Block(context.Background(), 3, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		body := strings.NewReader(`{"user_ids": [3], "content": "hello"}`)
+		rr := executeRequest(newRequest(t, http.MethodPost, "/v1/conversations", body), mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should not show the conversations of other users", func(t *testing.T) {
+		conversation := &store.Conversation{CreatedBy: 4}
+		message := &store.Message{SenderID: 4, Content: "hello"}
+		if err := app.store.Conversation.Create(context.Background(), conversation, []int64{5}, message); err != nil {
+			t.Fatal(err)
+		}
+
+		url := fmt.Sprintf("/v1/conversations/%d/messages", conversation.ID)
+		rr := executeRequest(newRequest(t, http.MethodGet, url, nil), mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+}
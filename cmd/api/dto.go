@@ -0,0 +1,250 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/longlnOff/social/internal/content"
+	"github.com/longlnOff/social/internal/store"
+)
+
+// The responses are built from the store models rather than being them, so
+// the models can change without the clients noticing. A version keeps its
+// responses as they are once released, v1 still has the shape of the models
+// it was first written with.
+
+// AuthorResponse is the public part of the author of a post or a comment.
+type AuthorResponse struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+// PostResponse is a post as v2 shows it. CommentsCount is only given in the
+// feed, Comments only with the post alone.
+type PostResponse struct {
+	ID            int64             `json:"id"`
+	Title         string            `json:"title"`
+	Content       string            `json:"content"`
+	Tags          []string          `json:"tags"`
+	Locale        string            `json:"locale"`
+	Entities      content.Entities  `json:"entities"`
+	Version       int64             `json:"version"`
+	CreatedAt     string            `json:"created_at"`
+	UpdatedAt     string            `json:"updated_at"`
+	Author        AuthorResponse    `json:"author"`
+	CommentsCount *int64            `json:"comments_count,omitempty"`
+	Comments      []CommentResponse `json:"comments,omitempty"`
+}
+
+// CommentResponse is a comment as v2 shows it.
+type CommentResponse struct {
+	ID        int64            `json:"id"`
+	PostID    int64            `json:"post_id"`
+	Content   string           `json:"content"`
+	Entities  content.Entities `json:"entities"`
+	CreatedAt string           `json:"created_at"`
+	Author    AuthorResponse   `json:"author"`
+}
+
+type TrendingPostResponse struct {
+	Post  PostResponse `json:"post"`
+	Score float64      `json:"score"`
+}
+
+func newAuthorResponse(user store.User) AuthorResponse {
+	return AuthorResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+	}
+}
+
+func newPostResponse(post store.Post) PostResponse {
+	author := post.User
+	author.ID = post.UserID
+	res := PostResponse{
+		ID:        post.ID,
+		Title:     post.Title,
+		Content:   post.Content,
+		Tags:      post.Tags,
+		Locale:    post.Locale,
+		Entities:  post.Entities,
+		Version:   post.Version,
+		CreatedAt: post.CreatedAt,
+		UpdatedAt: post.UpdatedAt,
+		Author:    newAuthorResponse(author),
+	}
+	for _, comment := range post.Comments {
+		res.Comments = append(res.Comments, newCommentResponse(comment))
+	}
+	return res
+}
+
+func newCommentResponse(comment store.Comment) CommentResponse {
+	author := comment.User
+	author.ID = comment.UserID
+	return CommentResponse{
+		ID:        comment.ID,
+		PostID:    comment.PostID,
+		Content:   comment.Content,
+		Entities:  comment.Entities,
+		CreatedAt: comment.CreatedAt,
+		Author:    newAuthorResponse(author),
+	}
+}
+
+// RoleV1Response is the role of a user as v1 shows it.
+type RoleV1Response struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Level       int64  `json:"level"`
+	Description string `json:"description"`
+}
+
+// UserV1Response is the author of a post or a comment as v1 shows it, with
+// every field of the user even though only the ID and the username are set.
+type UserV1Response struct {
+	ID                  int64          `json:"id"`
+	Username            string         `json:"username"`
+	Email               string         `json:"email"`
+	CreatedAt           string         `json:"created_at"`
+	IsActive            bool           `json:"is_active"`
+	IsPrivate           bool           `json:"is_private"`
+	RoleID              int64          `json:"role_id"`
+	Role                RoleV1Response `json:"role"`
+	DisplayName         string         `json:"display_name"`
+	Bio                 string         `json:"bio"`
+	Website             string         `json:"website"`
+	Location            string         `json:"location"`
+	AvatarURL           string         `json:"avatar_url"`
+	DeletionScheduledAt *time.Time     `json:"deletion_scheduled_at,omitempty"`
+}
+
+// PostV1Response is a post as v1 shows it.
+type PostV1Response struct {
+	ID        int64               `json:"id"`
+	Content   string              `json:"content"`
+	Title     string              `json:"title"`
+	UserID    int64               `json:"user_id"`
+	Tags      []string            `json:"tags"`
+	Locale    string              `json:"locale"`
+	Entities  content.Entities    `json:"entities"`
+	Version   int64               `json:"version"`
+	CreatedAt string              `json:"created_at"`
+	UpdatedAt string              `json:"updated_at"`
+	Comments  []CommentV1Response `json:"comments"`
+	User      UserV1Response      `json:"user"`
+}
+
+// FeedPostV1Response is a post of the feed as v1 shows it.
+type FeedPostV1Response struct {
+	PostV1Response
+	CommentsCount int64 `json:"comments_count"`
+}
+
+// CommentV1Response is a comment of a post as v1 shows it.
+type CommentV1Response struct {
+	ID        int64            `json:"id"`
+	PostID    int64            `json:"post_id"`
+	UserID    int64            `json:"user_id"`
+	Content   string           `json:"content"`
+	Entities  content.Entities `json:"entities"`
+	CreatedAt string           `json:"created_at"`
+	User      UserV1Response   `json:"user"`
+}
+
+func newUserV1Response(user store.User) UserV1Response {
+	return UserV1Response{
+		ID:                  user.ID,
+		Username:            user.Username,
+		Email:               user.Email,
+		CreatedAt:           user.CreatedAt,
+		IsActive:            user.IsActive,
+		IsPrivate:           user.IsPrivate,
+		RoleID:              user.RoleID,
+		Role:                RoleV1Response(user.Role),
+		DisplayName:         user.DisplayName,
+		Bio:                 user.Bio,
+		Website:             user.Website,
+		Location:            user.Location,
+		AvatarURL:           user.AvatarURL,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+}
+
+func newPostV1Response(post store.Post) PostV1Response {
+	var comments []CommentV1Response
+	if post.Comments != nil {
+		comments = make([]CommentV1Response, 0, len(post.Comments))
+	}
+	for _, comment := range post.Comments {
+		comments = append(comments, CommentV1Response{
+			ID:        comment.ID,
+			PostID:    comment.PostID,
+			UserID:    comment.UserID,
+			Content:   comment.Content,
+			Entities:  comment.Entities,
+			CreatedAt: comment.CreatedAt,
+			User:      newUserV1Response(comment.User),
+		})
+	}
+	return PostV1Response{
+		ID:        post.ID,
+		Content:   post.Content,
+		Title:     post.Title,
+		UserID:    post.UserID,
+		Tags:      post.Tags,
+		Locale:    post.Locale,
+		Entities:  post.Entities,
+		Version:   post.Version,
+		CreatedAt: post.CreatedAt,
+		UpdatedAt: post.UpdatedAt,
+		Comments:  comments,
+		User:      newUserV1Response(post.User),
+	}
+}
+
+// presentPost shapes a post after the version of the request.
+func presentPost(r *http.Request, post store.Post) any {
+	if getAPIVersion(r) == apiV1 {
+		return newPostV1Response(post)
+	}
+	return newPostResponse(post)
+}
+
+// presentFeed shapes the posts of a feed after the version of the request.
+func presentFeed(r *http.Request, feed []store.PostWithMetadata) any {
+	if getAPIVersion(r) == apiV1 {
+		posts := make([]FeedPostV1Response, 0, len(feed))
+		for _, post := range feed {
+			posts = append(posts, FeedPostV1Response{PostV1Response: newPostV1Response(post.Post), CommentsCount: post.CommentsCount})
+		}
+		return posts
+	}
+
+	posts := make([]PostResponse, 0, len(feed))
+	for _, post := range feed {
+		res := newPostResponse(post.Post)
+		res.CommentsCount = &post.CommentsCount
+		posts = append(posts, res)
+	}
+	return posts
+}
+
+// presentComment shapes a new comment after the version of the request.
+func presentComment(r *http.Request, comment store.Comment) any {
+	if getAPIVersion(r) == apiV1 {
+		return CreateCommentForPostResponse{
+			ID:        comment.ID,
+			PostID:    comment.PostID,
+			UserID:    comment.UserID,
+			Content:   comment.Content,
+			Entities:  comment.Entities,
+			CreatedAt: comment.CreatedAt,
+		}
+	}
+	return newCommentResponse(comment)
+}
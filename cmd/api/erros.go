@@ -1,42 +1,95 @@
 package main
 
 import (
-	"go.uber.org/zap"
 	"net/http"
+
+	"github.com/longlnOff/social/internal/store"
+	"go.uber.org/zap"
 )
 
 func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Error("Conflict:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
-	writeJSONError(w, http.StatusConflict, err.Error())
+	app.loggerFor(r.Context()).Error("Conflict:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusConflict, err)
 }
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Error("Internal server error:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
-	writeJSONError(w, http.StatusInternalServerError, "Internal server error")
+	app.loggerFor(r.Context()).Error("Internal server error:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusInternalServerError, err)
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Error("Bad request:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
-	writeJSONError(w, http.StatusBadRequest, err.Error())
+	app.loggerFor(r.Context()).Error("Bad request:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusBadRequest, err)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Error("Resource not found:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
-	writeJSONError(w, http.StatusNotFound, "Resource not found")
+	app.loggerFor(r.Context()).Error("Resource not found:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusNotFound, err)
 }
 
 func (app *application) unauthorizedBasicAuthErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Error("Unauthorized:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.loggerFor(r.Context()).Error("Unauthorized:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
 	w.Header().Set("WWW-Authenticate", `Basic realm="Restricted" charset="UTF-8"`) // If set this, the browser will show the login form
-	writeJSONError(w, http.StatusUnauthorized, err.Error())
+	app.problemResponse(w, r, http.StatusUnauthorized, err)
 }
 
 func (app *application) unauthorizedJWTStatelessErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Error("Unauthorized:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
-	writeJSONError(w, http.StatusUnauthorized, err.Error())
+	app.loggerFor(r.Context()).Error("Unauthorized:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusUnauthorized, err)
 }
 
 func (app *application) forbiddenErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Warn("Forbidden:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
-	writeJSONError(w, http.StatusForbidden, "forbidden")
+	app.loggerFor(r.Context()).Warn("Forbidden:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusForbidden, err)
+}
+
+func (app *application) tooManyRequestsResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.loggerFor(r.Context()).Warn("Too many requests:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusTooManyRequests, err)
+}
+
+func (app *application) unprocessableEntityResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.loggerFor(r.Context()).Warn("Unprocessable entity:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusUnprocessableEntity, err)
+}
+
+// accountRestrictedResponse tells a suspended or read-only user why the
+// request is refused and until when.
+func (app *application) accountRestrictedResponse(w http.ResponseWriter, r *http.Request, suspension *store.Suspension) {
+	app.loggerFor(r.Context()).Warn("Account restricted:", zap.Int64("user", suspension.UserID), zap.String("kind", suspension.Kind), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+
+	problem := app.newProblem(r, http.StatusForbidden, nil)
+	problem.Code = "account_suspended"
+	problem.Detail = "account suspended"
+	if suspension.Kind == store.SuspensionReadOnly {
+		problem.Code = "account_read_only"
+		problem.Detail = "account restricted to read-only"
+	}
+	problem.Type = problemTypePrefix + problem.Code
+	problem.Extensions = map[string]any{
+		"kind":      suspension.Kind,
+		"reason":    suspension.Reason,
+		"starts_at": suspension.StartsAt,
+		"ends_at":   suspension.EndsAt,
+	}
+	writeProblem(w, problem)
+}
+
+// contentRejectedResponse tells the user that the content filters refused
+// what they wrote.
+func (app *application) contentRejectedResponse(w http.ResponseWriter, r *http.Request, reason string) {
+	app.loggerFor(r.Context()).Warn("Content rejected:", zap.String("reason", reason), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+
+	problem := app.newProblem(r, http.StatusUnprocessableEntity, nil)
+	problem.Code = "content_rejected"
+	problem.Type = problemTypePrefix + problem.Code
+	problem.Detail = "content rejected"
+	problem.Extensions = map[string]any{"reason": reason}
+	writeProblem(w, problem)
+}
+
+// payloadTooLargeResponse tells the client that what it sent is too large.
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.loggerFor(r.Context()).Warn("Payload too large:", zap.String("error", err.Error()), zap.String("path", r.URL.Path), zap.String("method", r.Method))
+	app.problemResponse(w, r, http.StatusRequestEntityTooLarge, err)
 }
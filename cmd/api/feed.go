@@ -16,9 +16,9 @@ import (
 //	@Param			limit	query		int			false	"Limit number of results"	default(20)
 //	@Param			offset	query		int			false	"Offset for pagination"		default(0)
 //	@Param			sort	query		string		false	"Sort order (asc or desc)"	default(desc)
-//	@Success		200		{array}		store.Post	"Feed posts"
-//	@Failure		400		{object}	string		"Invalid pagination parameters"
-//	@Failure		500		{object}	string		"Internal Server Error"
+//	@Success		200		{array}		FeedPostV1Response		"Feed posts"
+//	@Failure		400		{object}	Problem				"Invalid pagination parameters"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/posts/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
@@ -40,13 +40,13 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	ctx := r.Context()
-	feeds, err := app.store.Post.GetUserFeed(ctx, int64(20), pagination)
+	feeds, err := app.store.Post.GetUserFeed(ctx, getUserFromCtx(r).ID, pagination)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feeds); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, presentFeed(r, feeds)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
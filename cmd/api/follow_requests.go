@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/longlnOff/social/internal/store"
+)
+
+// getFollowRequestsHandler godoc
+//
+//	@Summary		Get follow requests
+//	@Description	Retrieves the pending follow requests received by the authenticated user, most recent first
+//	@Tags			users,follows
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int						false	"Limit number of results"			default(20)
+//	@Param			before	query		int						false	"ID of the last request of the previous page"
+//	@Success		200		{array}		store.FollowRequest		"Follow requests"
+//	@Failure		400		{object}	Problem					"Invalid pagination parameters"
+//	@Failure		500		{object}	Problem					"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/follow-requests [get]
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := app.parseKeysetPagination(w, r)
+	if !ok {
+		return
+	}
+
+	requests, err := app.store.Follower.GetRequests(r.Context(), getUserFromCtx(r).ID, pagination)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, requests); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// approveFollowRequestHandler godoc
+//
+//	@Summary		Approve a follow request
+//	@Description	Accepts the pending follow request of a user
+//	@Tags			users,follows
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"Requester user ID"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		400		{object}	Problem	"Invalid user ID"
+//	@Failure		404		{object}	Problem	"Follow request not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/follow-requests/{userID}/approve [put]
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	if err := app.store.Follower.ApproveRequest(r.Context(), user.ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.publishNotification(r.Context(), store.Notification{
+		ActorID: user.ID,
+		Type:    store.NotificationFollowAccepted,
+		Actor:   store.User{ID: user.ID, Username: user.Username},
+	}, []int64{requesterID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rejectFollowRequestHandler godoc
+//
+//	@Summary		Reject a follow request
+//	@Description	Declines the pending follow request of a user
+//	@Tags			users,follows
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"Requester user ID"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		400		{object}	Problem	"Invalid user ID"
+//	@Failure		404		{object}	Problem	"Follow request not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/follow-requests/{userID}/reject [put]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Follower.RejectRequest(r.Context(), getUserFromCtx(r).ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
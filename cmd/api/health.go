@@ -2,6 +2,9 @@ package main
 
 import (
 	"net/http"
+
+	"github.com/longlnOff/social/internal/health"
+	"go.uber.org/zap"
 )
 
 type HealthResponse struct {
@@ -17,7 +20,7 @@ type HealthResponse struct {
 // @Tags			healthcheck
 // @Produce		json
 // @Success		200	{object}	HealthResponse
-// @Failure		500	{object}	error
+// @Failure		500	{object}	Problem
 // @Router			/health [get]
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	data := HealthResponse{
@@ -29,3 +32,54 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.internalServerError(w, r, err)
 	}
 }
+
+type ProbeResponse struct {
+	Status string `json:"status"`
+}
+
+// livezHandler godoc
+//
+//	@Summary		Liveness probe
+//	@Description	Tells that the process is up, without checking its dependencies
+//	@Tags			healthcheck
+//	@Produce		json
+//	@Success		200	{object}	ProbeResponse
+//	@Router			/livez [get]
+func (app *application) livezHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, ProbeResponse{Status: health.StatusUp}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// readyzHandler godoc
+//
+//	@Summary		Readiness probe
+//	@Description	Checks the dependencies of the API and reports the status and latency of each of them
+//	@Tags			healthcheck
+//	@Produce		json
+//	@Success		200	{object}	health.Report	"Ready"
+//	@Failure		503	{object}	health.Report	"Not ready, or shutting down"
+//	@Router			/readyz [get]
+func (app *application) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if app.draining.Load() {
+		if err := app.jsonResponse(w, http.StatusServiceUnavailable, ProbeResponse{Status: "shutting_down"}); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	report := app.health.Run(r.Context())
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+		for name, check := range report.Checks {
+			if check.Err != nil {
+				app.loggerFor(r.Context()).Warn("Readiness check failed:", zap.String("check", name), zap.String("error", check.Err.Error()))
+			}
+		}
+	}
+
+	if err := app.jsonResponse(w, status, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/longlnOff/social/internal/health"
+)
+
+func TestProbes(t *testing.T) {
+	app := newTestApplication(t)
+	checks := health.NewChecker(time.Second, 0)
+	checks.Register("postgres", func(ctx context.Context) error {
+		return errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	})
+	app.health = checks
+	mux := app.routes()
+
+	probe := func(path string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := executeRequest(req, mux)
+		return rr.Code, rr.Body.String()
+	}
+
+	t.Run("should be alive without checking the dependencies", func(t *testing.T) {
+		code, _ := probe("/livez")
+		checkResponseCode(t, http.StatusOK, code)
+	})
+
+	t.Run("should not be ready with a dependency down", func(t *testing.T) {
+		code, body := probe("/readyz")
+		checkResponseCode(t, http.StatusServiceUnavailable, code)
+		if strings.Contains(body, "10.0.0.5") {
+			t.Errorf("WANT no error details BUT GOT %s", body)
+		}
+	})
+
+	t.Run("should not be ready while shutting down", func(t *testing.T) {
+		app.health = nil
+		app.draining.Store(true)
+		code, _ := probe("/readyz")
+		checkResponseCode(t, http.StatusServiceUnavailable, code)
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/longlnOff/social/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyDefaultTTL is used when no TTL is configured.
+	idempotencyDefaultTTL = 24 * time.Hour
+)
+
+var (
+	errIdempotencyKeyTooLong = errors.New("idempotency key longer than 255 characters")
+	errIdempotencyInFlight   = errors.New("a request with this idempotency key is in progress")
+	errIdempotencyMismatch   = errors.New("idempotency key already used with another request")
+)
+
+// idempotent makes the requests sent with an Idempotency-Key safe to retry:
+// the response to the first request is saved and replayed to the retries.
+// A retry arriving while the first request is in flight gets a 409, and the
+// key sent along with another request a 422. Failed requests, answered with
+// a 5xx, can be retried for real.
+func (app *application) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errIdempotencyKeyTooLong)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ttl := app.configuration.Idempotency.IDEMPOTENCY_TTL
+		if ttl <= 0 {
+			ttl = idempotencyDefaultTTL
+		}
+		record := &store.IdempotencyRecord{
+			Scope:       idempotencyScope(r),
+			Key:         key,
+			Fingerprint: requestFingerprint(r, body),
+		}
+		existing, err := app.store.Idempotency.Claim(r.Context(), record, ttl)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		switch {
+		case existing == nil:
+		case existing.Fingerprint != record.Fingerprint:
+			app.unprocessableEntityResponse(w, r, errIdempotencyMismatch)
+			return
+		case existing.InFlight():
+			w.Header().Set("Retry-After", "1")
+			app.conflictResponse(w, r, errIdempotencyInFlight)
+			return
+		default:
+			replayResponse(w, existing)
+			return
+		}
+
+		// the response is saved even when the client is gone
+		ctx := context.WithoutCancel(r.Context())
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := app.store.Idempotency.Release(ctx, record.Scope, record.Key); err != nil {
+				app.loggerFor(r.Context()).Error("Failed to release idempotency key:", zap.String("key", key), zap.String("error", err.Error()))
+			}
+		}()
+
+		var captured bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&captured)
+		next.ServeHTTP(ww, r)
+
+		record.Status = ww.Status()
+		if record.Status == 0 {
+			record.Status = http.StatusOK
+		}
+		if record.Status >= http.StatusInternalServerError {
+			return
+		}
+		record.Headers = replayableHeaders(ww.Header())
+		record.Body = captured.Bytes()
+		if err := app.store.Idempotency.Complete(ctx, record); err != nil {
+			app.loggerFor(r.Context()).Error("Failed to save idempotent response:", zap.String("key", key), zap.String("error", err.Error()))
+			return
+		}
+		completed = true
+	})
+}
+
+// idempotencyScope keeps the keys of every user apart, the requests without
+// a user share a scope.
+func idempotencyScope(r *http.Request) string {
+	if user, ok := r.Context().Value(Userctx).(*store.User); ok {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+	return "anonymous"
+}
+
+// requestFingerprint identifies the request the key came with.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayableHeaders leaves out the headers about the rate limits, they are
+// set again for every request.
+func replayableHeaders(header http.Header) http.Header {
+	replayable := http.Header{}
+	for name, values := range header {
+		if strings.HasPrefix(name, "Ratelimit-") || name == "Retry-After" {
+			continue
+		}
+		replayable[name] = values
+	}
+	return replayable
+}
+
+func replayResponse(w http.ResponseWriter, record *store.IdempotencyRecord) {
+	for name, values := range record.Headers {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+}
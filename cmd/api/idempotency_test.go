@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestIdempotency(t *testing.T) {
+	app := newTestApplication(t)
+
+	calls := 0
+	handler := app.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		app.jsonResponse(w, http.StatusCreated, map[string]int{"calls": calls})
+	}))
+
+	newRequest := func(key string, body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(idempotencyKeyHeader, key)
+		return req
+	}
+
+	t.Run("should replay the response to a retry", func(t *testing.T) {
+		first := executeRequest(newRequest("a", `{"n": 1}`), handler)
+		checkResponseCode(t, http.StatusCreated, first.Code)
+
+		retry := executeRequest(newRequest("a", `{"n": 1}`), handler)
+		checkResponseCode(t, http.StatusCreated, retry.Code)
+		if calls != 1 || retry.Body.String() != first.Body.String() {
+			t.Errorf("WANT the first response replayed BUT GOT %d calls and %s", calls, retry.Body.String())
+		}
+		if retry.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("WANT the replay flagged")
+		}
+	})
+
+	t.Run("should refuse the key with another payload", func(t *testing.T) {
+		rr := executeRequest(newRequest("a", `{"n": 2}`), handler)
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should refuse a retry while the request is in flight", func(t *testing.T) {
+		req := newRequest("b", `{}`)
+		record := &store.IdempotencyRecord{Scope: "anonymous", Key: "b", Fingerprint: requestFingerprint(req, []byte(`{}`))}
+		if _, err := app.store.Idempotency.Claim(context.Background(), record, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, handler)
+		checkResponseCode(t, http.StatusConflict, rr.Code)
+	})
+}
+
+// testMailer keeps the data of the emails sent.
+type testMailer struct {
+	sent []any
+}
+
+func (m *testMailer) Send(ctx context.Context, templateFile string, username string, email string, data any, isSandbox bool) (int, error) {
+	m.sent = append(m.sent, data)
+	return http.StatusOK, nil
+}
+
+func (m *testMailer) Ping(ctx context.Context) error {
+	return nil
+}
+
+func TestIdempotentRegistration(t *testing.T) {
+	app := newTestApplication(t)
+	mailer := &testMailer{}
+	app.mailer = mailer
+	mux := app.routes()
+
+	body := `{"username": "gopher", "email": "gopher@example.com", "password": "password"}`
+	req, err := http.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(idempotencyKeyHeader, "register")
+
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	if len(mailer.sent) != 1 {
+		t.Fatalf("WANT the activation email sent BUT GOT %d emails", len(mailer.sent))
+	}
+	activationURL := reflect.ValueOf(mailer.sent[0]).FieldByName("ActivationURL").String()
+	token := activationURL[strings.LastIndex(activationURL, "/")+1:]
+
+	stored, err := app.store.Idempotency.Claim(context.Background(), &store.IdempotencyRecord{Scope: "anonymous", Key: "register"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.Status != http.StatusCreated {
+		t.Fatalf("WANT the response stored BUT GOT %v", stored)
+	}
+	if token == "" || strings.Contains(string(stored.Body), token) {
+		t.Errorf("WANT no activation token in the stored response BUT GOT %s", stored.Body)
+	}
+}
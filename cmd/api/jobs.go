@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/longlnOff/social/internal/trending"
+	"go.uber.org/zap"
+)
+
+// startJobs runs the background jobs until ctx is done, waitJobs waits for
+// them to return.
+func (app *application) startJobs(ctx context.Context) {
+	app.startJob(ctx, "refresh suggestions", app.configuration.Jobs.SUGGESTIONS_REFRESH_INTERVAL, app.store.Suggestion.Refresh)
+	app.startJob(ctx, "refresh trending", app.configuration.Jobs.TRENDING_REFRESH_INTERVAL, app.refreshTrending)
+	app.startJob(ctx, "purge deleted accounts", app.configuration.Jobs.ACCOUNT_PURGE_INTERVAL, app.purgeAccounts)
+	app.startJob(ctx, "process data exports", app.configuration.Jobs.DATA_EXPORT_INTERVAL, app.processDataExports)
+	app.startJob(ctx, "purge idempotency keys", app.configuration.Jobs.IDEMPOTENCY_PURGE_INTERVAL, app.store.Idempotency.DeleteExpired)
+}
+
+func (app *application) startJob(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	app.jobs.Add(1)
+	go func() {
+		defer app.jobs.Done()
+		app.runPeriodically(ctx, name, interval, job)
+	}()
+}
+
+// background runs fn apart from the request, like the jobs it is waited for
+// on shutdown.
+func (app *application) background(fn func()) {
+	app.jobs.Add(1)
+	go func() {
+		defer app.jobs.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("Background task panicked:", zap.Any("error", err))
+			}
+		}()
+		fn()
+	}()
+}
+
+// waitJobs waits for the background jobs to return, at most until ctx is
+// done.
+func (app *application) waitJobs(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		app.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refreshTrending ranks the recent activity of every trending window.
+func (app *application) refreshTrending(ctx context.Context) error {
+	now := time.Now()
+	activities, err := app.store.Post.GetActivity(ctx, now.Add(-trending.Longest()))
+	if err != nil {
+		return err
+	}
+
+	for _, window := range trending.Windows {
+		board := trending.Compute(activities, window, now)
+		if err := app.trending.Replace(ctx, window.Name, board); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPeriodically runs job right away and then every interval. A zero
+// interval disables the job.
+func (app *application) runPeriodically(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	if interval <= 0 {
+		app.logger.Info("Background job disabled:", zap.String("job", name))
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		app.metrics.jobStarted(name)
+		err := app.traceJob(ctx, name, job)
+		app.metrics.jobDone(name, time.Since(start), err)
+		if err != nil {
+			app.logger.Error("Background job failed:", zap.String("job", name), zap.String("error", err.Error()))
+		} else {
+			app.logger.Info("Background job done:", zap.String("job", name), zap.Duration("duration", time.Since(start)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,50 +1,119 @@
 package main
 
 import (
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/longlnOff/social/cmd/configuration"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func createLogger() *zap.Logger {
+// createLogger builds the logger of the API. Its level can be changed while
+// it runs through the returned AtomicLevel. The entries repeated within a
+// second are sampled: the first cfg.LOG_SAMPLING_INITIAL are written, then one
+// in every cfg.LOG_SAMPLING_THEREAFTER. Secrets are redacted from the fields.
+func createLogger(cfg configuration.LoggingConfiguration, environment string) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevel()
+	if cfg.LOG_LEVEL != "" {
+		if err := level.UnmarshalText([]byte(cfg.LOG_LEVEL)); err != nil {
+			return nil, level, err
+		}
+	}
+
 	encoderCfg := zap.NewProductionEncoderConfig()
 	encoderCfg.TimeKey = "timestamp"
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
 
 	// Set the level encoder to uppercase or colored uppercase based on environment
-	development := false
-	if os.Getenv("ENVIRONMENT") == "development" {
-		development = true
-		encoderCfg.EncodeLevel = ColorLevelEncoder // Use colors in development
+	development := environment == "development"
+	var encoder zapcore.Encoder
+	if development {
+		// Use the console encoder and colors for better readability in development
+		encoderCfg.EncodeLevel = ColorLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
 	} else {
 		encoderCfg.EncodeLevel = UppercaseLevelEncoder // Just uppercase in production
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	}
+
+	var core zapcore.Core = redactingCore{Core: zapcore.NewCore(encoder, zapcore.Lock(os.Stdout), level)}
+	if cfg.LOG_SAMPLING_INITIAL > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.LOG_SAMPLING_INITIAL, cfg.LOG_SAMPLING_THEREAFTER)
 	}
 
-	// Choose console encoder for better readability with colors in development
-	encoding := "json"
+	options := []zap.Option{zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr))}
 	if development {
-		encoding = "console"
+		options = append(options, zap.Development())
+	}
+	return zap.New(core, options...), level, nil
+}
+
+// redactedKeys are the fields whose values are never written.
+var redactedKeys = map[string]bool{
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+	"authorization": true,
+	"api_key":       true,
+	"cookie":        true,
+}
+
+// redactingCore writes the fields of the entries with the secrets redacted:
+// the values of the redactedKeys fields and the passwords of the URLs.
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c redactingCore) With(fields []zap.Field) zapcore.Core {
+	return redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
 	}
+	return checked
+}
 
-	config := zap.Config{
-		Level:             zap.NewAtomicLevelAt(zap.DebugLevel),
-		Development:       development,
-		DisableCaller:     false,
-		DisableStacktrace: true,
-		Sampling:          nil,
-		Encoding:          encoding,
-		EncoderConfig:     encoderCfg,
-		OutputPaths: []string{
-			"stdout",
-		},
-		ErrorOutputPaths: []string{
-			"stderr",
-		},
+func (c redactingCore) Write(entry zapcore.Entry, fields []zap.Field) error {
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zap.Field) []zap.Field {
+	// the fields are copied only when one of them has a secret
+	redacted := fields
+	copied := false
+	for i, field := range fields {
+		value, changed := redactField(field)
+		if !changed {
+			continue
+		}
+		if !copied {
+			redacted = append([]zap.Field(nil), fields...)
+			copied = true
+		}
+		redacted[i] = value
 	}
+	return redacted
+}
 
-	return zap.Must(config.Build())
+func redactField(field zap.Field) (zap.Field, bool) {
+	if redactedKeys[strings.ToLower(field.Key)] {
+		return zap.String(field.Key, "[REDACTED]"), true
+	}
+	if field.Type == zapcore.StringType && strings.Contains(field.String, "://") {
+		u, err := url.Parse(field.String)
+		if err != nil || u.User == nil {
+			return field, false
+		}
+		if _, ok := u.User.Password(); ok {
+			return zap.String(field.Key, u.Redacted()), true
+		}
+	}
+	return field, false
 }
 
 // Custom level encoder that converts log levels to uppercase
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/longlnOff/social/internal/store"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type LoggerCTX string
+
+var Loggerctx LoggerCTX = "logger"
+
+// requestLog holds the logger of a request, tagged with the request ID and
+// the trace, and with the user once authenticated.
+type requestLog struct {
+	logger *zap.Logger
+	userID int64
+}
+
+// accessLog makes the logger of the request reachable from its context and
+// logs the request once served.
+func (app *application) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &requestLog{
+			logger: withTrace(app.logger, r.Context()).With(zap.String("request_id", middleware.GetReqID(r.Context()))),
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), Loggerctx, entry)))
+
+		// the route and not the path, the paths may hold tokens
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		level := zapcore.InfoLevel
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = zapcore.ErrorLevel
+		case untracedPaths[r.URL.Path]:
+			// polled all the time, only worth seeing when debugging
+			level = zapcore.DebugLevel
+		}
+		entry.logger.Log(level, "Request:",
+			zap.String("method", r.Method),
+			zap.String("route", route),
+			zap.Int("status", status),
+			zap.Int("bytes", ww.BytesWritten()),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("ip", clientIP(r)),
+		)
+	})
+}
+
+// setRequestUser tags the logger of the request with the authenticated user.
+func setRequestUser(ctx context.Context, userID int64) {
+	if entry, ok := ctx.Value(Loggerctx).(*requestLog); ok && entry.userID == 0 {
+		entry.userID = userID
+		entry.logger = entry.logger.With(zap.Int64("user_id", userID))
+	}
+}
+
+// loggerFor is the logger of the request or job running with ctx, so its
+// entries can be told apart and found from the trace.
+func (app *application) loggerFor(ctx context.Context) *zap.Logger {
+	if entry, ok := ctx.Value(Loggerctx).(*requestLog); ok {
+		return entry.logger
+	}
+	return withTrace(app.logger, ctx)
+}
+
+// withTrace tags logger with the span running with ctx, if any.
+func withTrace(logger *zap.Logger, ctx context.Context) *zap.Logger {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return logger
+	}
+	return logger.With(
+		zap.String("trace_id", spanContext.TraceID().String()),
+		zap.String("span_id", spanContext.SpanID().String()),
+	)
+}
+
+type LogLevelPayload struct {
+	Level string `json:"level" validate:"required,oneof=debug info warn error"`
+}
+
+// getLogLevelHandler godoc
+//
+//	@Summary		Get the log level
+//	@Description	Returns the level of the logs written by this instance of the API
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	LogLevelPayload
+//	@Failure		403	{object}	Problem	"Not an administrator"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/log-level [get]
+func (app *application) getLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, LogLevelPayload{Level: app.logLevel.String()}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateLogLevelHandler godoc
+//
+//	@Summary		Change the log level
+//	@Description	Changes the level of the logs written by this instance of the API until it restarts, the other instances keep theirs
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		LogLevelPayload	true	"New level"
+//	@Success		200		{object}	LogLevelPayload
+//	@Failure		400		{object}	Problem	"Invalid level"
+//	@Failure		403		{object}	Problem	"Not an administrator"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/log-level [put]
+func (app *application) updateLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var payload LogLevelPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before := app.logLevel.String()
+	if err := app.logLevel.UnmarshalText([]byte(payload.Level)); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.recordAudit(r, store.AuditEvent{
+		Action:     "log.level_changed",
+		TargetType: "logger",
+		Before:     map[string]any{"level": before},
+		After:      map[string]any{"level": payload.Level},
+	})
+	app.loggerFor(r.Context()).Warn("Log level changed:", zap.String("from", before), zap.String("to", payload.Level))
+
+	if err := app.jsonResponse(w, http.StatusOK, payload); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
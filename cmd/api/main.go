@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/longlnOff/social/cmd/configuration"
 	"github.com/longlnOff/social/internal/auth"
 	"github.com/longlnOff/social/internal/db"
+	"github.com/longlnOff/social/internal/health"
 	"github.com/longlnOff/social/internal/mailer"
+	"github.com/longlnOff/social/internal/media"
+	"github.com/longlnOff/social/internal/ratelimit"
 	"github.com/longlnOff/social/internal/store"
 	"github.com/longlnOff/social/internal/store/cache"
+	"github.com/longlnOff/social/internal/stream"
+	"github.com/longlnOff/social/internal/tracing"
+	"github.com/longlnOff/social/internal/trending"
 	"go.uber.org/zap"
 )
 
@@ -31,12 +42,28 @@ import (
 // @name						Authorization
 // @description				Type "Bearer" followed by a space and then your token
 func main() {
-	logger := createLogger()
+	cfg, err := configuration.LoadConfig(".")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	logger, logLevel, err := createLogger(cfg.Logging, cfg.Server.ENVIRONMENT)
+	if err != nil {
+		log.Fatal("Invalid logging: ", err.Error())
+	}
 	defer logger.Sync()
 
-	cfg, err := configuration.LoadConfig(".")
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:     cfg.Tracing.TRACING_EXPORTER,
+		ServiceName:  cfg.Tracing.TRACING_SERVICE_NAME,
+		Version:      cfg.Server.VERSION,
+		Environment:  cfg.Server.ENVIRONMENT,
+		OTLPEndpoint: cfg.Tracing.TRACING_OTLP_ENDPOINT,
+		OTLPInsecure: cfg.Tracing.TRACING_OTLP_INSECURE,
+		SampleRatio:  cfg.Tracing.TRACING_SAMPLE_RATIO,
+	})
 	if err != nil {
-		logger.Fatal(err.Error())
+		logger.Fatal("Invalid tracing:", zap.String("error", err.Error()))
 	}
 
 	database, err := db.New(
@@ -54,22 +81,92 @@ func main() {
 	if err != nil {
 		logger.Panic(err.Error())
 	}
-	defer database.Close()
-	logger.Info("Connected to database.", zap.String("url", fmt.Sprintf("postgres://%s:%s@%s:%s/%s", cfg.Database.USER, cfg.Database.PASSWORD, cfg.Database.HOST, cfg.Database.PORT, cfg.Database.DB_NAME)))
+	logger.Info("Connected to database.", zap.String("host", cfg.Database.HOST), zap.String("port", cfg.Database.PORT), zap.String("database", cfg.Database.DB_NAME), zap.String("user", cfg.Database.USER))
 
 	// cache
 	var cacheClient *redis.Client
 	if cfg.Cache.CACHE_ENABLED {
 		cacheClient = cache.NewValkeyClient(cfg.Cache.CACHE_ADDRESS, cfg.Cache.CACHE_PASSWORD, cfg.Cache.CACHE_DATABASE)
+		cacheClient.AddHook(tracing.RedisHook{})
 		logger.Info("Connected to cache.", zap.String("address", cfg.Cache.CACHE_ADDRESS))
 	}
 	cacheStorage := cache.NewCacheStorage(cacheClient)
 
+	// event stream
+	var broker stream.Broker
+	if cfg.Cache.CACHE_ENABLED {
+		broker = stream.NewValkeyBroker(cacheClient, cfg.Stream.STREAM_HISTORY_SIZE, cfg.Stream.STREAM_HISTORY_TTL, cfg.Stream.STREAM_BUFFER_SIZE)
+	} else {
+		broker = stream.NewMemoryBroker(cfg.Stream.STREAM_HISTORY_SIZE, cfg.Stream.STREAM_HISTORY_TTL, cfg.Stream.STREAM_BUFFER_SIZE)
+	}
+
+	// trending leaderboards, kept for two refreshes so they never go missing
+	var trendingStore trending.Store
+	if cfg.Cache.CACHE_ENABLED {
+		trendingStore = trending.NewValkeyStore(cacheClient, 2*cfg.Jobs.TRENDING_REFRESH_INTERVAL)
+	} else {
+		trendingStore = trending.NewMemoryStore()
+	}
+
+	// rate limits, shared by the replicas through the cache when enabled
+	var limiter ratelimit.Limiter
+	if cfg.RateLimit.RATE_LIMIT_ENABLED {
+		algorithm := ratelimit.Algorithm(cfg.RateLimit.RATE_LIMIT_ALGORITHM)
+		if cfg.Cache.CACHE_ENABLED {
+			limiter, err = ratelimit.NewValkeyLimiter(cacheClient, algorithm)
+		} else {
+			limiter, err = ratelimit.NewMemoryLimiter(algorithm)
+		}
+		if err != nil {
+			logger.Fatal("Invalid rate limiter:", zap.String("error", err.Error()))
+		}
+	}
+	rateLimits, err := newRateLimits(cfg.RateLimit)
+	if err != nil {
+		logger.Fatal("Invalid rate limits:", zap.String("error", err.Error()))
+	}
+	trustedProxies, err := parseTrustedProxies(cfg.Server.SERVER_TRUSTED_PROXIES)
+	if err != nil {
+		logger.Fatal("Invalid trusted proxies:", zap.String("error", err.Error()))
+	}
+
+	mediaStorage := media.NewLocalStorage(cfg.Media.MEDIA_DIR, cfg.Media.MEDIA_BASE_URL)
+	// data exports are only served through their time-limited links
+	exportStorage := media.NewLocalStorage(cfg.Account.EXPORT_DIR, "")
+
+	if !store.DeletionPolicy(cfg.Account.ACCOUNT_DELETION_POLICY).Valid() {
+		logger.Fatal("Invalid account deletion policy:", zap.String("policy", cfg.Account.ACCOUNT_DELETION_POLICY))
+	}
+
+	contentFilters, err := newContentFilters(cfg.Moderation)
+	if err != nil {
+		logger.Fatal("Invalid content filters:", zap.String("error", err.Error()))
+	}
+
+	auditStore := store.NewAudit(database, cfg.Audit.AUDIT_HASH_CHAIN)
 	store := store.NewStorage(database)
-	mailer, err := mailer.NewMailTrapClient(cfg.Mail.MailTrap.API_KEY, cfg.Mail.FROM_EMAIL)
+	store.Audit = auditStore
+	mailtrap, err := mailer.NewMailTrapClient(cfg.Mail.MailTrap.API_KEY, cfg.Mail.FROM_EMAIL)
 	if err != nil {
 		logger.Fatal(err.Error())
 	}
+	var mailClient mailer.Client = tracedMailer{Client: mailtrap}
+
+	var appMetrics *metrics
+	if cfg.Metrics.METRICS_ENABLED {
+		appMetrics = newMetrics(database)
+		mailClient = instrumentedMailer{Client: mailClient, metrics: appMetrics}
+	}
+
+	// readiness checks
+	checks := health.NewChecker(cfg.Health.HEALTH_CHECK_TIMEOUT, cfg.Health.HEALTH_CACHE_TTL)
+	checks.Register("postgres", database.PingContext)
+	if cacheClient != nil {
+		checks.Register("valkey", func(ctx context.Context) error {
+			return cacheClient.Ping(ctx).Err()
+		})
+	}
+	checks.Register("mail", mailClient.Ping)
 
 	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.Auth.Token.AUTH_TOKEN_SECRET,
 		cfg.Auth.Token.AUTH_TOKEN_ISS,
@@ -77,15 +174,65 @@ func main() {
 	)
 
 	app := &application{
-		configuration: cfg,
-		store:         store,
-		cacheStore:    cacheStorage,
-		logger:        logger,
-		mailer:        mailer,
-		authenticator: jwtAuthenticator,
+		configuration:  cfg,
+		store:          store,
+		cacheStore:     cacheStorage,
+		logger:         logger,
+		logLevel:       logLevel,
+		mailer:         mailClient,
+		authenticator:  jwtAuthenticator,
+		broker:         broker,
+		trending:       trendingStore,
+		media:          mediaStorage,
+		exports:        exportStorage,
+		filters:        contentFilters,
+		limiter:        limiter,
+		rateLimits:     rateLimits,
+		trustedProxies: trustedProxies,
+		health:         checks,
+		metrics:        appMetrics,
 	}
 
+	// the jobs are stopped once the requests in flight are done
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	app.startJobs(jobsCtx)
+
 	mux := app.routes()
 
-	app.logger.Fatal(app.run(mux).Error())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := app.run(ctx, mux)
+	if serveErr != nil {
+		logger.Error("Server failed:", zap.String("error", serveErr.Error()))
+	}
+
+	// the mails are sent by the requests and the jobs, they are done once
+	// both are
+	stopJobs()
+	waitCtx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout())
+	if err := app.waitJobs(waitCtx); err != nil {
+		logger.Warn("Background jobs did not stop in time:", zap.String("error", err.Error()))
+	}
+	cancel()
+
+	if cacheClient != nil {
+		if err := cacheClient.Close(); err != nil {
+			logger.Error("Failed to close cache:", zap.String("error", err.Error()))
+		}
+	}
+	if err := database.Close(); err != nil {
+		logger.Error("Failed to close database:", zap.String("error", err.Error()))
+	}
+	// the spans left are sent last, they include the shutdown
+	tracingCtx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout())
+	if err := shutdownTracing(tracingCtx); err != nil {
+		logger.Error("Failed to flush traces:", zap.String("error", err.Error()))
+	}
+	cancel()
+	logger.Info("Server stopped.")
+
+	if serveErr != nil {
+		logger.Sync()
+		os.Exit(1)
+	}
 }
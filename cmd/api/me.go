@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/longlnOff/social/internal/mailer"
+	"github.com/longlnOff/social/internal/media"
+	"github.com/longlnOff/social/internal/store"
+)
+
+type UpdateProfilePayload struct {
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	Website     *string `json:"website" validate:"omitempty,url,max=255"`
+	Location    *string `json:"location" validate:"omitempty,max=100"`
+	Username    *string `json:"username" validate:"omitempty,min=1,max=100"`
+	Email       *string `json:"email" validate:"omitempty,email,max=250"`
+}
+
+// MeResponse is the profile of the authenticated user. PendingEmail is set
+// while a new email waits for its confirmation.
+type MeResponse struct {
+	UserProfile
+	PendingEmail string `json:"pending_email,omitempty"`
+}
+
+// getMeHandler godoc
+//
+//	@Summary		Get my profile
+//	@Description	Retrieves the profile of the authenticated user
+//	@Tags			users,profile
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	MeResponse	"Profile"
+//	@Failure		500	{object}	Problem		"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [get]
+func (app *application) getMeHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	stats, err := app.store.User.GetStats(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, MeResponse{UserProfile: UserProfile{User: user, UserStats: *stats}}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// updateMeHandler godoc
+//
+//	@Summary		Update my profile
+//	@Description	Updates the profile of the authenticated user. The username can be changed once every 30 days, the old one redirects to the new one. A new email is only used once confirmed through the link sent to it
+//	@Tags			users,profile
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		UpdateProfilePayload	true	"Profile fields to change"
+//	@Success		200		{object}	MeResponse				"Updated profile"
+//	@Failure		400		{object}	Problem					"Invalid request payload"
+//	@Failure		409		{object}	Problem					"Username or email already taken"
+//	@Failure		429		{object}	Problem					"Username changed too recently"
+//	@Failure		500		{object}	Problem					"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (app *application) updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+	update := store.ProfileUpdate{
+		DisplayName: payload.DisplayName,
+		Bio:         payload.Bio,
+		Website:     payload.Website,
+		Location:    payload.Location,
+		Username:    payload.Username,
+	}
+
+	// the new email is confirmed with a token, like at registration
+	var plainToken string
+	if payload.Email != nil && *payload.Email != user.Email {
+		plainToken = uuid.New().String()
+		hash := sha256.Sum256([]byte(plainToken))
+		update.Email = payload.Email
+		update.EmailToken = hex.EncodeToString(hash[:])
+		update.EmailExpiry = app.configuration.Mail.EXP
+	}
+
+	if err := app.store.User.UpdateProfile(ctx, user.ID, update); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateUsername), errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrUsernameChangeTooSoon):
+			app.tooManyRequestsResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.invalidateUser(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	updated, err := app.store.User.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := MeResponse{UserProfile: UserProfile{User: updated}}
+	if update.Email != nil {
+		if err := app.sendEmailVerification(ctx, updated.Username, *update.Email, plainToken); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		res.PendingEmail = *update.Email
+	}
+
+	stats, err := app.store.User.GetStats(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	res.UserStats = *stats
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// updateAvatarHandler godoc
+//
+//	@Summary		Upload my avatar
+//	@Description	Replaces the avatar of the authenticated user. The image is cropped to a square and resized
+//	@Tags			users,profile
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			avatar	formData	file		true	"JPEG, PNG or GIF image, up to 5MB"
+//	@Success		200		{object}	store.User	"Updated user"
+//	@Failure		400		{object}	Problem		"Invalid image"
+//	@Failure		413		{object}	Problem		"Image too large"
+//	@Failure		500		{object}	Problem		"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [put]
+func (app *application) updateAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	// leave room for the multipart envelope around the file
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxAvatarSize+1<<20)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			app.payloadTooLargeResponse(w, r, media.ErrTooLarge)
+			return
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	avatar, err := media.ProcessAvatar(file)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrTooLarge):
+			app.payloadTooLargeResponse(w, r, err)
+		case errors.Is(err, media.ErrUnsupportedFormat):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+	key := fmt.Sprintf("avatars/%d-%s.jpg", user.ID, uuid.New().String())
+	avatarURL, err := app.media.Put(ctx, key, "image/jpeg", avatar)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	previous, err := app.store.User.UpdateAvatar(ctx, user.ID, avatarURL)
+	if err != nil {
+		app.media.Delete(ctx, key)
+		app.internalServerError(w, r, err)
+		return
+	}
+	if previousKey, ok := app.media.Key(previous); ok {
+		if err := app.media.Delete(ctx, previousKey); err != nil {
+			app.loggerFor(r.Context()).Error("Error deleting previous avatar:", zap.String("error", err.Error()), zap.String("key", previousKey))
+		}
+	}
+
+	if err := app.invalidateUser(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user.AvatarURL = avatarURL
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// verifyEmailHandler godoc
+//
+//	@Summary		Confirm a new email
+//	@Description	Switches the account to the email the token was sent to
+//	@Tags			users,profile
+//	@Accept			json
+//	@Produce		json
+//	@Param			token	path		string	true	"Verification token"
+//	@Success		204		{string}	string	"Email confirmed"
+//	@Failure		404		{object}	Problem	"Token not found or expired"
+//	@Failure		409		{object}	Problem	"Email already taken"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Router			/users/email/verify/{token} [put]
+func (app *application) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := app.store.User.VerifyEmail(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.invalidateUser(ctx, userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getUserByUsernameHandler godoc
+//
+//	@Summary		Get user by username
+//	@Description	Retrieves a user by username. A former username redirects to the current one
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			username	path		string		true	"Username"
+//	@Success		200			{object}	UserProfile	"User details"
+//	@Success		301			{string}	string		"Redirect to the current username"
+//	@Failure		404			{object}	Problem		"User not found"
+//	@Failure		500			{object}	Problem		"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/username/{username} [get]
+func (app *application) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	username := chi.URLParam(r, "username")
+
+	user, err := app.store.User.GetByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		current, err := app.store.User.GetUsernameRedirect(ctx, username)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		http.Redirect(w, r, getAPIVersion(r).prefix()+"/users/username/"+url.PathEscape(current), http.StatusMovedPermanently)
+		return
+	}
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	blocked, err := app.store.Block.IsBlocked(ctx, getUserFromCtx(r).ID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if blocked {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	stats, err := app.store.User.GetStats(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, UserProfile{User: user, UserStats: *stats}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) sendEmailVerification(ctx context.Context, username string, email string, plainToken string) error {
+	isProduction := app.configuration.Server.ENVIRONMENT == "production"
+	vars := struct {
+		Username        string
+		VerificationURL string
+	}{
+		Username:        username,
+		VerificationURL: app.configuration.Server.FRONTEND_URL + "/confirm-email/" + plainToken,
+	}
+
+	status, err := app.mailer.Send(ctx, mailer.EmailChangeTemplate, username, email, vars, !isProduction)
+	if err != nil {
+		return err
+	}
+	app.loggerFor(ctx).Info("Email sent to:", zap.String("email", email), zap.Int("status", status))
+	return nil
+}
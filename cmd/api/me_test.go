@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestGetUserByUsername(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+
+	ctx := context.Background()
+	for _, username := range []string{"gopher", "gopher2"} {
+		if err := app.store.User.UpdateProfile(ctx, 2, store.ProfileUpdate{Username: &username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("should redirect a former username in the version of the request", func(t *testing.T) {
+		for _, version := range []string{"/v1", "/v2"} {
+			req, err := http.NewRequest(http.MethodGet, version+"/users/username/gopher", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer 123")
+
+			rr := executeRequest(req, mux)
+			checkResponseCode(t, http.StatusMovedPermanently, rr.Code)
+			if location := rr.Header().Get("Location"); location != version+"/users/username/gopher2" {
+				t.Errorf("WANT %s/users/username/gopher2 BUT GOT %s", version, location)
+			}
+		}
+	})
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/longlnOff/social/internal/media"
+	"github.com/longlnOff/social/internal/store"
+)
+
+// mediaHandler serves the files of the local media storage. Every upload gets
+// a new key, so the files can be cached for good. Directories are not listed.
+func (app *application) mediaHandler(storage *media.LocalStorage) http.HandlerFunc {
+	files := http.StripPrefix("/v1/media/", http.FileServer(http.Dir(storage.Dir())))
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		files.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/longlnOff/social/internal/mailer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics are the Prometheus metrics of the API. The labels only take values
+// from bounded sets: route patterns rather than paths, known methods, mail
+// templates, job names and known clients.
+type metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+	cacheLookups *prometheus.CounterVec
+	mailSends    *prometheus.HistogramVec
+	jobRuns      *prometheus.CounterVec
+	jobDuration  *prometheus.GaugeVec
+	jobSuccess   *prometheus.GaugeVec
+	jobRunning   *prometheus.GaugeVec
+
+	deprecatedRequests *prometheus.CounterVec
+}
+
+func newMetrics(db *sql.DB) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of the HTTP requests by route, method and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served.",
+		}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_lookups_total",
+			Help: "Lookups in the cache by cache and result, hit, miss or error.",
+		}, []string{"cache", "result"}),
+		mailSends: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mail_send_duration_seconds",
+			Help:    "Duration of the mail sends by template and outcome.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"template", "outcome"}),
+		jobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "job_runs_total",
+			Help: "Runs of the background jobs by job and outcome.",
+		}, []string{"job", "outcome"}),
+		jobDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "job_last_duration_seconds",
+			Help: "Duration of the last run of the background jobs.",
+		}, []string{"job"}),
+		jobSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "job_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful run of the background jobs.",
+		}, []string{"job"}),
+		jobRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "job_running",
+			Help: "Whether the background jobs are running, 1 or 0.",
+		}, []string{"job"}),
+		deprecatedRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_deprecated_requests_total",
+			Help: "Requests to the deprecated routes by route and client.",
+		}, []string{"route", "client"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpInFlight,
+		m.cacheLookups,
+		m.mailSends,
+		m.jobRuns,
+		m.jobDuration,
+		m.jobSuccess,
+		m.jobRunning,
+		m.deprecatedRequests,
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+	}
+	return m
+}
+
+// handler serves the metrics, to the holders of the token when there is one.
+func (m *metrics) handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return metrics
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeProblem(w, Problem{
+				Type:   problemTypePrefix + "unauthorized",
+				Title:  http.StatusText(http.StatusUnauthorized),
+				Status: http.StatusUnauthorized,
+				Code:   "unauthorized",
+			})
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+// instrument measures the requests, labeled by the pattern of the route they
+// matched once served.
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.httpInFlight.Inc()
+		defer m.httpInFlight.Dec()
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.httpRequests.WithLabelValues(route, metricMethod(r.Method), strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricMethod keeps the made up methods out of the labels.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+func (m *metrics) deprecatedRequest(route string, client string) {
+	if m == nil {
+		return
+	}
+	m.deprecatedRequests.WithLabelValues(route, client).Inc()
+}
+
+func (m *metrics) cacheLookup(cache string, result string) {
+	if m == nil {
+		return
+	}
+	m.cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+func (m *metrics) jobStarted(job string) {
+	if m == nil {
+		return
+	}
+	m.jobRunning.WithLabelValues(job).Set(1)
+}
+
+func (m *metrics) jobDone(job string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.jobRunning.WithLabelValues(job).Set(0)
+	m.jobDuration.WithLabelValues(job).Set(duration.Seconds())
+	if err != nil {
+		m.jobRuns.WithLabelValues(job, "failure").Inc()
+		return
+	}
+	m.jobRuns.WithLabelValues(job, "success").Inc()
+	m.jobSuccess.WithLabelValues(job).SetToCurrentTime()
+}
+
+// instrumentedMailer measures the sends of a mailer.
+type instrumentedMailer struct {
+	mailer.Client
+	metrics *metrics
+}
+
+func (m instrumentedMailer) Send(ctx context.Context, templateFile string, username string, email string, data any, isSanbox bool) (int, error) {
+	start := time.Now()
+	status, err := m.Client.Send(ctx, templateFile, username, email, data, isSanbox)
+
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	m.metrics.mailSends.WithLabelValues(templateFile, outcome).Observe(time.Since(start).Seconds())
+	return status, err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	app.metrics = newMetrics(nil)
+	app.configuration.Metrics.METRICS_TOKEN = "secret"
+	mux := app.routes()
+
+	get := func(path string, token string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := executeRequest(req, mux)
+		return rr.Code, rr.Body.String()
+	}
+
+	get("/livez", "")
+	get("/unknown/12345", "")
+
+	t.Run("should require the token", func(t *testing.T) {
+		code, _ := get("/metrics", "")
+		checkResponseCode(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("should label the requests by route pattern", func(t *testing.T) {
+		code, body := get("/metrics", "secret")
+		checkResponseCode(t, http.StatusOK, code)
+		if !strings.Contains(body, `route="/livez"`) || !strings.Contains(body, `route="unmatched"`) {
+			t.Errorf("WANT the requests labeled by route BUT GOT %s", body)
+		}
+		if strings.Contains(body, "12345") {
+			t.Error("WANT no raw path in the labels")
+		}
+	})
+}
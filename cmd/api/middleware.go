@@ -5,15 +5,27 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/longlnOff/social/internal/store"
 	"go.uber.org/zap"
 )
 
+var (
+	errMissingAuthHeader  = errors.New("no auth header")
+	errInvalidAuthHeader  = errors.New("invalid auth header")
+	errInvalidCredentials = errors.New("invalid auth credentials")
+	errTokenRevoked       = errors.New("token revoked")
+	errPermissionDenied   = errors.New("permission denied")
+)
+
 // AuthorizationMiddleware for post
 func (app *application) checkPostownership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -36,21 +48,55 @@ func (app *application) checkPostownership(requiredRole string, next http.Handle
 		}
 
 		if !allowed {
-			app.forbiddenErrorResponse(w, r, fmt.Errorf("permission denied"))
+			app.forbiddenErrorResponse(w, r, errPermissionDenied)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		// 4. audit the moderation of someone else's post
+		before := map[string]any{"title": post.Title, "content": post.Content, "tags": post.Tags}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() < 200 || ww.Status() >= 300 {
+			return
+		}
+
+		event := store.AuditEvent{
+			Action:     "post.deleted",
+			TargetType: "post",
+			TargetID:   post.ID,
+			Before:     before,
+			Details:    map[string]any{"owner_id": post.UserID},
+		}
+		if r.Method != http.MethodDelete {
+			event.Action = "post.updated"
+			event.After = map[string]any{"title": post.Title, "content": post.Content, "tags": post.Tags}
+		}
+		app.recordAudit(r, event)
 	})
 }
 
 func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, requiredRole string) (bool, error) {
-	role, err := app.store.Role.GetByName(ctx, requiredRole)
+	level, err := app.roleLevel(ctx, requiredRole)
 	if err != nil {
 		return false, err
 	}
 
-	return role.Level <= user.Role.Level, nil
+	return level <= user.Role.Level, nil
+}
+
+// roleLevel returns the level of the role. The roles only change with the
+// migrations, their levels are loaded once.
+func (app *application) roleLevel(ctx context.Context, name string) (int64, error) {
+	if level, ok := app.roleLevels.Load(name); ok {
+		return level.(int64), nil
+	}
+
+	role, err := app.store.Role.GetByName(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	app.roleLevels.Store(name, role.Level)
+	return role.Level, nil
 }
 
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
@@ -59,13 +105,13 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		// Add this right before checking the auth header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			app.unauthorizedJWTStatelessErrorResponse(w, r, fmt.Errorf("no auth header"))
+			app.unauthorizedJWTStatelessErrorResponse(w, r, errMissingAuthHeader)
 			return
 		}
 		// 2. parse it --> get the token
 		parts := strings.Split(authHeader, " ") // Authorization: Bearer <token>
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			app.unauthorizedJWTStatelessErrorResponse(w, r, fmt.Errorf("invalid auth header"))
+			app.unauthorizedJWTStatelessErrorResponse(w, r, errInvalidAuthHeader)
 			return
 		}
 		token := parts[1]
@@ -96,28 +142,59 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// 4. reject the tokens issued before the user was logged out
+		if user.TokensValidAfter != nil {
+			issuedAt, err := claims.GetIssuedAt()
+			if err != nil || issuedAt == nil || !issuedAt.After(*user.TokensValidAfter) {
+				app.unauthorizedJWTStatelessErrorResponse(w, r, errTokenRevoked)
+				return
+			}
+		}
+
+		// 5. reject the suspended users, read-only ones go through
+		if suspension := user.Restriction(time.Now()); suspension != nil && suspension.Kind == store.SuspensionFull {
+			app.accountRestrictedResponse(w, r, suspension)
+			return
+		}
+
+		setRequestUser(ctx, user.ID)
 		ctx = context.WithValue(ctx, Userctx, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// requireWriteAccess refuses the requests of the users restricted to
+// read-only, who may not write anything others can read: posts, comments,
+// messages, reports or their profile.
+func (app *application) requireWriteAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if suspension := getUserFromCtx(r).Restriction(time.Now()); suspension != nil {
+			app.accountRestrictedResponse(w, r, suspension)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) getUser(ctx context.Context, userID int64) (*store.User, error) {
 	// 0. Check if cache is enabled
 	if !app.configuration.Cache.CACHE_ENABLED {
-		app.logger.Info("No cache connection, hit from DB", zap.Int("id", int(userID)))
+		app.loggerFor(ctx).Debug("No cache connection, hit from DB", zap.Int64("id", userID))
 		return app.store.User.GetByUserID(ctx, userID)
 	}
 	// 1. Fetch from cache
 	user, err := app.cacheStore.User.Get(ctx, userID)
 	if err != nil {
+		app.metrics.cacheLookup("user", "error")
 		return nil, err
 	}
 	// validate user
 	if user == nil {
+		app.metrics.cacheLookup("user", "miss")
 		// 2. Fetch from DB
 		user, err = app.store.User.GetByUserID(ctx, userID)
-		app.logger.Info("cache miss user", zap.Int("id", int(userID)))
-		app.logger.Info("Get from DB", zap.Int("id", int(userID)))
+		app.loggerFor(ctx).Debug("cache miss user", zap.Int64("id", userID))
 		if err != nil {
 			return nil, err
 		}
@@ -125,37 +202,123 @@ func (app *application) getUser(ctx context.Context, userID int64) (*store.User,
 		if err = app.cacheStore.User.Set(ctx, user); err != nil {
 			return nil, err
 		}
+	} else {
+		app.metrics.cacheLookup("user", "hit")
+		app.loggerFor(ctx).Debug("cache hit user", zap.Int64("id", userID))
 	}
-	app.logger.Info("cache hit user", zap.Int("id", int(userID)))
 
 	return user, nil
 }
 
+// realIP puts the IP of the client in RemoteAddr when the request came
+// through one of the trusted proxies: the last address of X-Forwarded-For
+// not added by a trusted proxy, or else X-Real-IP. The headers of the other
+// clients are ignored, anyone can send them.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.isTrustedProxy(clientIP(r)) {
+			if ip := app.forwardedIP(r); ip != "" {
+				r.RemoteAddr = ip
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) forwardedIP(r *http.Request) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		ips := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if _, err := netip.ParseAddr(ip); err != nil {
+				return ""
+			}
+			if !app.isTrustedProxy(ip) {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		if _, err := netip.ParseAddr(ip); err == nil {
+			return ip
+		}
+	}
+	return ""
+}
+
+func (app *application) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, proxy := range app.trustedProxies {
+		if proxy.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies reads the IPs and CIDRs of the trusted proxies.
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// clientIP returns the IP of the client, realIP already put the forwarded
+// one in RemoteAddr.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// invalidateUser drops the cached copy of a user after it changed.
+func (app *application) invalidateUser(ctx context.Context, userID int64) error {
+	if !app.configuration.Cache.CACHE_ENABLED {
+		return nil
+	}
+	return app.cacheStore.User.Delete(ctx, userID)
+}
+
 func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// read the auth header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				app.unauthorizedBasicAuthErrorResponse(w, r, fmt.Errorf("no auth header"))
+				app.unauthorizedBasicAuthErrorResponse(w, r, errMissingAuthHeader)
 				return
 			}
 			// parse it --> get the base64
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Basic" {
-				app.unauthorizedBasicAuthErrorResponse(w, r, fmt.Errorf("invalid auth header"))
+				app.unauthorizedBasicAuthErrorResponse(w, r, errInvalidAuthHeader)
 				return
 			}
 			// decode it
 			decoded, err := base64.StdEncoding.DecodeString(parts[1])
 			if err != nil {
-				app.unauthorizedBasicAuthErrorResponse(w, r, fmt.Errorf("invalid auth credentials"))
+				app.unauthorizedBasicAuthErrorResponse(w, r, errInvalidCredentials)
 				return
 			}
 			// check the credentials
 			credentials := strings.SplitN(string(decoded), ":", 2)
 			if len(credentials) != 2 {
-				app.unauthorizedBasicAuthErrorResponse(w, r, fmt.Errorf("invalid auth credentials"))
+				app.unauthorizedBasicAuthErrorResponse(w, r, errInvalidCredentials)
 				return
 			}
 			account, password := credentials[0], credentials[1]
@@ -163,7 +326,7 @@ func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 			username := app.configuration.Auth.Basic.AUTH_BASIC_USER
 			pass := app.configuration.Auth.Basic.AUTH_BASIC_PASSWORD
 			if account != username || password != pass {
-				app.unauthorizedBasicAuthErrorResponse(w, r, fmt.Errorf("invalid auth credentials"))
+				app.unauthorizedBasicAuthErrorResponse(w, r, errInvalidCredentials)
 				return
 			}
 
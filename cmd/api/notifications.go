@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/longlnOff/social/internal/store"
+)
+
+type UpdateNotificationPreferencesPayload struct {
+	Follow  *bool `json:"follow"`
+	Comment *bool `json:"comment"`
+	Mention *bool `json:"mention"`
+}
+
+// getNotificationsHandler godoc
+//
+//	@Summary		Get notifications
+//	@Description	Retrieves the notifications of the authenticated user with pagination
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int						false	"Limit number of results"				default(20)
+//	@Param			offset	query		int						false	"Offset for pagination"					default(0)
+//	@Param			unread	query		bool					false	"Only unread notifications"				default(false)
+//	@Param			type	query		string					false	"Notification type (follow, follow_request, follow_accepted, comment, mention, moderation_warning, report_resolved)"
+//	@Success		200		{array}		store.Notification		"Notifications"
+//	@Failure		400		{object}	Problem					"Invalid pagination parameters"
+//	@Failure		500		{object}	Problem					"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications [get]
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := app.parseNotificationsPagination(w, r)
+	if !ok {
+		return
+	}
+
+	user := getUserFromCtx(r)
+	notifications, err := app.store.Notification.GetByUserID(r.Context(), user.ID, pagination)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, notifications); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getGroupedNotificationsHandler godoc
+//
+//	@Summary		Get grouped notifications
+//	@Description	Retrieves the notifications of the authenticated user grouped by type and post
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int							false	"Limit number of results"				default(20)
+//	@Param			offset	query		int							false	"Offset for pagination"					default(0)
+//	@Param			unread	query		bool						false	"Only unread notifications"				default(false)
+//	@Param			type	query		string						false	"Notification type (follow, follow_request, follow_accepted, comment, mention, moderation_warning, report_resolved)"
+//	@Success		200		{array}		store.NotificationGroup		"Notification groups"
+//	@Failure		400		{object}	Problem						"Invalid pagination parameters"
+//	@Failure		500		{object}	Problem						"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/grouped [get]
+func (app *application) getGroupedNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := app.parseNotificationsPagination(w, r)
+	if !ok {
+		return
+	}
+
+	user := getUserFromCtx(r)
+	groups, err := app.store.Notification.GetGroupedByUserID(r.Context(), user.ID, pagination)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, groups); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// markNotificationReadHandler godoc
+//
+//	@Summary		Mark a notification as read
+//	@Description	Marks a notification of the authenticated user as read
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			notificationID	path		int		true	"Notification ID"
+//	@Success		204				{object}	nil		"No content"
+//	@Failure		404				{object}	Problem	"Notification not found"
+//	@Failure		500				{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/{notificationID}/read [put]
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	if err := app.store.Notification.MarkRead(r.Context(), user.ID, notificationID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// markAllNotificationsReadHandler godoc
+//
+//	@Summary		Mark all notifications as read
+//	@Description	Marks every unread notification of the authenticated user as read
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Success		204	{object}	nil		"No content"
+//	@Failure		500	{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/read [put]
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	if err := app.store.Notification.MarkAllRead(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getNotificationPreferencesHandler godoc
+//
+//	@Summary		Get notification preferences
+//	@Description	Retrieves which notification types the authenticated user receives
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	store.NotificationPreferences	"Notification preferences"
+//	@Failure		500	{object}	Problem							"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [get]
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	prefs, err := app.store.Notification.GetPreferences(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// updateNotificationPreferencesHandler godoc
+//
+//	@Summary		Update notification preferences
+//	@Description	Turns notification types on or off for the authenticated user
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		UpdateNotificationPreferencesPayload	true	"Notification preferences"
+//	@Success		200		{object}	store.NotificationPreferences			"Updated notification preferences"
+//	@Failure		400		{object}	Problem									"Invalid request payload"
+//	@Failure		500		{object}	Problem									"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [patch]
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateNotificationPreferencesPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+	prefs, err := app.store.Notification.GetPreferences(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.Follow != nil {
+		prefs.Follow = *payload.Follow
+	}
+	if payload.Comment != nil {
+		prefs.Comment = *payload.Comment
+	}
+	if payload.Mention != nil {
+		prefs.Mention = *payload.Mention
+	}
+
+	if err := app.store.Notification.UpdatePreferences(ctx, user.ID, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) parseNotificationsPagination(w http.ResponseWriter, r *http.Request) (store.PaginatedNotifications, bool) {
+	pagination := store.PaginatedNotifications{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	pagination, err := pagination.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return pagination, false
+	}
+
+	if err := Validate.Struct(pagination); err != nil {
+		app.badRequestResponse(w, r, err)
+		return pagination, false
+	}
+
+	return pagination, true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestNotifications(t *testing.T) {
+	app := newTestApplication(t)
+	app.store.Notification = &store.MockNotificationStore{
+		Notifications: []store.Notification{
+			{ID: 1, UserID: 1, ActorID: 2, Type: store.NotificationFollow},
+			{ID: 2, UserID: 2, ActorID: 1, Type: store.NotificationFollow},
+		},
+	}
+	mux := app.routes()
+
+	newRequest := func(t *testing.T, method, url string) *http.Request {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+		return req
+	}
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/notifications", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should only return the notifications of the user", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodGet, "/v1/notifications"), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data []store.Notification `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 1 || res.Data[0].ID != 1 {
+			t.Errorf("WANT notification 1 BUT GOT %v", res.Data)
+		}
+	})
+
+	t.Run("should mark a notification of the user as read", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodPut, "/v1/notifications/1/read"), mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("should not mark the notifications of other users as read", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodPut, "/v1/notifications/2/read"), mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -2,36 +2,43 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/longlnOff/social/internal/content"
+	"github.com/longlnOff/social/internal/moderation"
 	"github.com/longlnOff/social/internal/store"
+	"github.com/longlnOff/social/internal/stream"
 )
 
 type CreatePostPayload struct {
 	Title   string   `json:"title" validate:"required,min=3,max=100"`
 	Content string   `json:"content" validate:"required,min=3,max=1000"`
 	Tags    []string `json:"tags" validate:"required"`
+	Locale  string   `json:"locale" validate:"omitempty,bcp47_language_tag"`
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,min=3,max=100"`
-	Content *string `json:"content" validate:"omitempty,min=3,max=1000"`
+	Title   *string   `json:"title" validate:"omitempty,min=3,max=100"`
+	Content *string   `json:"content" validate:"omitempty,min=3,max=1000"`
+	Tags    *[]string `json:"tags"`
+	Locale  *string   `json:"locale" validate:"omitempty,bcp47_language_tag"`
 }
 
 type CreateCommentForPostPayload struct {
-	UserID  int64  `json:"user_id" validate:"required"`
 	Content string `json:"content" validate:"required,min=3,max=1000"`
 }
 
 type CreateCommentForPostResponse struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
+	ID        int64            `json:"id"`
+	PostID    int64            `json:"post_id"`
+	UserID    int64            `json:"user_id"`
+	Content   string           `json:"content"`
+	Entities  content.Entities `json:"entities"`
+	CreatedAt string           `json:"created_at"`
 }
 
 type PostCTX string
@@ -45,10 +52,13 @@ var Postctx PostCTX = "post"
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
-//	@Param			request	body		CreatePostPayload	true	"Post creation data"
-//	@Success		201		{object}	store.Post			"Created post"
-//	@Failure		400		{object}	string				"Invalid request payload"
-//	@Failure		500		{object}	string				"Internal Server Error"
+//	@Param			request			body		CreatePostPayload	true	"Post creation data"
+//	@Param			Idempotency-Key	header		string				false	"Key making the request safe to retry"
+//	@Success		201		{object}	PostV1Response		"Created post"
+//	@Success		202		{object}	PostV1Response		"Post held for review"
+//	@Failure		400		{object}	Problem				"Invalid request payload"
+//	@Failure		422		{object}	Problem				"Content rejected by the filters"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/posts [post]
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -65,18 +75,55 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 
 	user := getUserFromCtx(r)
 
+	screened := &moderation.Content{Kind: moderation.KindPost, UserID: user.ID, Title: payload.Title, Body: payload.Content}
+	result := app.screenContent(r.Context(), screened)
+	if result.Verdict == moderation.Reject {
+		app.recordFilterDecisions(r.Context(), screened, 0, result)
+		app.contentRejectedResponse(w, r, result.Reason())
+		return
+	}
+
+	entities, err := app.processContent(r.Context(), user.ID, payload.Content)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	post := store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		UserID:  user.ID,
-		Tags:    payload.Tags,
+		Title:    payload.Title,
+		Content:  payload.Content,
+		UserID:   user.ID,
+		Tags:     content.MergeTags(payload.Tags, entities.Hashtags()),
+		Locale:   payload.Locale,
+		Entities: entities,
+	}
+	if result.Verdict == moderation.Hold {
+		post.Hold = result.Reason()
 	}
 	if err := app.store.Post.Create(r.Context(), &post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.recordContent(screened)
+	app.recordFilterDecisions(r.Context(), screened, post.ID, result)
 
-	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
+	post.User = store.User{ID: user.ID, Username: user.Username}
+	// a held post stays out of sight until a moderator reviews it
+	if post.Hold != "" {
+		if err := app.jsonResponse(w, http.StatusAccepted, presentPost(r, post)); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.publishFeedItem(r.Context(), &post)
+	app.publishNotification(r.Context(), store.Notification{
+		ActorID: user.ID,
+		Type:    store.NotificationMention,
+		PostID:  &post.ID,
+		Actor:   post.User,
+	}, post.Entities.MentionedUserIDs())
+
+	if err := app.jsonResponse(w, http.StatusCreated, presentPost(r, post)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -89,24 +136,24 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
-//	@Param			postID	path		int			true	"Post ID"
-//	@Success		200		{object}	store.Post	"Post with comments"
-//	@Failure		404		{object}	string		"Post not found"
-//	@Failure		500		{object}	string		"Internal Server Error"
+//	@Param			postID	path		int				true	"Post ID"
+//	@Success		200		{object}	PostV1Response	"Post with comments"
+//	@Failure		404		{object}	Problem			"Post not found"
+//	@Failure		500		{object}	Problem			"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{postID} [get]
 func (app *application) getPostsHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
 	// Get comments
-	comments, err := app.store.Comment.GetByPostID(r.Context(), post.ID)
+	comments, err := app.store.Comment.GetByPostID(r.Context(), post.ID, getUserFromCtx(r).ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 	post.Comments = comments
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, presentPost(r, *post)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -121,8 +168,8 @@ func (app *application) getPostsHandler(w http.ResponseWriter, r *http.Request)
 //	@Produce		json
 //	@Param			postID	path		int		true	"Post ID"
 //	@Success		204		{object}	nil		"No content"
-//	@Failure		404		{object}	string	"Post not found"
-//	@Failure		500		{object}	string	"Internal Server Error"
+//	@Failure		404		{object}	Problem	"Post not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{postID} [delete]
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -149,16 +196,18 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 // updatePostHandler godoc
 //
 //	@Summary		Update a post
-//	@Description	Updates a post's title and/or content
+//	@Description	Updates a post's title and/or content, the edited post is screened like a new one
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			postID	path		int					true	"Post ID"
 //	@Param			request	body		UpdatePostPayload	true	"Post update data"
-//	@Success		200		{object}	store.Post			"Updated post"
-//	@Failure		400		{object}	string				"Invalid request payload"
-//	@Failure		404		{object}	string				"Post not found"
-//	@Failure		500		{object}	string				"Internal Server Error"
+//	@Success		200		{object}	PostV1Response		"Updated post"
+//	@Success		202		{object}	PostV1Response		"Post held for review"
+//	@Failure		400		{object}	Problem				"Invalid request payload"
+//	@Failure		404		{object}	Problem				"Post not found"
+//	@Failure		422		{object}	Problem				"Content rejected by the filters"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{postID} [patch]
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -175,12 +224,44 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// the edited post is screened like a new one
+	if payload.Title != nil {
+		post.Title = *payload.Title
+	}
 	if payload.Content != nil {
 		post.Content = *payload.Content
 	}
+	screened := &moderation.Content{Kind: moderation.KindPost, ID: post.ID, UserID: post.UserID, Title: post.Title, Body: post.Content}
+	result := app.screenContent(r.Context(), screened)
+	if result.Verdict == moderation.Reject {
+		app.recordFilterDecisions(r.Context(), screened, post.ID, result)
+		app.contentRejectedResponse(w, r, result.Reason())
+		return
+	}
+	if result.Verdict == moderation.Hold {
+		post.Hold = result.Reason()
+	}
 
-	if payload.Title != nil {
-		post.Title = *payload.Title
+	// the tags are the explicit ones plus the hashtags of the content, so the
+	// hashtags removed by the edit are dropped
+	if payload.Tags != nil || payload.Content != nil {
+		tags := content.RemoveTags(post.Tags, post.Entities.Hashtags())
+		if payload.Tags != nil {
+			tags = *payload.Tags
+		}
+		if payload.Content != nil {
+			entities, err := app.processContent(r.Context(), post.UserID, *payload.Content)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			post.Entities = entities
+		}
+		post.Tags = content.MergeTags(tags, post.Entities.Hashtags())
+	}
+
+	if payload.Locale != nil {
+		post.Locale = *payload.Locale
 	}
 
 	if err := app.store.Post.Update(r.Context(), post); err != nil {
@@ -192,8 +273,14 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+	app.recordFilterDecisions(r.Context(), screened, post.ID, result)
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	// a held post is hidden again until a moderator reviews it
+	status := http.StatusOK
+	if post.Hold != "" {
+		status = http.StatusAccepted
+	}
+	if err := app.jsonResponse(w, status, presentPost(r, *post)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -208,41 +295,97 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 //	@Produce		json
 //	@Param			postID	path		int								true	"Post ID"
 //	@Param			request	body		CreateCommentForPostPayload		true	"Comment creation data"
+//	@Param			Idempotency-Key	header	string	false	"Key making the request safe to retry"
 //	@Success		201		{object}	CreateCommentForPostResponse	"Created comment"
-//	@Failure		400		{object}	string							"Invalid request payload"
-//	@Failure		404		{object}	string							"Post not found"
-//	@Failure		500		{object}	string							"Internal Server Error"
+//	@Success		202		{object}	CreateCommentForPostResponse	"Comment held for review"
+//	@Failure		400		{object}	Problem							"Invalid request payload"
+//	@Failure		403		{object}	Problem							"Blocked by the post owner"
+//	@Failure		404		{object}	Problem							"Post not found"
+//	@Failure		422		{object}	Problem							"Content rejected by the filters"
+//	@Failure		500		{object}	Problem							"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{postID}/comments [post]
 func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
-	var payload CreateCommentForPostPayload
-	if err := readJSON(w, r, &payload); err != nil {
+	// the clients written when the payload had the user_id of the author
+	// still send it, it is ignored: the author is the authenticated user
+	var body struct {
+		CreateCommentForPostPayload
+		UserID json.RawMessage `json:"user_id"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	payload := body.CreateCommentForPostPayload
 
 	if err := Validate.Struct(payload); err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
+	user := getUserFromCtx(r)
 	post := getPostFromCtx(r)
 
-	comment := store.Comment{PostID: post.ID, UserID: payload.UserID, Content: payload.Content}
-	if err := app.store.Comment.Create(r.Context(), &comment); err != nil {
+	screened := &moderation.Content{Kind: moderation.KindComment, UserID: user.ID, Body: payload.Content}
+	result := app.screenContent(r.Context(), screened)
+	if result.Verdict == moderation.Reject {
+		app.recordFilterDecisions(r.Context(), screened, 0, result)
+		app.contentRejectedResponse(w, r, result.Reason())
+		return
+	}
+
+	entities, err := app.processContent(r.Context(), user.ID, payload.Content)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	comment := store.Comment{PostID: post.ID, UserID: user.ID, Content: payload.Content, Entities: entities}
+	if result.Verdict == moderation.Hold {
+		comment.Hold = result.Reason()
+	}
+	if err := app.store.Comment.Create(r.Context(), &comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	comment.User = store.User{ID: user.ID, Username: user.Username}
 	res := CreateCommentForPostResponse{
 		ID:        comment.ID,
 		PostID:    comment.PostID,
 		UserID:    comment.UserID,
 		Content:   comment.Content,
+		Entities:  comment.Entities,
 		CreatedAt: comment.CreatedAt,
 	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, res); err != nil {
+	ctx := r.Context()
+	app.recordContent(screened)
+	app.recordFilterDecisions(ctx, screened, comment.ID, result)
+	if comment.Hold != "" {
+		if err := app.jsonResponse(w, http.StatusAccepted, presentComment(r, comment)); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.publish(ctx, stream.PostTopic(post.ID), stream.EventComment, res)
+	notification := store.Notification{
+		ActorID:   comment.UserID,
+		Type:      store.NotificationComment,
+		PostID:    &comment.PostID,
+		CommentID: &comment.ID,
+		Actor:     store.User{ID: comment.UserID},
+	}
+	app.publishNotification(ctx, notification, []int64{post.UserID})
+	notification.Type = store.NotificationMention
+	app.publishNotification(ctx, notification, comment.Entities.MentionedUserIDs())
+
+	if err := app.jsonResponse(w, http.StatusCreated, presentComment(r, comment)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -257,8 +400,22 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// the moderators see every post, to review the hidden ones and to
+		// moderate the posts of the accounts they cannot see
 		ctx := r.Context()
-		post, err := app.store.Post.GetByID(ctx, postID)
+		user := getUserFromCtx(r)
+		moderator, err := app.checkRolePrecedence(ctx, user, "moderator")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		var post *store.Post
+		if moderator {
+			post, err = app.store.Post.GetByIDForModeration(ctx, postID)
+		} else {
+			post, err = app.store.Post.GetByID(ctx, postID, user.ID)
+		}
 		if err != nil {
 			switch {
 			case errors.Is(err, store.ErrNotFound):
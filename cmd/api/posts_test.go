@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/longlnOff/social/internal/content"
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestCreateComment(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+
+	ctx := context.Background()
+	post := &store.Post{UserID: 2, Title: "hello", Content: "hello world"}
+	if err := app.store.Post.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should ignore the user_id sent by the client", func(t *testing.T) {
+		body := strings.NewReader(`{"user_id": 2, "content": "nice post"}`)
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/v1/posts/%d/comments", post.ID), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var res struct {
+			Data CreateCommentForPostResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Data.UserID != 1 {
+			t.Errorf("WANT the comment of user 1 BUT GOT user %d", res.Data.UserID)
+		}
+
+		comments, err := app.store.Comment.GetByPostID(ctx, post.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(comments) != 1 || comments[0].UserID != 1 {
+			t.Errorf("WANT a stored comment of user 1 BUT GOT %v", comments)
+		}
+	})
+}
+
+func TestPostVisibility(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+	ctx := context.Background()
+
+	newRequest := func(t *testing.T, method, url string, body io.Reader) *http.Request {
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+		return req
+	}
+	createPost := func(t *testing.T, post *store.Post) string {
+		if err := app.store.Post.Create(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("/v1/posts/%d", post.ID)
+	}
+
+	t.Run("should hide the posts of private accounts from non-followers", func(t *testing.T) {
+		if err := app.store.User.SetPrivacy(ctx, 2, true); err != nil {
+			t.Fatal(err)
+		}
+		url := createPost(t, &store.Post{UserID: 2})
+
+		rr := executeRequest(newRequest(t, http.MethodGet, url, nil), mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+		rr = executeRequest(newRequest(t, http.MethodPut, "/v1/users/2/follow", nil), mux)
+		checkResponseCode(t, http.StatusAccepted, rr.Code)
+		if err := app.store.Follower.ApproveRequest(ctx, 2, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		rr = executeRequest(newRequest(t, http.MethodGet, url, nil), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should hide the posts of users who blocked the viewer", func(t *testing.T) {
+		if err := app.store.Block.Block(ctx, 3, 1); err != nil {
+			t.Fatal(err)
+		}
+		url := createPost(t, &store.Post{UserID: 3})
+
+		rr := executeRequest(newRequest(t, http.MethodGet, url, nil), mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should not let blocked users follow", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodPut, "/v1/users/3/follow", nil), mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should let moderators edit the posts they cannot see", func(t *testing.T) {
+		if err := app.store.User.SetRole(ctx, 1, "moderator"); err != nil {
+			t.Fatal(err)
+		}
+		blocked := createPost(t, &store.Post{UserID: 3, Title: "hello"})
+		held := createPost(t, &store.Post{UserID: 4, Title: "hello", Hold: "spam"})
+
+		for _, url := range []string{blocked, held} {
+			body := strings.NewReader(`{"title": "moderated"}`)
+			rr := executeRequest(newRequest(t, http.MethodPatch, url, body), mux)
+			checkResponseCode(t, http.StatusOK, rr.Code)
+		}
+
+		// deleting the posts of others takes an admin
+		rr := executeRequest(newRequest(t, http.MethodDelete, blocked, nil), mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+		if err := app.store.User.SetRole(ctx, 1, "admin"); err != nil {
+			t.Fatal(err)
+		}
+		rr = executeRequest(newRequest(t, http.MethodDelete, blocked, nil), mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+}
+
+// countingRoleStore counts the lookups of the roles.
+type countingRoleStore struct {
+	store.MockRoleStore
+	lookups int
+}
+
+func (s *countingRoleStore) GetByName(ctx context.Context, name string) (*store.Role, error) {
+	s.lookups++
+	return s.MockRoleStore.GetByName(ctx, name)
+}
+
+func TestPostRoleLookups(t *testing.T) {
+	app := newTestApplication(t)
+	roles := &countingRoleStore{}
+	app.store.Role = roles
+	mux := app.routes()
+
+	post := &store.Post{UserID: 1, Title: "hello"}
+	if err := app.store.Post.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/v1/posts/%d", post.ID), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	}
+	if roles.lookups != 1 {
+		t.Errorf("WANT the moderator role looked up once BUT GOT %d lookups", roles.lookups)
+	}
+}
+
+func TestUpdatePostTags(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+	ctx := context.Background()
+
+	post := &store.Post{
+		UserID:   1,
+		Title:    "hello",
+		Content:  "hello #go",
+		Tags:     []string{"news", "go"},
+		Entities: content.Parse("hello #go"),
+	}
+	if err := app.store.Post.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(t *testing.T, payload string) []string {
+		req, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("/v1/posts/%d", post.ID), strings.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		saved, err := app.store.Post.GetByID(ctx, post.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return saved.Tags
+	}
+
+	t.Run("should drop the hashtags removed from the content", func(t *testing.T) {
+		tags := update(t, `{"content": "hello #gopher"}`)
+		if want := []string{"news", "gopher"}; !reflect.DeepEqual(tags, want) {
+			t.Errorf("WANT %v BUT GOT %v", want, tags)
+		}
+	})
+
+	t.Run("should replace the explicit tags", func(t *testing.T) {
+		tags := update(t, `{"tags": ["release"]}`)
+		if want := []string{"release", "gopher"}; !reflect.DeepEqual(tags, want) {
+			t.Errorf("WANT %v BUT GOT %v", want, tags)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/longlnOff/social/internal/media"
+	"github.com/longlnOff/social/internal/store"
+)
+
+// problemTypePrefix starts the type of every problem, followed by its code.
+const problemTypePrefix = "urn:gophersocial:problem:"
+
+// Problem is an error response, as described by RFC 7807. Code is the stable
+// machine code of the error, Errors the invalid fields of the request. The
+// members specific to a problem go in Extensions.
+type Problem struct {
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	Status     int            `json:"status"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Code       string         `json:"code"`
+	Errors     []FieldError   `json:"errors,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+// FieldError tells which rule a field of the request breaks.
+type FieldError struct {
+	Field  string `json:"field"`
+	Rule   string `json:"rule"`
+	Detail string `json:"detail"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	body, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+
+	members := map[string]any{}
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// problemCodes are the stable codes of the errors of the API, the clients
+// rely on them rather than on the messages. A code never changes once
+// published. The domain errors of the store have theirs in store.ErrorCode.
+var problemCodes = []struct {
+	err  error
+	code string
+}{
+	{errMissingAuthHeader, "missing_auth_header"},
+	{errInvalidAuthHeader, "invalid_auth_header"},
+	{errInvalidCredentials, "invalid_credentials"},
+	{errTokenRevoked, "token_revoked"},
+	{jwt.ErrTokenExpired, "token_expired"},
+	{jwt.ErrTokenMalformed, "invalid_token"},
+	{jwt.ErrTokenSignatureInvalid, "invalid_token"},
+	{errPermissionDenied, "permission_denied"},
+	{errSelfAdministration, "self_administration"},
+	{errUserAlreadyActive, "user_already_active"},
+	{errSelfRelationship, "self_relationship"},
+	{errSelfModeration, "self_moderation"},
+	{errAssigneeNotFound, "assignee_not_found"},
+	{errAssigneeNotModerator, "assignee_not_moderator"},
+	{errSuspendUntilPast, "invalid_suspend_until"},
+	{errInvalidSuspensionPeriod, "invalid_suspension_period"},
+	{errMissingParticipant, "missing_participant"},
+	{errTooManyStreamPosts, "too_many_stream_posts"},
+	{errInvalidSuggestionsLimit, "invalid_limit"},
+	{errInvalidTrendingWindow, "invalid_trending_window"},
+	{errRateLimited, "rate_limited"},
+	{errIdempotencyKeyTooLong, "idempotency_key_too_long"},
+	{errIdempotencyInFlight, "idempotency_key_in_use"},
+	{errIdempotencyMismatch, "idempotency_key_mismatch"},
+	{media.ErrTooLarge, "file_too_large"},
+	{media.ErrUnsupportedFormat, "unsupported_file_format"},
+}
+
+// statusCodes are the codes of the errors known by their status only.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnprocessableEntity:   "unprocessable_entity",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_error",
+}
+
+// newProblem describes err to the client. Only the messages of the known
+// errors are told, the others stay in the logs unless in development.
+func (app *application) newProblem(r *http.Request, status int, err error) Problem {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = "error"
+	}
+	problem := Problem{
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: middleware.GetReqID(r.Context()),
+	}
+	problem.Code, problem.Detail, problem.Errors = describeError(err, code)
+
+	if problem.Detail == "" && err != nil && status < http.StatusInternalServerError && app.configuration.Server.ENVIRONMENT == "development" {
+		problem.Detail = err.Error()
+	}
+	problem.Type = problemTypePrefix + problem.Code
+	return problem
+}
+
+// describeError returns the code, the detail and the invalid fields of err
+// when it is known, or else code and no detail.
+func describeError(err error, code string) (string, string, []FieldError) {
+	if err == nil {
+		return code, "", nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return "validation_failed", "the request has invalid fields", fieldErrors(validationErrors)
+	}
+
+	for _, known := range problemCodes {
+		if errors.Is(err, known.err) {
+			return known.code, known.err.Error(), nil
+		}
+	}
+	if domainCode, domainErr, ok := store.ErrorCode(err); ok {
+		return domainCode, domainErr.Error(), nil
+	}
+
+	if detail := decodeErrorDetail(err); detail != "" {
+		return "malformed_body", detail, nil
+	}
+	return code, "", nil
+}
+
+// decodeErrorDetail describes the errors of readJSON, they are about the
+// body sent by the client.
+func decodeErrorDetail(err error) string {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	var maxBytesError *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		return "the request body is empty"
+	case errors.As(err, &syntaxError), errors.Is(err, io.ErrUnexpectedEOF):
+		return "the request body is not valid JSON"
+	case errors.As(err, &typeError):
+		return fmt.Sprintf("%s must be of type %s", typeError.Field, typeError.Type)
+	case errors.As(err, &maxBytesError):
+		return fmt.Sprintf("the request body is larger than %d bytes", maxBytesError.Limit)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return "unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	}
+	return ""
+}
+
+func fieldErrors(validationErrors validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		// the namespace without the name of the payload
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		fields = append(fields, FieldError{
+			Field:  field,
+			Rule:   fe.Tag(),
+			Detail: ruleDetail(field, fe),
+		})
+	}
+	return fields
+}
+
+func ruleDetail(field string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "email":
+		return field + " must be an email address"
+	case "url":
+		return field + " must be a URL"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", field, strings.Join(strings.Fields(fe.Param()), ", "))
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, fe.Param())
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s", field, fe.Param())
+	case "len":
+		return fmt.Sprintf("%s must have a length of %s", field, fe.Param())
+	}
+	return fmt.Sprintf("%s breaks the %s rule", field, fe.Tag())
+}
+
+// writeProblem writes problem as application/problem+json.
+func writeProblem(w http.ResponseWriter, problem Problem) error {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+
+	return json.NewEncoder(w).Encode(problem)
+}
+
+func (app *application) problemResponse(w http.ResponseWriter, r *http.Request, status int, err error) {
+	writeProblem(w, app.newProblem(r, status, err))
+}
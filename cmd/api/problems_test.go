@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProblems(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+
+	t.Run("should describe the invalid fields", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(`{"title": "a", "tags": []}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+		req.Header.Set("X-Request-Id", "request-1")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		if got := rr.Header().Get("Content-Type"); got != "application/problem+json" {
+			t.Errorf("WANT application/problem+json BUT GOT %s", got)
+		}
+
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if problem.Code != "validation_failed" || problem.Type != problemTypePrefix+"validation_failed" {
+			t.Errorf("WANT validation_failed BUT GOT %s (%s)", problem.Code, problem.Type)
+		}
+		if problem.Instance != "request-1" {
+			t.Errorf("WANT the request ID as instance BUT GOT %q", problem.Instance)
+		}
+		fields := map[string]string{}
+		for _, field := range problem.Errors {
+			fields[field.Field] = field.Rule
+		}
+		if fields["title"] != "min" || fields["content"] != "required" {
+			t.Errorf("WANT title and content invalid BUT GOT %v", problem.Errors)
+		}
+	})
+
+	t.Run("should give the stable code of the known errors", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if problem.Code != "missing_auth_header" || problem.Detail != errMissingAuthHeader.Error() {
+			t.Errorf("WANT missing_auth_header BUT GOT %s: %s", problem.Code, problem.Detail)
+		}
+	})
+
+	t.Run("should not leak the internal errors", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		leak := errors.New(`pq: duplicate key value violates unique constraint "users_pkey"`)
+
+		for _, status := range []int{http.StatusBadRequest, http.StatusInternalServerError} {
+			problem := app.newProblem(req, status, leak)
+			if problem.Detail != "" {
+				t.Errorf("WANT no detail BUT GOT %q", problem.Detail)
+			}
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/longlnOff/social/cmd/configuration"
+	"github.com/longlnOff/social/internal/ratelimit"
+	"github.com/longlnOff/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Route groups having their own rate limit.
+const (
+	rateLimitGlobal = "global"
+	rateLimitAuth   = "auth"
+	rateLimitWrite  = "write"
+)
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// newRateLimits parses the limit of every route group.
+func newRateLimits(cfg configuration.RateLimitConfiguration) (map[string]ratelimit.Rule, error) {
+	limits := map[string]string{
+		rateLimitGlobal: cfg.RATE_LIMIT_GLOBAL,
+		rateLimitAuth:   cfg.RATE_LIMIT_AUTH,
+		rateLimitWrite:  cfg.RATE_LIMIT_WRITE,
+	}
+
+	rules := make(map[string]ratelimit.Rule, len(limits))
+	for group, limit := range limits {
+		rule, err := ratelimit.ParseRule(limit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", group, err)
+		}
+		rules[group] = rule
+	}
+	return rules, nil
+}
+
+// rateLimit limits the requests of every client to the route group, and tells
+// them where they stand in the RateLimit-* headers. The requests go through
+// when the limiter fails.
+func (app *application) rateLimit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		rule, ok := app.rateLimits[group]
+		if app.limiter == nil || !ok || !rule.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := group + ":" + app.rateLimitKey(r, rule.Key)
+			result, err := app.limiter.Allow(r.Context(), key, rule)
+			if err != nil {
+				app.loggerFor(r.Context()).Error("Rate limiter failed:", zap.String("group", group), zap.String("error", err.Error()))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", rule.Policy())
+			h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", seconds(result.Reset))
+			if !result.Allowed {
+				h.Set("Retry-After", seconds(result.RetryAfter))
+				app.tooManyRequestsResponse(w, r, errRateLimited)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the client by the kind of key of the rule. The
+// clients without a user or a known API key are identified by their IP. The
+// user is only known behind AuthTokenMiddleware, so a user key must be
+// limited after it.
+func (app *application) rateLimitKey(r *http.Request, kind string) string {
+	switch kind {
+	case ratelimit.KeyUser:
+		if user, ok := r.Context().Value(Userctx).(*store.User); ok {
+			return "user:" + strconv.FormatInt(user.ID, 10)
+		}
+	case ratelimit.KeyAPIKey:
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" && app.isAPIKey(apiKey) {
+			hash := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(hash[:])
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// isAPIKey tells if apiKey is one of the issued keys, any other key could be
+// made up to get a fresh limit.
+func (app *application) isAPIKey(apiKey string) bool {
+	for _, key := range app.configuration.RateLimit.RATE_LIMIT_API_KEYS {
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// seconds rounds d up to whole seconds for the headers.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/longlnOff/social/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	limiter, err := ratelimit.NewMemoryLimiter(ratelimit.SlidingWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.limiter = limiter
+	app.rateLimits = map[string]ratelimit.Rule{
+		rateLimitAuth: {Key: ratelimit.KeyIP, Requests: 1, Window: time.Hour},
+	}
+	mux := app.routes()
+
+	newRequest := func() *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	t.Run("should tell the client what is left", func(t *testing.T) {
+		rr := executeRequest(newRequest(), mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		if got := rr.Header().Get("RateLimit-Remaining"); got != "0" {
+			t.Errorf("WANT 0 remaining BUT GOT %q", got)
+		}
+	})
+
+	t.Run("should refuse the requests past the limit", func(t *testing.T) {
+		rr := executeRequest(newRequest(), mux)
+		checkResponseCode(t, http.StatusTooManyRequests, rr.Code)
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("WANT a Retry-After header")
+		}
+	})
+}
+
+func TestRateLimitKey(t *testing.T) {
+	app := newTestApplication(t)
+	app.configuration.RateLimit.RATE_LIMIT_API_KEYS = []string{"issued"}
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.trustedProxies = proxies
+
+	keyOf := func(remoteAddr string, header http.Header, kind string) string {
+		req, err := http.NewRequest(http.MethodGet, "/v1/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = remoteAddr
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		var key string
+		app.realIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key = app.rateLimitKey(r, kind)
+		})).ServeHTTP(nil, req)
+		return key
+	}
+
+	t.Run("should ignore the forwarded IP of untrusted clients", func(t *testing.T) {
+		header := http.Header{"X-Forwarded-For": {"203.0.113.7"}, "X-Real-Ip": {"203.0.113.8"}}
+		if got := keyOf("198.51.100.1:4000", header, ratelimit.KeyIP); got != "ip:198.51.100.1" {
+			t.Errorf("WANT ip:198.51.100.1 BUT GOT %s", got)
+		}
+	})
+
+	t.Run("should use the IP forwarded by the trusted proxies", func(t *testing.T) {
+		header := http.Header{"X-Forwarded-For": {"198.51.100.9, 203.0.113.7, 10.0.0.2"}}
+		if got := keyOf("10.0.0.1:4000", header, ratelimit.KeyIP); got != "ip:203.0.113.7" {
+			t.Errorf("WANT ip:203.0.113.7 BUT GOT %s", got)
+		}
+	})
+
+	t.Run("should only key on the issued API keys", func(t *testing.T) {
+		unknown := keyOf("198.51.100.1:4000", http.Header{"X-Api-Key": {"made-up"}}, ratelimit.KeyAPIKey)
+		if unknown != "ip:198.51.100.1" {
+			t.Errorf("WANT ip:198.51.100.1 BUT GOT %s", unknown)
+		}
+		issued := keyOf("198.51.100.1:4000", http.Header{"X-Api-Key": {"issued"}}, ratelimit.KeyAPIKey)
+		if !strings.HasPrefix(issued, "key:") {
+			t.Errorf("WANT an API key BUT GOT %s", issued)
+		}
+	})
+
+	t.Run("should fall back to the IP before the authentication", func(t *testing.T) {
+		if got := keyOf("198.51.100.1:4000", nil, ratelimit.KeyUser); got != "ip:198.51.100.1" {
+			t.Errorf("WANT ip:198.51.100.1 BUT GOT %s", got)
+		}
+	})
+}
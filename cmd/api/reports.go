@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/longlnOff/social/internal/store"
+)
+
+var (
+	errSelfModeration       = errors.New("moderators cannot resolve the cases about themselves")
+	errAssigneeNotFound     = errors.New("assignee not found")
+	errAssigneeNotModerator = errors.New("assignee is not a moderator")
+	errSuspendUntilPast     = errors.New("suspend_until must be in the future")
+)
+
+type CaseCTX string
+
+var Casectx CaseCTX = "case"
+
+type CreateReportPayload struct {
+	TargetType string `json:"target_type" validate:"required,oneof=post comment user"`
+	TargetID   int64  `json:"target_id" validate:"required,gte=1"`
+	Reason     string `json:"reason" validate:"required,oneof=spam harassment hate_speech violence nudity misinformation self_harm impersonation other"`
+	Note       string `json:"note" validate:"max=1000"`
+}
+
+type AssignCasePayload struct {
+	// AssigneeID is the moderator in charge of the case, zero for yourself.
+	AssigneeID int64 `json:"assignee_id" validate:"gte=0"`
+}
+
+type ResolveCasePayload struct {
+	Action string `json:"action" validate:"required,oneof=hide warn suspend dismiss"`
+	Note   string `json:"note" validate:"max=1000"`
+	// SuspendUntil ends the suspension of the suspend action, which is
+	// permanent without it.
+	SuspendUntil *time.Time `json:"suspend_until"`
+}
+
+// createReportHandler godoc
+//
+//	@Summary		Report content
+//	@Description	Reports a post, a comment or a user to the moderators. The reports about the same content are gathered in one case
+//	@Tags			reports
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateReportPayload	true	"Report"
+//	@Success		201		{object}	store.Report
+//	@Failure		400		{object}	Problem	"Invalid report, or own content"
+//	@Failure		404		{object}	Problem	"Content not found"
+//	@Failure		409		{object}	Problem	"Content already reported"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/reports [post]
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report := store.Report{
+		ReporterID: getUserFromCtx(r).ID,
+		TargetType: payload.TargetType,
+		TargetID:   payload.TargetID,
+		Reason:     payload.Reason,
+		Note:       payload.Note,
+	}
+	if err := app.store.Report.Create(r.Context(), &report); err != nil {
+		switch {
+		case errors.Is(err, store.ErrSelfReport):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, report); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getModerationCasesHandler godoc
+//
+//	@Summary		List moderation cases
+//	@Description	Lists the moderation queue, newest cases first
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			status		query		string	false	"Status"		Enums(open, in_review, actioned, dismissed)
+//	@Param			target_type	query		string	false	"Target type"	Enums(post, comment, user)
+//	@Param			assignee_id	query		int		false	"Assigned moderator"
+//	@Param			limit		query		int		false	"Limit"	default(20)
+//	@Param			before		query		int		false	"ID of the last case of the previous page"
+//	@Success		200			{array}		store.ModerationCase
+//	@Failure		400			{object}	Problem	"Invalid query"
+//	@Failure		403			{object}	Problem	"Not a moderator"
+//	@Failure		500			{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/cases [get]
+func (app *application) getModerationCasesHandler(w http.ResponseWriter, r *http.Request) {
+	p := store.PaginatedCases{Limit: 20}
+	p, err := p.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(p); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	cases, err := app.store.Report.GetCases(r.Context(), p)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, cases); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getModerationCaseHandler godoc
+//
+//	@Summary		Get a moderation case
+//	@Description	Retrieves a moderation case along with its reports
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			caseID	path		int	true	"Case ID"
+//	@Success		200		{object}	store.ModerationCase
+//	@Failure		403		{object}	Problem	"Not a moderator"
+//	@Failure		404		{object}	Problem	"Case not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/cases/{caseID} [get]
+func (app *application) getModerationCaseHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getCaseFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// assignModerationCaseHandler godoc
+//
+//	@Summary		Assign a moderation case
+//	@Description	Puts the case in review by a moderator, yourself unless told otherwise
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			caseID	path		int					true	"Case ID"
+//	@Param			request	body		AssignCasePayload	true	"Assignee"
+//	@Success		204		{object}	nil					"No content"
+//	@Failure		400		{object}	Problem				"Invalid assignee"
+//	@Failure		403		{object}	Problem				"Not a moderator"
+//	@Failure		404		{object}	Problem				"Case not found"
+//	@Failure		409		{object}	Problem				"Case already resolved"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/cases/{caseID}/assign [put]
+func (app *application) assignModerationCaseHandler(w http.ResponseWriter, r *http.Request) {
+	var payload AssignCasePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+	assigneeID := user.ID
+	if payload.AssigneeID != 0 && payload.AssigneeID != user.ID {
+		assignee, err := app.store.User.GetByUserID(ctx, payload.AssigneeID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.badRequestResponse(w, r, errAssigneeNotFound)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(ctx, assignee, "moderator")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.badRequestResponse(w, r, errAssigneeNotModerator)
+			return
+		}
+		assigneeID = assignee.ID
+	}
+
+	c := getCaseFromCtx(r)
+	if err := app.store.Report.Assign(ctx, c.ID, assigneeID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrCaseResolved):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.recordAudit(r, store.AuditEvent{
+		Action:     "moderation.case_assigned",
+		TargetType: c.TargetType,
+		TargetID:   c.TargetID,
+		Details:    map[string]any{"case_id": c.ID, "assignee_id": assigneeID},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resolveModerationCaseHandler godoc
+//
+//	@Summary		Resolve a moderation case
+//	@Description	Hides the content, warns or suspends its author, or dismisses the case. The reporters are notified of the outcome
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			caseID	path		int					true	"Case ID"
+//	@Param			request	body		ResolveCasePayload	true	"Action"
+//	@Success		200		{object}	store.ModerationCase
+//	@Failure		400		{object}	Problem	"Invalid action"
+//	@Failure		403		{object}	Problem	"Not a moderator, or a case about yourself or a higher role"
+//	@Failure		404		{object}	Problem	"Case not found"
+//	@Failure		409		{object}	Problem	"Case already resolved"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/cases/{caseID}/resolve [post]
+func (app *application) resolveModerationCaseHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResolveCasePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.SuspendUntil != nil && !payload.SuspendUntil.After(time.Now()) {
+		app.badRequestResponse(w, r, errSuspendUntilPast)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+	c := getCaseFromCtx(r)
+	if c.TargetUserID == user.ID {
+		app.forbiddenErrorResponse(w, r, errSelfModeration)
+		return
+	}
+
+	// moderators cannot suspend their peers nor their superiors
+	if payload.Action == store.ModerationSuspend {
+		target, err := app.store.User.GetByUserID(ctx, c.TargetUserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if target.Role.Level >= user.Role.Level {
+			app.forbiddenErrorResponse(w, r, errPermissionDenied)
+			return
+		}
+	}
+
+	resolution := store.CaseResolution{
+		ModeratorID:  user.ID,
+		Action:       payload.Action,
+		Note:         payload.Note,
+		SuspendUntil: payload.SuspendUntil,
+	}
+	resolved, err := app.store.Report.Resolve(ctx, c.ID, resolution)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidModerationAction):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrCaseResolved):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.recordAudit(r, store.AuditEvent{
+		Action:     "moderation.case_resolved",
+		TargetType: c.TargetType,
+		TargetID:   c.TargetID,
+		Before:     map[string]any{"status": c.Status},
+		After:      map[string]any{"status": resolved.Status, "action": resolved.Action},
+		Details:    map[string]any{"case_id": c.ID, "target_user_id": c.TargetUserID, "note": payload.Note},
+	})
+	if payload.Action == store.ModerationSuspend {
+		if err := app.invalidateUser(ctx, c.TargetUserID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, resolved); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) caseContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caseID, err := strconv.ParseInt(chi.URLParam(r, "caseID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		c, err := app.store.Report.GetCase(ctx, caseID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, Casectx, c)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCaseFromCtx(r *http.Request) *store.ModerationCase {
+	return r.Context().Value(Casectx).(*store.ModerationCase)
+}
+
+// getFilterDecisionsHandler godoc
+//
+//	@Summary		List content filter decisions
+//	@Description	Lists the holds and rejections of the content filters, newest first
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			user_id	query		int		false	"Author of the content"
+//	@Param			limit	query		int		false	"Limit"	default(20)
+//	@Param			before	query		int		false	"ID of the last decision of the previous page"
+//	@Success		200		{array}		store.FilterDecision
+//	@Failure		400		{object}	Problem	"Invalid query"
+//	@Failure		403		{object}	Problem	"Not a moderator"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/decisions [get]
+func (app *application) getFilterDecisionsHandler(w http.ResponseWriter, r *http.Request) {
+	p := store.PaginatedKeyset{Limit: 20}
+	p, err := p.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(p); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var userID int64
+	if param := r.URL.Query().Get("user_id"); param != "" {
+		userID, err = strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	decisions, err := app.store.FilterDecision.Get(r.Context(), userID, p)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, decisions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
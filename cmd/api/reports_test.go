@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReports(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+
+	t.Run("should reject an unknown reason", func(t *testing.T) {
+		body := strings.NewReader(`{"target_type": "post", "target_id": 1, "reason": "boring"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/reports", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should not allow users below moderator in the queue", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/moderation/cases", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/longlnOff/social/internal/store"
+	"github.com/longlnOff/social/internal/stream"
+	"go.uber.org/zap"
+)
+
+const (
+	// maximum number of posts a connection can watch for comments
+	maxStreamPosts         = 20
+	streamWriteTimeout     = 10 * time.Second
+	defaultStreamHeartbeat = 15 * time.Second
+)
+
+var errTooManyStreamPosts = fmt.Errorf("at most %d posts can be watched", maxStreamPosts)
+
+// streamHandler godoc
+//
+//	@Summary		Stream events
+//	@Description	Pushes new feed items, notifications and comments on the watched posts as Server-Sent Events
+//	@Tags			stream
+//	@Produce		text/event-stream
+//	@Param			posts			query		string	false	"Comma separated IDs of the posts to watch for comments"
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received, to resume the stream"
+//	@Success		200				{string}	string	"Event stream"
+//	@Failure		400				{object}	Problem	"Invalid posts parameter"
+//	@Failure		404				{object}	Problem	"Post not found"
+//	@Failure		500				{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/stream [get]
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.internalServerError(w, r, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	sub, ok := app.subscribe(w, r, lastEventID)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	// the stream outlives the timeouts of the server, every write gets its
+	// own deadline instead
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		app.loggerFor(r.Context()).Warn("Failed to clear stream read deadline:", zap.String("error", err.Error()))
+	}
+	rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(app.streamHeartbeat())
+	defer heartbeat.Stop()
+
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.shutdown:
+			// the client reconnects to another replica with its last event ID
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			fmt.Fprint(w, "event: shutdown\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if !ok {
+				// the client is too slow, it has to reconnect with its last event ID
+				if sub.Overflowed() {
+					fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// streamWebSocketHandler godoc
+//
+//	@Summary		Stream events over WebSocket
+//	@Description	Pushes the same events as /stream as JSON messages over a WebSocket connection
+//	@Tags			stream
+//	@Param			posts			query		string	false	"Comma separated IDs of the posts to watch for comments"
+//	@Param			last_event_id	query		string	false	"ID of the last event received, to resume the stream"
+//	@Success		101				{string}	string	"Switching protocols"
+//	@Failure		400				{object}	Problem	"Invalid posts parameter"
+//	@Failure		404				{object}	Problem	"Post not found"
+//	@Failure		500				{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/stream/ws [get]
+func (app *application) streamWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := app.subscribe(w, r, r.URL.Query().Get("last_event_id"))
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	// the connection outlives the timeouts of the server, the writes have
+	// their own timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		app.loggerFor(r.Context()).Warn("Failed to clear websocket read deadline:", zap.String("error", err.Error()))
+	}
+	rc.SetWriteDeadline(time.Time{})
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		app.loggerFor(r.Context()).Warn("Websocket upgrade failed:", zap.String("error", err.Error()))
+		return
+	}
+	defer conn.CloseNow()
+
+	// nothing is expected from the client, this only handles control frames
+	ctx := conn.CloseRead(r.Context())
+
+	heartbeat := time.NewTicker(app.streamHeartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.shutdown:
+			conn.Close(websocket.StatusGoingAway, "shutdown")
+			return
+		case <-heartbeat.C:
+			pingCtx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Overflowed() {
+					conn.Close(websocket.StatusTryAgainLater, "overflow")
+				}
+				return
+			}
+			writeCtx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := wsjson.Write(writeCtx, conn, event)
+			cancel()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (app *application) streamHeartbeat() time.Duration {
+	if app.configuration.Stream.STREAM_HEARTBEAT <= 0 {
+		return defaultStreamHeartbeat
+	}
+	return app.configuration.Stream.STREAM_HEARTBEAT
+}
+
+// subscribe subscribes the authenticated user to its own topic and to the
+// comments of the posts listed in the posts query parameter. The posts the
+// user cannot see are not found.
+func (app *application) subscribe(w http.ResponseWriter, r *http.Request, lastEventID string) (*stream.Subscription, bool) {
+	user := getUserFromCtx(r)
+	topics := []string{stream.UserTopic(user.ID)}
+
+	if posts := r.URL.Query().Get("posts"); posts != "" {
+		postIDs := strings.Split(posts, ",")
+		if len(postIDs) > maxStreamPosts {
+			app.badRequestResponse(w, r, errTooManyStreamPosts)
+			return nil, false
+		}
+		for _, idParam := range postIDs {
+			postID, err := strconv.ParseInt(idParam, 10, 64)
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return nil, false
+			}
+			if _, err := app.store.Post.GetByID(r.Context(), postID, user.ID); err != nil {
+				switch {
+				case errors.Is(err, store.ErrNotFound):
+					app.notFoundResponse(w, r, err)
+				default:
+					app.internalServerError(w, r, err)
+				}
+				return nil, false
+			}
+			topics = append(topics, stream.PostTopic(postID))
+		}
+	}
+
+	sub, err := app.broker.Subscribe(r.Context(), topics, lastEventID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	return sub, true
+}
+
+// publish pushes an event to the stream. Failures are only logged since the
+// change the event reports on is already stored.
+func (app *application) publish(ctx context.Context, topic string, eventType string, data any) {
+	if err := app.broker.Publish(ctx, topic, eventType, data); err != nil {
+		app.loggerFor(ctx).Error("Error publishing event:", zap.String("error", err.Error()), zap.String("topic", topic))
+	}
+}
+
+// publishFeedItem pushes a new post to the author and its followers, except
+// the ones who muted the author. It runs apart from the request, the author
+// may have many followers.
+func (app *application) publishFeedItem(ctx context.Context, post *store.Post) {
+	ctx = context.WithoutCancel(ctx)
+	item := *post
+	app.background(func() {
+		followerIDs, err := app.store.Follower.GetFollowerIDs(ctx, item.UserID)
+		if err != nil {
+			app.loggerFor(ctx).Error("Error getting followers:", zap.String("error", err.Error()), zap.Int64("user_id", item.UserID))
+			return
+		}
+
+		for _, userID := range followerIDs {
+			app.publish(ctx, stream.UserTopic(userID), stream.EventFeed, item)
+		}
+		app.publish(ctx, stream.UserTopic(item.UserID), stream.EventFeed, item)
+	})
+}
+
+// publishNotification pushes a notification to the recipients that want it,
+// apart from the request.
+func (app *application) publishNotification(ctx context.Context, notification store.Notification, recipients []int64) {
+	if len(recipients) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	app.background(func() {
+		userIDs, err := app.store.Notification.GetRecipients(ctx, notification, recipients)
+		if err != nil {
+			app.loggerFor(ctx).Error("Error getting notification recipients:", zap.String("error", err.Error()), zap.String("type", notification.Type))
+			return
+		}
+
+		for _, userID := range userIDs {
+			notification.UserID = userID
+			app.publish(ctx, stream.UserTopic(userID), stream.EventNotification, notification)
+		}
+	})
+}
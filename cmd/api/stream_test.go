@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/longlnOff/social/internal/store"
+	"github.com/longlnOff/social/internal/stream"
+)
+
+func TestStream(t *testing.T) {
+	app := newTestApplication(t)
+	server := httptest.NewServer(app.routes())
+	defer server.Close()
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/v1/stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("should push events of the user topic", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		app.broker.Publish(ctx, stream.UserTopic(1), stream.EventFeed, store.Post{ID: 42})
+
+		reader := bufio.NewReader(res.Body)
+		var lines []string
+		for len(lines) < 3 {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, strings.TrimSpace(line))
+		}
+
+		if lines[1] != "event: feed" || !strings.Contains(lines[2], `"id":42`) {
+			t.Errorf("WANT a feed event for post 42 BUT GOT %v", lines)
+		}
+	})
+
+	t.Run("should not watch the posts the user cannot see", func(t *testing.T) {
+		ctx := context.Background()
+		// user 2 has a private account, user 3 blocked user 1
+		if err := app.store.User.SetPrivacy(ctx, 2, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.store.Block.Block(ctx, 3, 1); err != nil {
+			t.Fatal(err)
+		}
+		private := &store.Post{UserID: 2}
+		blocked := &store.Post{UserID: 3}
+		for _, post := range []*store.Post{private, blocked} {
+			if err := app.store.Post.Create(ctx, post); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, post := range []*store.Post{private, blocked} {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/stream?posts=%d", server.URL, post.ID), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer 123")
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			checkResponseCode(t, http.StatusNotFound, res.StatusCode)
+		}
+	})
+
+	t.Run("should watch the posts the user can see", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		post := &store.Post{UserID: 4}
+		if err := app.store.Post.Create(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/stream?posts=%d", server.URL, post.ID), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+	})
+}
+
+func TestPublishFeedItem(t *testing.T) {
+	app := newTestApplication(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// users 2 and 3 follow user 1, user 2 muted it
+	for _, followerID := range []int64{2, 3} {
+		if _, err := app.store.Follower.Follow(ctx, followerID, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := app.store.Block.Mute(ctx, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	muted, err := app.broker.Subscribe(ctx, []string{stream.UserTopic(2)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer muted.Close()
+	following, err := app.broker.Subscribe(ctx, []string{stream.UserTopic(3)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer following.Close()
+
+	app.publishFeedItem(ctx, &store.Post{ID: 42, UserID: 1})
+	app.jobs.Wait()
+
+	select {
+	case event := <-following.Events():
+		if event.Type != stream.EventFeed {
+			t.Errorf("WANT a feed event BUT GOT %s", event.Type)
+		}
+	default:
+		t.Error("WANT a feed event for the follower BUT GOT none")
+	}
+	select {
+	case event := <-muted.Events():
+		t.Errorf("WANT no event for the follower who muted the author BUT GOT %v", event)
+	default:
+	}
+}
+
+func TestPublishNotification(t *testing.T) {
+	app := newTestApplication(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// user 2 muted user 1
+	if err := app.store.Block.Mute(ctx, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	muted, err := app.broker.Subscribe(ctx, []string{stream.UserTopic(2)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer muted.Close()
+	mentioned, err := app.broker.Subscribe(ctx, []string{stream.UserTopic(3)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mentioned.Close()
+
+	app.publishNotification(ctx, store.Notification{ActorID: 1, Type: store.NotificationMention}, []int64{1, 2, 3})
+	app.jobs.Wait()
+
+	select {
+	case event := <-mentioned.Events():
+		if event.Type != stream.EventNotification {
+			t.Errorf("WANT a notification event BUT GOT %s", event.Type)
+		}
+	default:
+		t.Error("WANT a notification for the mentioned user BUT GOT none")
+	}
+	select {
+	case event := <-muted.Events():
+		t.Errorf("WANT no notification for the user who muted the actor BUT GOT %v", event)
+	default:
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/longlnOff/social/internal/store"
+	"go.uber.org/zap"
+)
+
+const maxSuggestions = 50
+
+var errInvalidSuggestionsLimit = errors.New("limit must be between 1 and 50")
+
+// getSuggestionsHandler godoc
+//
+//	@Summary		Who to follow
+//	@Description	Recommends accounts to follow, from the accounts followed by the people the authenticated user follows
+//	@Tags			users,follows
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int					false	"Limit number of results"	default(20)
+//	@Success		200		{array}		store.Suggestion	"Suggested accounts"
+//	@Failure		400		{object}	Problem				"Invalid limit"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/suggestions [get]
+func (app *application) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if param := r.URL.Query().Get("limit"); param != "" {
+		value, err := strconv.Atoi(param)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		limit = value
+	}
+	if limit < 1 || limit > maxSuggestions {
+		app.badRequestResponse(w, r, errInvalidSuggestionsLimit)
+		return
+	}
+
+	suggestions, err := app.getSuggestions(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getSuggestions reads the suggestions of a user through the cache.
+func (app *application) getSuggestions(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	if !app.configuration.Cache.CACHE_ENABLED {
+		return app.store.Suggestion.GetByUserID(ctx, userID, maxSuggestions)
+	}
+
+	suggestions, err := app.cacheStore.Suggestion.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if suggestions != nil {
+		return suggestions, nil
+	}
+
+	suggestions, err = app.store.Suggestion.GetByUserID(ctx, userID, maxSuggestions)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.cacheStore.Suggestion.Set(ctx, userID, suggestions); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// invalidateSuggestions drops the cached suggestions of a user once they no
+// longer hold, like after a follow or a block. Failing is only logged, the
+// cache expires anyway.
+func (app *application) invalidateSuggestions(ctx context.Context, userID int64) {
+	if !app.configuration.Cache.CACHE_ENABLED {
+		return
+	}
+	if err := app.cacheStore.Suggestion.Delete(ctx, userID); err != nil {
+		app.loggerFor(ctx).Error("Error invalidating suggestions:", zap.String("error", err.Error()), zap.Int64("user_id", userID))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestSuggestions(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+	ctx := context.Background()
+
+	// user 1 follows user 2, who follows users 3 and 4
+	for _, follow := range [][2]int64{{1, 2}, {2, 3}, {2, 4}} {
+		if _, err := app.store.Follower.Follow(ctx, follow[0], follow[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	getSuggestions := func(t *testing.T) []store.Suggestion {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/suggestions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data []store.Suggestion `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res.Data
+	}
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/suggestions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should suggest the accounts followed by the followed accounts", func(t *testing.T) {
+		suggestions := getSuggestions(t)
+		if len(suggestions) != 2 || suggestions[0].User.ID != 3 || suggestions[1].User.ID != 4 {
+			t.Errorf("WANT users 3 and 4 BUT GOT %v", suggestions)
+		}
+	})
+
+	t.Run("should not suggest the accounts that blocked the user", func(t *testing.T) {
+		if err := app.store.Block.Block(ctx, 3, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		suggestions := getSuggestions(t)
+		if len(suggestions) != 1 || suggestions[0].User.ID != 4 {
+			t.Errorf("WANT user 4 BUT GOT %v", suggestions)
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/longlnOff/social/internal/store"
+)
+
+var errInvalidSuspensionPeriod = errors.New("ends_at must be after starts_at and in the future")
+
+type CreateSuspensionPayload struct {
+	Kind   string `json:"kind" validate:"required,oneof=suspension read_only"`
+	Reason string `json:"reason" validate:"required,max=1000"`
+	// StartsAt defaults to now.
+	StartsAt *time.Time `json:"starts_at"`
+	// EndsAt is the end of the suspension, which is permanent without it.
+	EndsAt *time.Time `json:"ends_at"`
+}
+
+// adminGetSuspensionsHandler godoc
+//
+//	@Summary		List the suspensions of a user
+//	@Description	Lists every suspension and read-only restriction of the user, newest first
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{array}		store.Suspension
+//	@Failure		403		{object}	Problem	"Not an administrator"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/suspensions [get]
+func (app *application) adminGetSuspensionsHandler(w http.ResponseWriter, r *http.Request) {
+	suspensions, err := app.store.Suspension.GetByUserID(r.Context(), getTargetFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, suspensions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// adminSuspendUserHandler godoc
+//
+//	@Summary		Suspend a user
+//	@Description	Suspends the user, or restricts the user to read-only, until the given time or for good
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int						true	"User ID"
+//	@Param			request	body		CreateSuspensionPayload	true	"Suspension"
+//	@Success		201		{object}	store.Suspension
+//	@Failure		400		{object}	Problem	"Invalid suspension"
+//	@Failure		403		{object}	Problem	"Not an administrator, or own account"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/suspensions [post]
+func (app *application) adminSuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateSuspensionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	startsAt := now
+	if payload.StartsAt != nil {
+		startsAt = *payload.StartsAt
+	}
+	if payload.EndsAt != nil && (!payload.EndsAt.After(startsAt) || !payload.EndsAt.After(now)) {
+		app.badRequestResponse(w, r, errInvalidSuspensionPeriod)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	target := getTargetFromCtx(r)
+	if target.ID == user.ID {
+		app.forbiddenErrorResponse(w, r, errSelfAdministration)
+		return
+	}
+
+	ctx := r.Context()
+	suspension := store.Suspension{
+		UserID:   target.ID,
+		Kind:     payload.Kind,
+		Reason:   payload.Reason,
+		StartsAt: startsAt,
+		EndsAt:   payload.EndsAt,
+		IssuedBy: &user.ID,
+	}
+	if err := app.store.Suspension.Create(ctx, &suspension); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.recordAudit(r, store.AuditEvent{
+		Action:     "user.suspended",
+		TargetType: "user",
+		TargetID:   target.ID,
+		Details: map[string]any{
+			"suspension_id": suspension.ID,
+			"kind":          suspension.Kind,
+			"reason":        suspension.Reason,
+			"starts_at":     suspension.StartsAt,
+			"ends_at":       suspension.EndsAt,
+		},
+	})
+	if err := app.invalidateUser(ctx, target.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, suspension); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// adminLiftSuspensionHandler godoc
+//
+//	@Summary		Lift a suspension
+//	@Description	Ends the suspension or read-only restriction of the user right away
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID			path		int		true	"User ID"
+//	@Param			suspensionID	path		int		true	"Suspension ID"
+//	@Success		204				{object}	nil		"No content"
+//	@Failure		403				{object}	Problem	"Not an administrator"
+//	@Failure		404				{object}	Problem	"Suspension not found or already over"
+//	@Failure		500				{object}	Problem	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/suspensions/{suspensionID} [delete]
+func (app *application) adminLiftSuspensionHandler(w http.ResponseWriter, r *http.Request) {
+	suspensionID, err := strconv.ParseInt(chi.URLParam(r, "suspensionID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	target := getTargetFromCtx(r)
+	if err := app.store.Suspension.Lift(ctx, target.ID, suspensionID, getUserFromCtx(r).ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.recordAudit(r, store.AuditEvent{
+		Action:     "user.suspension_lifted",
+		TargetType: "user",
+		TargetID:   target.ID,
+		Details:    map[string]any{"suspension_id": suspensionID},
+	})
+	if err := app.invalidateUser(ctx, target.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestSuspensions(t *testing.T) {
+	ctx := context.Background()
+
+	checkProblemCode := func(t *testing.T, body io.Reader, want string) {
+		var problem Problem
+		if err := json.NewDecoder(body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if problem.Code != want {
+			t.Errorf("WANT %s BUT GOT %s", want, problem.Code)
+		}
+	}
+
+	t.Run("should keep read-only users from writing", func(t *testing.T) {
+		app := newTestApplication(t)
+		mux := app.routes()
+		if err := app.store.Suspension.Create(ctx, &store.Suspension{UserID: 1, Kind: store.SuspensionReadOnly, StartsAt: time.Now().Add(-time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+
+		writes := []struct {
+			method string
+			url    string
+			body   string
+		}{
+			{http.MethodPost, "/v1/conversations", `{"user_ids": [2], "content": "hello"}`},
+			{http.MethodPatch, "/v1/users/me", `{"bio": "hello"}`},
+			{http.MethodPut, "/v1/users/me/avatar", ``},
+			{http.MethodPost, "/v1/reports", `{"target_type": "post", "target_id": 1, "reason": "spam"}`},
+		}
+		for _, write := range writes {
+			req, err := http.NewRequest(write.method, write.url, strings.NewReader(write.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer 123")
+
+			rr := executeRequest(req, mux)
+			checkResponseCode(t, http.StatusForbidden, rr.Code)
+			checkProblemCode(t, rr.Body, "account_read_only")
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/2/relationship", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should refuse the tokens of suspended users", func(t *testing.T) {
+		app := newTestApplication(t)
+		mux := app.routes()
+		if err := app.store.Suspension.Create(ctx, &store.Suspension{UserID: 1, Kind: store.SuspensionFull, StartsAt: time.Now().Add(-time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/2/relationship", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+		checkProblemCode(t, rr.Body, "account_suspended")
+	})
+
+	t.Run("should not log suspended users in", func(t *testing.T) {
+		app := newTestApplication(t)
+		mux := app.routes()
+
+		user := &store.User{Username: "gopher", Email: "gopher@example.com"}
+		if err := user.Password.Set("password"); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.store.User.CreateAndInvite(ctx, "token", user, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.store.Suspension.Create(ctx, &store.Suspension{UserID: user.ID, Kind: store.SuspensionFull, StartsAt: time.Now().Add(-time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+
+		body := strings.NewReader(`{"email": "gopher@example.com", "password": "password"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+		checkProblemCode(t, rr.Body, "account_suspended")
+	})
+}
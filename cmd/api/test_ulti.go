@@ -4,10 +4,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/longlnOff/social/internal/auth"
 	"github.com/longlnOff/social/internal/store"
 	"github.com/longlnOff/social/internal/store/cache"
+	"github.com/longlnOff/social/internal/stream"
+	"github.com/longlnOff/social/internal/trending"
 	"go.uber.org/zap"
 )
 
@@ -21,9 +24,12 @@ func newTestApplication(t *testing.T) *application {
 	mockCacheStore := cache.NewMockStore()
 	return &application{
 		logger:        logger,
+		logLevel:      zap.NewAtomicLevel(),
 		store:         mockStore,
 		cacheStore:    mockCacheStore,
 		authenticator: testAuth,
+		broker:        stream.NewMemoryBroker(10, time.Minute, 10),
+		trending:      trending.NewMemoryStore(),
 	}
 }
 
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes, at most.
+const certCheckInterval = 10 * time.Second
+
+// certReloader serves the certificate of a pair of files and loads it again
+// when the files change, so renewed certificates are picked up without a
+// restart. A certificate failing to load leaves the previous one in place.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *zap.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile string, keyFile string, logger *zap.Logger) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) reload() error {
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.lastCheck = time.Now()
+	return nil
+}
+
+// filesModTime is the time of the latest change to either file.
+func (c *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// GetCertificate is the callback of tls.Config.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	cert, stale := c.cert, time.Since(c.lastCheck) >= certCheckInterval
+	c.mu.RUnlock()
+
+	if stale {
+		c.checkFiles()
+		c.mu.RLock()
+		cert = c.cert
+		c.mu.RUnlock()
+	}
+	return cert, nil
+}
+
+// checkFiles reloads the certificate when the files changed since it was
+// loaded.
+func (c *certReloader) checkFiles() {
+	c.mu.Lock()
+	if time.Since(c.lastCheck) < certCheckInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastCheck = time.Now()
+	loaded := c.modTime
+	c.mu.Unlock()
+
+	modTime, err := c.filesModTime()
+	if err != nil {
+		c.logger.Error("Failed to check TLS certificate:", zap.String("error", err.Error()))
+		return
+	}
+	if !modTime.After(loaded) {
+		return
+	}
+	if err := c.reload(); err != nil {
+		c.logger.Error("Failed to reload TLS certificate:", zap.String("error", err.Error()))
+		return
+	}
+	c.logger.Info("Reloaded TLS certificate.", zap.String("file", c.certFile))
+}
+
+// watchSignals reloads the certificate on SIGHUP until ctx is done.
+func (c *certReloader) watchSignals(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := c.reload(); err != nil {
+				c.logger.Error("Failed to reload TLS certificate:", zap.String("error", err.Error()))
+				continue
+			}
+			c.logger.Info("Reloaded TLS certificate.", zap.String("file", c.certFile))
+		}
+	}
+}
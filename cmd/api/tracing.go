@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/longlnOff/social/internal/mailer"
+	"github.com/longlnOff/social/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// untracedPaths are polled by the orchestrator and the scraper, their spans
+// would only be noise.
+var untracedPaths = map[string]bool{
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// trace starts a span for every request, continuing the trace of the caller
+// when it sent a traceparent header. The span is named after the pattern of
+// the route once it is known.
+func (app *application) trace(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+	})
+
+	return otelhttp.NewHandler(named, "http.request",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return !untracedPaths[r.URL.Path]
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
+
+// traceJob runs a background job in a span of its own.
+func (app *application) traceJob(ctx context.Context, name string, job func(context.Context) error) error {
+	ctx, span := tracing.Tracer().Start(ctx, "job "+name, trace.WithAttributes(attribute.String("job.name", name)))
+	defer span.End()
+
+	err := job(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// tracedMailer traces the sends of a mailer. The recipient is left out of
+// the span.
+type tracedMailer struct {
+	mailer.Client
+}
+
+func (m tracedMailer) Send(ctx context.Context, templateFile string, username string, email string, data any, isSanbox bool) (int, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "mail send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("mail.template", templateFile)),
+	)
+	defer span.End()
+
+	status, err := m.Client.Send(ctx, templateFile, username, email, data, isSanbox)
+	span.SetAttributes(attribute.Int("mail.status", status))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return status, err
+}
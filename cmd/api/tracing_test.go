@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	app := newTestApplication(t)
+	mux := app.routes()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer 123")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	req, err = http.NewRequest(http.MethodGet, "/livez", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executeRequest(req, mux)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("WANT %d BUT GOT %d spans", 1, len(spans))
+	}
+	span := spans[0]
+
+	t.Run("should continue the trace of the caller", func(t *testing.T) {
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("WANT trace %s BUT GOT %s", traceID, got)
+		}
+		if !span.Parent().IsRemote() {
+			t.Error("WANT the remote span as parent")
+		}
+	})
+
+	t.Run("should name the span after the route pattern", func(t *testing.T) {
+		if !strings.HasPrefix(span.Name(), "GET /v1/users/{") {
+			t.Errorf("WANT the route pattern BUT GOT %s", span.Name())
+		}
+	})
+}
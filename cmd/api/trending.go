@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/longlnOff/social/internal/store"
+	"github.com/longlnOff/social/internal/trending"
+)
+
+var errInvalidTrendingWindow = errors.New("window must be one of 1h, 24h, 7d")
+
+// TrendingPost is a trending post as v1 shows it.
+type TrendingPost struct {
+	Post  PostV1Response `json:"post"`
+	Score float64        `json:"score"`
+}
+
+type TrendingTag struct {
+	Tag   string  `json:"tag"`
+	Score float64 `json:"score"`
+}
+
+// trendingQuery holds the common filters of the trending endpoints.
+type trendingQuery struct {
+	Window string `validate:"required"`
+	Locale string `validate:"omitempty,bcp47_language_tag"`
+	Tag    string `validate:"omitempty,max=128"`
+	Limit  int    `validate:"gte=1,lte=100"`
+}
+
+// getTrendingPostsHandler godoc
+//
+//	@Summary		Trending posts
+//	@Description	Retrieves the posts with the most recent activity, recent activity weighing more
+//	@Tags			trending
+//	@Accept			json
+//	@Produce		json
+//	@Param			window	query		string			false	"Sliding window (1h, 24h, 7d)"	default(24h)
+//	@Param			locale	query		string			false	"Only posts in this locale"
+//	@Param			tag		query		string			false	"Only posts with this tag"
+//	@Param			limit	query		int				false	"Limit number of results"		default(20)
+//	@Success		200		{array}		TrendingPost	"Trending posts"
+//	@Failure		400		{object}	Problem			"Invalid parameters"
+//	@Failure		500		{object}	Problem			"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/trending/posts [get]
+func (app *application) getTrendingPostsHandler(w http.ResponseWriter, r *http.Request) {
+	query, ok := app.parseTrendingQuery(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	entries, err := app.trending.Posts(ctx, query.Window, trending.Scope{Locale: query.Locale, Tag: query.Tag}, query.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	scores := make(map[int64]float64, len(entries))
+	ids := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		id, err := strconv.ParseInt(entry.Member, 10, 64)
+		if err != nil {
+			continue
+		}
+		scores[id] = entry.Score
+		ids = append(ids, id)
+	}
+
+	// the posts are read again so deleted posts and blocked authors drop out
+	posts := []store.Post{}
+	if len(ids) > 0 {
+		posts, err = app.store.Post.GetByIDs(ctx, ids, getUserFromCtx(r).ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	byID := make(map[int64]store.Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+
+	var trendingPosts any
+	if getAPIVersion(r) == apiV1 {
+		ranked := make([]TrendingPost, 0, len(posts))
+		for _, id := range ids {
+			if post, ok := byID[id]; ok {
+				ranked = append(ranked, TrendingPost{Post: newPostV1Response(post), Score: scores[id]})
+			}
+		}
+		trendingPosts = ranked
+	} else {
+		ranked := make([]TrendingPostResponse, 0, len(posts))
+		for _, id := range ids {
+			if post, ok := byID[id]; ok {
+				ranked = append(ranked, TrendingPostResponse{Post: newPostResponse(post), Score: scores[id]})
+			}
+		}
+		trendingPosts = ranked
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, trendingPosts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getTrendingTagsHandler godoc
+//
+//	@Summary		Trending tags
+//	@Description	Retrieves the tags of the posts with the most recent activity
+//	@Tags			trending
+//	@Accept			json
+//	@Produce		json
+//	@Param			window	query		string			false	"Sliding window (1h, 24h, 7d)"	default(24h)
+//	@Param			locale	query		string			false	"Only posts in this locale"
+//	@Param			limit	query		int				false	"Limit number of results"		default(20)
+//	@Success		200		{array}		TrendingTag		"Trending tags"
+//	@Failure		400		{object}	Problem			"Invalid parameters"
+//	@Failure		500		{object}	Problem			"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/trending/tags [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	query, ok := app.parseTrendingQuery(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := app.trending.Tags(r.Context(), query.Window, query.Locale, query.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tags := make([]TrendingTag, len(entries))
+	for i, entry := range entries {
+		tags[i] = TrendingTag{Tag: entry.Member, Score: entry.Score}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) parseTrendingQuery(w http.ResponseWriter, r *http.Request) (trendingQuery, bool) {
+	qs := r.URL.Query()
+	query := trendingQuery{
+		Window: trending.DefaultWindow,
+		Locale: qs.Get("locale"),
+		Tag:    qs.Get("tag"),
+		Limit:  20,
+	}
+
+	if window := qs.Get("window"); window != "" {
+		query.Window = window
+	}
+	if _, ok := trending.WindowByName(query.Window); !ok {
+		app.badRequestResponse(w, r, errInvalidTrendingWindow)
+		return query, false
+	}
+
+	if limit := qs.Get("limit"); limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return query, false
+		}
+		query.Limit = limitInt
+	}
+
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return query, false
+	}
+
+	return query, true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/longlnOff/social/internal/trending"
+)
+
+func TestTrending(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+
+	newRequest := func(t *testing.T, url string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+		return req
+	}
+
+	t.Run("should reject unknown windows", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, "/v1/trending/tags?window=2d"), mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return the tags of the locale", func(t *testing.T) {
+		board := &trending.Board{
+			Tags: map[string][]trending.Entry{
+				"":   {{Member: "go", Score: 2}, {Member: "rust", Score: 1}},
+				"vi": {{Member: "rust", Score: 1}},
+			},
+		}
+		if err := app.trending.Replace(context.Background(), "1h", board); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(newRequest(t, "/v1/trending/tags?window=1h&locale=vi"), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data []TrendingTag `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 1 || res.Data[0].Tag != "rust" {
+			t.Errorf("WANT rust BUT GOT %v", res.Data)
+		}
+	})
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"testing"
+
+	"github.com/longlnOff/social/internal/store"
 )
 
 
@@ -31,3 +35,73 @@ func TestGetUser(t *testing.T) {
 		checkResponseCode(t, http.StatusOK, rr.Code)
 	})
 }
+
+func TestFollowers(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.routes()
+
+	newRequest := func(t *testing.T, method, url string) *http.Request {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+		return req
+	}
+
+	t.Run("should list the followers and tell the relationship", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodPut, "/v1/users/2/follow"), mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+
+		rr = executeRequest(newRequest(t, http.MethodGet, "/v1/users/2/followers"), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		var followers struct {
+			Data []store.FollowEntry `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&followers); err != nil {
+			t.Fatal(err)
+		}
+		if len(followers.Data) != 1 || followers.Data[0].User.ID != 1 {
+			t.Errorf("WANT user 1 following user 2 BUT GOT %v", followers.Data)
+		}
+
+		rr = executeRequest(newRequest(t, http.MethodGet, "/v1/users/2/relationship"), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		var relationship struct {
+			Data store.Relationship `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&relationship); err != nil {
+			t.Fatal(err)
+		}
+		if !relationship.Data.Following || relationship.Data.FollowedBy {
+			t.Errorf("WANT user 1 following user 2 only BUT GOT %+v", relationship.Data)
+		}
+	})
+
+	t.Run("should not list the followers of users who blocked the viewer", func(t *testing.T) {
+		if err := app.store.Block.Block(context.Background(), 3, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(newRequest(t, http.MethodGet, "/v1/users/3/followers"), mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should not list the follows of unknown users", func(t *testing.T) {
+		if err := app.store.User.Delete(context.Background(), 4); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, url := range []string{"/v1/users/4/followers", "/v1/users/4/following"} {
+			rr := executeRequest(newRequest(t, http.MethodGet, url), mux)
+			checkResponseCode(t, http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should not block or mute unknown users", func(t *testing.T) {
+		for _, url := range []string{"/v1/users/4/block", "/v1/users/4/mute"} {
+			rr := executeRequest(newRequest(t, http.MethodPut, url), mux)
+			checkResponseCode(t, http.StatusNotFound, rr.Code)
+		}
+	})
+}
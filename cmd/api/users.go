@@ -14,8 +14,14 @@ type UserCTX string
 
 var Userctx UserCTX = "user"
 
-type FollowedPayload struct {
-	UserID int64 `json:"user_id" validate:"required"`
+type UpdatePrivacyPayload struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+// UserProfile is a user along with its follower, following and post counts.
+type UserProfile struct {
+	*store.User
+	store.UserStats
 }
 
 // ActivateUser godoc
@@ -27,13 +33,14 @@ type FollowedPayload struct {
 //	@Produce		json
 //	@Param			token	path		string	true	"Invitation token"
 //	@Success		204		{string}	string	"User activated"
-//	@Failure		404		{object}	error	"User not found"
-//	@Failure		500		{object}	error	"Internal Server Error"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/users/activate/{token} [put]
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
-	if err := app.store.User.ActivateUser(r.Context(), token); err != nil {
+	userID, err := app.store.User.ActivateUser(r.Context(), token)
+	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
@@ -42,6 +49,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	app.recordAudit(r, store.AuditEvent{Action: "user.activated", TargetType: "user", TargetID: userID})
 	if err := app.jsonResponse(w, http.StatusNoContent, "User activated"); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -56,9 +64,9 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 //	@Accept			json
 //	@Produce		json
 //	@Param			userID	path		int			true	"User ID"
-//	@Success		200		{object}	store.User	"User details"
-//	@Failure		404		{object}	string		"User not found"
-//	@Failure		500		{object}	string		"Internal Server Error"
+//	@Success		200		{object}	UserProfile	"User details"
+//	@Failure		404		{object}	Problem		"User not found"
+//	@Failure		500		{object}	Problem		"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID} [get]
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -70,6 +78,16 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
+	blocked, err := app.store.Block.IsBlocked(ctx, getUserFromCtx(r).ID, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if blocked {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
 	user, err := app.getUser(ctx, userID)
 	if err != nil {
 		switch {
@@ -81,7 +99,19 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	// counters change too often to be cached with the user
+	stats, err := app.store.User.GetStats(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, UserProfile{User: user, UserStats: *stats}); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -94,12 +124,14 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 //	@Tags			users,follows
 //	@Accept			json
 //	@Produce		json
-//	@Param			userID	path		int				true	"Follower User ID"
-//	@Param			request	body		FollowedPayload	true	"User to follow"
-//	@Success		204		{object}	nil				"No content"
-//	@Failure		400		{object}	string			"Invalid request payload"
-//	@Failure		409		{object}	string			"Already following this user"
-//	@Failure		500		{object}	string			"Internal Server Error"
+//	@Param			userID	path		int		true	"User ID to follow"
+//	@Success		202		{object}	nil		"Follow request sent to a private account"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		400		{object}	Problem	"Invalid user ID or self follow"
+//	@Failure		403		{object}	Problem	"Blocked"
+//	@Failure		404		{object}	Problem	"User not found"
+//	@Failure		409		{object}	Problem	"Already following or requested this user"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/follow [put]
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -110,42 +142,54 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var followedPayload FollowedPayload
-	if err := readJSON(w, r, &followedPayload); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-
-	if err := Validate.Struct(followedPayload); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-
-	if err := app.store.Follower.Follow(r.Context(), follower.ID, followedUserID); err != nil {
+	pending, err := app.store.Follower.Follow(r.Context(), follower.ID, followedUserID)
+	if err != nil {
 		switch {
+		case errors.Is(err, store.ErrSelfFollow):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
 		case errors.Is(err, store.ErrConflict):
 			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenErrorResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
+		return
 	}
 
+	app.invalidateSuggestions(r.Context(), follower.ID)
+
+	notification := store.Notification{
+		ActorID: follower.ID,
+		Type:    store.NotificationFollow,
+		Actor:   store.User{ID: follower.ID, Username: follower.Username},
+	}
+	if pending {
+		notification.Type = store.NotificationFollowRequest
+	}
+	app.publishNotification(r.Context(), notification, []int64{followedUserID})
+
+	if pending {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // unfollowUserHandler godoc
 //
 //	@Summary		Unfollow a user
-//	@Description	Removes a follow relationship between the authenticated user and target user
+//	@Description	Removes a follow relationship, or cancels a pending follow request, between the authenticated user and target user
 //	@Tags			users,follows
 //	@Accept			json
 //	@Produce		json
-//	@Param			userID	path		int				true	"Follower User ID"
-//	@Param			request	body		FollowedPayload	true	"User to unfollow"
-//	@Success		204		{object}	nil				"No content"
-//	@Failure		400		{object}	string			"Invalid request payload"
-//	@Failure		404		{object}	string			"Not following this user"
-//	@Failure		500		{object}	string			"Internal Server Error"
+//	@Param			userID	path		int		true	"User ID to unfollow"
+//	@Success		204		{object}	nil		"No content"
+//	@Failure		400		{object}	Problem	"Invalid user ID"
+//	@Failure		404		{object}	Problem	"Not following nor requested this user"
+//	@Failure		500		{object}	Problem	"Internal Server Error"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/unfollow [put]
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -155,24 +199,172 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	var followedPayload FollowedPayload
-	if err := readJSON(w, r, &followedPayload); err != nil {
-		app.badRequestResponse(w, r, err)
+	if err := app.store.Follower.Unfollow(r.Context(), follweruser.ID, followedUserID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
-	if err := Validate.Struct(followedPayload); err != nil {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFollowersHandler godoc
+//
+//	@Summary		Get followers
+//	@Description	Retrieves the users following a user, most recent first
+//	@Tags			users,follows
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int					true	"User ID"
+//	@Param			limit	query		int					false	"Limit number of results"			default(20)
+//	@Param			before	query		int					false	"Cursor of the last entry of the previous page"
+//	@Success		200		{array}		store.FollowEntry	"Followers"
+//	@Failure		400		{object}	Problem				"Invalid pagination parameters"
+//	@Failure		404		{object}	Problem				"User not found"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/followers [get]
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.getFollowList(w, r, app.store.Follower.GetFollowers)
+}
+
+// getFollowingHandler godoc
+//
+//	@Summary		Get following
+//	@Description	Retrieves the users followed by a user, most recent first
+//	@Tags			users,follows
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int					true	"User ID"
+//	@Param			limit	query		int					false	"Limit number of results"			default(20)
+//	@Param			before	query		int					false	"Cursor of the last entry of the previous page"
+//	@Success		200		{array}		store.FollowEntry	"Followed users"
+//	@Failure		400		{object}	Problem				"Invalid pagination parameters"
+//	@Failure		404		{object}	Problem				"User not found"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/following [get]
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.getFollowList(w, r, app.store.Follower.GetFollowing)
+}
+
+func (app *application) getFollowList(w http.ResponseWriter, r *http.Request, list func(context.Context, int64, int64, store.PaginatedKeyset) ([]store.FollowEntry, error)) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if err := app.store.Follower.Unfollow(r.Context(), follweruser.ID, followedUserID); err != nil {
+	pagination, ok := app.parseKeysetPagination(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := app.getUser(ctx, userID); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
+		return
+	}
+
+	viewer := getUserFromCtx(r)
+	blocked, err := app.store.Block.IsBlocked(ctx, viewer.ID, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if blocked {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	entries, err := list(ctx, userID, viewer.ID, pagination)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, entries); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getRelationshipHandler godoc
+//
+//	@Summary		Get relationship
+//	@Description	Tells whether the authenticated user follows, is followed by, blocks or mutes a user
+//	@Tags			users,follows
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int					true	"User ID"
+//	@Success		200		{object}	store.Relationship	"Relationship"
+//	@Failure		400		{object}	Problem				"Invalid user ID"
+//	@Failure		500		{object}	Problem				"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/relationship [get]
+func (app *application) getRelationshipHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	relationship, err := app.store.Follower.GetRelationship(r.Context(), getUserFromCtx(r).ID, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, relationship); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// updatePrivacyHandler godoc
+//
+//	@Summary		Update account privacy
+//	@Description	Makes the account of the authenticated user private or public. Going public approves the pending follow requests
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		UpdatePrivacyPayload	true	"Privacy"
+//	@Success		204		{object}	nil						"No content"
+//	@Failure		400		{object}	Problem					"Invalid request payload"
+//	@Failure		500		{object}	Problem					"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/privacy [put]
+func (app *application) updatePrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdatePrivacyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+	if err := app.store.User.SetPrivacy(ctx, user.ID, *payload.IsPrivate); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.invalidateUser(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiVersion is the version of the API a request was made to.
+type apiVersion int
+
+const (
+	apiV1 apiVersion = 1
+	apiV2 apiVersion = 2
+)
+
+// latestAPIVersion is the version the deprecated routes point to.
+const latestAPIVersion = apiV2
+
+func (v apiVersion) prefix() string {
+	return fmt.Sprintf("/v%d", v)
+}
+
+type APIVersionCTX string
+
+var APIVersionctx APIVersionCTX = "api_version"
+
+// withAPIVersion tells the handlers which version the request was made to.
+func withAPIVersion(version apiVersion) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), APIVersionctx, version)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// getAPIVersion is the version of the request, the first one outside of the
+// versioned routes.
+func getAPIVersion(r *http.Request) apiVersion {
+	if version, ok := r.Context().Value(APIVersionctx).(apiVersion); ok {
+		return version
+	}
+	return apiV1
+}
+
+// deprecation announces when the routes of a version stop being supported.
+// A zero At means they are not deprecated.
+type deprecation struct {
+	At     time.Time
+	Sunset time.Time
+}
+
+func (app *application) deprecationOf(version apiVersion) deprecation {
+	if version != apiV1 {
+		return deprecation{}
+	}
+	return deprecation{
+		At:     app.configuration.Versioning.API_V1_DEPRECATED_AT,
+		Sunset: app.configuration.Versioning.API_V1_SUNSET_AT,
+	}
+}
+
+// deprecatedIn marks the routes as deprecated when requested in version: the
+// response gets the Deprecation (RFC 9745) and Sunset (RFC 8594) headers,
+// and a link to the same route in the latest version. The requests are
+// counted by client.
+func (app *application) deprecatedIn(version apiVersion) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := app.deprecationOf(version)
+			if getAPIVersion(r) != version || d.At.IsZero() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.At.Unix()))
+			if !d.Sunset.IsZero() {
+				w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			successor := latestAPIVersion.prefix() + strings.TrimPrefix(r.URL.Path, version.prefix())
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+
+			next.ServeHTTP(w, r)
+
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			app.metrics.deprecatedRequest(route, app.apiClient(r))
+		})
+	}
+}
+
+// apiClient names the client of the request after the first product of its
+// User-Agent, like gophersocial-ios in gophersocial-ios/2.3 (iPhone), when it
+// is a known client; the others are all "other".
+func (app *application) apiClient(r *http.Request) string {
+	product, _, _ := strings.Cut(r.UserAgent(), " ")
+	name, _, _ := strings.Cut(product, "/")
+	for _, client := range app.configuration.Versioning.API_CLIENTS {
+		if strings.EqualFold(client, name) {
+			return client
+		}
+	}
+	return "other"
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/longlnOff/social/internal/store"
+)
+
+func TestDeprecation(t *testing.T) {
+	app := newTestApplication(t)
+	app.metrics = newMetrics(nil)
+	app.configuration.Versioning.API_V1_DEPRECATED_AT = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	app.configuration.Versioning.API_V1_SUNSET_AT = time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	app.configuration.Versioning.API_CLIENTS = []string{"gophersocial-ios"}
+	mux := app.routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", "GopherSocial-iOS/2.3 (iPhone)")
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should announce the end of the v1 routes", func(t *testing.T) {
+		rr := get("/v1/posts/1")
+		if got := rr.Header().Get("Deprecation"); got != "@1767225600" {
+			t.Errorf("WANT @1767225600 BUT GOT %q", got)
+		}
+		if got := rr.Header().Get("Sunset"); got != "Wed, 01 Jul 2026 00:00:00 GMT" {
+			t.Errorf("WANT the sunset date BUT GOT %q", got)
+		}
+		if got := rr.Header().Get("Link"); got != `</v2/posts/1>; rel="successor-version"` {
+			t.Errorf("WANT a link to v2 BUT GOT %q", got)
+		}
+	})
+
+	t.Run("should not deprecate the v2 routes", func(t *testing.T) {
+		rr := get("/v2/posts/1")
+		if got := rr.Header().Get("Deprecation"); got != "" {
+			t.Errorf("WANT no Deprecation header BUT GOT %q", got)
+		}
+	})
+
+	t.Run("should count the deprecated requests by client", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/trending/tags", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer 123")
+		req.Header.Set("User-Agent", "GopherSocial-iOS/2.3 (iPhone)")
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		req, err = http.NewRequest(http.MethodGet, "/metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := executeRequest(req, mux).Body.String()
+		if !strings.Contains(body, `http_deprecated_requests_total{client="gophersocial-ios",route="/v1/trending/tags"} 1`) {
+			t.Errorf("WANT the deprecated request counted BUT GOT %s", body)
+		}
+	})
+}
+
+func TestPresentPost(t *testing.T) {
+	post := store.Post{
+		ID:       1,
+		Title:    "title",
+		UserID:   7,
+		User:     store.User{Username: "gopher", Email: "gopher@example.com"},
+		Comments: []store.Comment{{ID: 2, PostID: 1, UserID: 8, User: store.User{ID: 8, Username: "other"}}},
+	}
+
+	present := func(version apiVersion) map[string]any {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), APIVersionctx, version))
+		body, err := json.Marshal(presentPost(req, post))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := map[string]any{}
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	t.Run("should keep the v1 shape", func(t *testing.T) {
+		res := present(apiV1)
+		if _, ok := res["user"].(map[string]any)["email"]; !ok || res["user_id"] != float64(7) {
+			t.Errorf("WANT the v1 post BUT GOT %v", res)
+		}
+	})
+
+	t.Run("should only show the public part of the authors in v2", func(t *testing.T) {
+		res := present(apiV2)
+		author := res["author"].(map[string]any)
+		if author["id"] != float64(7) || author["username"] != "gopher" || author["email"] != nil {
+			t.Errorf("WANT the public author BUT GOT %v", author)
+		}
+		if _, ok := res["user"]; ok {
+			t.Error("WANT no user in v2")
+		}
+		comments := res["comments"].([]any)
+		if len(comments) != 1 || comments[0].(map[string]any)["author"].(map[string]any)["username"] != "other" {
+			t.Errorf("WANT the comments with their authors BUT GOT %v", comments)
+		}
+	})
+}
@@ -1,17 +1,151 @@
 package configuration
 
 import (
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Configuration struct {
-	Server   ServerConfiguration
-	Database DatabaseConfiguration
-	Cache    CacheConfiguration
-	Mail     MailConfiguration
-	Auth     AuthConfiguration
+	Server      ServerConfiguration
+	Database    DatabaseConfiguration
+	Cache       CacheConfiguration
+	Mail        MailConfiguration
+	Auth        AuthConfiguration
+	Stream      StreamConfiguration
+	Jobs        JobsConfiguration
+	Media       MediaConfiguration
+	Account     AccountConfiguration
+	Audit       AuditConfiguration
+	Moderation  ModerationConfiguration
+	RateLimit   RateLimitConfiguration
+	Idempotency IdempotencyConfiguration
+	Health      HealthConfiguration
+	Metrics     MetricsConfiguration
+	Tracing     TracingConfiguration
+	Logging     LoggingConfiguration
+	Versioning  VersioningConfiguration
+}
+
+// VersioningConfiguration announces the end of the v1 routes replaced in v2:
+// API_V1_DEPRECATED_AT and API_V1_SUNSET_AT (RFC 3339 times, unset when
+// empty) go in their Deprecation and Sunset headers. The deprecated requests
+// are counted by client, the first product of their User-Agent when it is one
+// of API_CLIENTS.
+type VersioningConfiguration struct {
+	API_V1_DEPRECATED_AT time.Time `mapstructure:"API_V1_DEPRECATED_AT"`
+	API_V1_SUNSET_AT     time.Time `mapstructure:"API_V1_SUNSET_AT"`
+	API_CLIENTS          []string  `mapstructure:"API_CLIENTS"`
+}
+
+// LoggingConfiguration sets the initial LOG_LEVEL, which the administrators
+// can change while the API runs. Within every second, the first
+// LOG_SAMPLING_INITIAL entries with the same message are written, then one in
+// every LOG_SAMPLING_THEREAFTER; a zero LOG_SAMPLING_INITIAL writes them all.
+type LoggingConfiguration struct {
+	LOG_LEVEL               string `mapstructure:"LOG_LEVEL"`
+	LOG_SAMPLING_INITIAL    int    `mapstructure:"LOG_SAMPLING_INITIAL"`
+	LOG_SAMPLING_THEREAFTER int    `mapstructure:"LOG_SAMPLING_THEREAFTER"`
+}
+
+// TracingConfiguration exports the OpenTelemetry spans: TRACING_EXPORTER is
+// none, stdout or otlp, the latter sending them over HTTP to
+// TRACING_OTLP_ENDPOINT. TRACING_SAMPLE_RATIO is the share of the traces
+// started by the API that are kept.
+type TracingConfiguration struct {
+	TRACING_EXPORTER      string  `mapstructure:"TRACING_EXPORTER"`
+	TRACING_SERVICE_NAME  string  `mapstructure:"TRACING_SERVICE_NAME"`
+	TRACING_OTLP_ENDPOINT string  `mapstructure:"TRACING_OTLP_ENDPOINT"`
+	TRACING_OTLP_INSECURE bool    `mapstructure:"TRACING_OTLP_INSECURE"`
+	TRACING_SAMPLE_RATIO  float64 `mapstructure:"TRACING_SAMPLE_RATIO"`
+}
+
+// MetricsConfiguration exposes the Prometheus metrics. They are served on
+// METRICS_ADDRESS, apart from the API, or at /metrics of the API when it is
+// empty; METRICS_TOKEN, when set, is required as a bearer token.
+type MetricsConfiguration struct {
+	METRICS_ENABLED bool   `mapstructure:"METRICS_ENABLED"`
+	METRICS_ADDRESS string `mapstructure:"METRICS_ADDRESS"`
+	METRICS_TOKEN   string `mapstructure:"METRICS_TOKEN"`
+}
+
+// HealthConfiguration tunes the readiness probe: every dependency check has
+// HEALTH_CHECK_TIMEOUT, and the results are reused for HEALTH_CACHE_TTL.
+type HealthConfiguration struct {
+	HEALTH_CHECK_TIMEOUT time.Duration `mapstructure:"HEALTH_CHECK_TIMEOUT"`
+	HEALTH_CACHE_TTL     time.Duration `mapstructure:"HEALTH_CACHE_TTL"`
+}
+
+// IdempotencyConfiguration keeps the responses to the requests sent with an
+// Idempotency-Key for IDEMPOTENCY_TTL.
+type IdempotencyConfiguration struct {
+	IDEMPOTENCY_TTL time.Duration `mapstructure:"IDEMPOTENCY_TTL"`
+}
+
+// RateLimitConfiguration limits the requests per route group. A limit is
+// written as key:requests/window, the key being ip, user or api_key, like
+// ip:10/1m; an empty limit turns the group off. Only the API keys listed in
+// RATE_LIMIT_API_KEYS count as keys, and a user key only applies to the
+// groups behind the authentication: the global group is limited before it,
+// so its user limit is per IP.
+type RateLimitConfiguration struct {
+	RATE_LIMIT_ENABLED   bool     `mapstructure:"RATE_LIMIT_ENABLED"`
+	RATE_LIMIT_ALGORITHM string   `mapstructure:"RATE_LIMIT_ALGORITHM"`
+	RATE_LIMIT_GLOBAL    string   `mapstructure:"RATE_LIMIT_GLOBAL"`
+	RATE_LIMIT_AUTH      string   `mapstructure:"RATE_LIMIT_AUTH"`
+	RATE_LIMIT_WRITE     string   `mapstructure:"RATE_LIMIT_WRITE"`
+	RATE_LIMIT_API_KEYS  []string `mapstructure:"RATE_LIMIT_API_KEYS"`
+}
+
+// ModerationConfiguration sets up the content filters. MODERATION_FILTERS
+// lists the filters to run in order, among blocklist, links, burst and
+// classifier; the lists are comma separated.
+type ModerationConfiguration struct {
+	MODERATION_FILTERS            []string      `mapstructure:"MODERATION_FILTERS"`
+	MODERATION_ON_ERROR           string        `mapstructure:"MODERATION_ON_ERROR"`
+	MODERATION_BLOCKED_WORDS      []string      `mapstructure:"MODERATION_BLOCKED_WORDS"`
+	MODERATION_BLOCKED_PATTERN    string        `mapstructure:"MODERATION_BLOCKED_PATTERN"`
+	MODERATION_BLOCKLIST_VERDICT  string        `mapstructure:"MODERATION_BLOCKLIST_VERDICT"`
+	MODERATION_BLOCKED_DOMAINS    []string      `mapstructure:"MODERATION_BLOCKED_DOMAINS"`
+	MODERATION_SUSPICIOUS_DOMAINS []string      `mapstructure:"MODERATION_SUSPICIOUS_DOMAINS"`
+	MODERATION_BURST_WINDOW       time.Duration `mapstructure:"MODERATION_BURST_WINDOW"`
+	MODERATION_BURST_LIMIT        int           `mapstructure:"MODERATION_BURST_LIMIT"`
+	MODERATION_CLASSIFIER_URL     string        `mapstructure:"MODERATION_CLASSIFIER_URL"`
+	MODERATION_CLASSIFIER_TIMEOUT time.Duration `mapstructure:"MODERATION_CLASSIFIER_TIMEOUT"`
+}
+
+type AuditConfiguration struct {
+	AUDIT_HASH_CHAIN bool `mapstructure:"AUDIT_HASH_CHAIN"`
+}
+
+type AccountConfiguration struct {
+	ACCOUNT_DELETION_GRACE  time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE"`
+	ACCOUNT_DELETION_POLICY string        `mapstructure:"ACCOUNT_DELETION_POLICY"`
+	EXPORT_DIR              string        `mapstructure:"EXPORT_DIR"`
+	EXPORT_LINK_EXP         time.Duration `mapstructure:"EXPORT_LINK_EXP"`
+}
+
+type MediaConfiguration struct {
+	MEDIA_DIR      string `mapstructure:"MEDIA_DIR"`
+	MEDIA_BASE_URL string `mapstructure:"MEDIA_BASE_URL"`
+}
+
+type JobsConfiguration struct {
+	SUGGESTIONS_REFRESH_INTERVAL time.Duration `mapstructure:"SUGGESTIONS_REFRESH_INTERVAL"`
+	TRENDING_REFRESH_INTERVAL    time.Duration `mapstructure:"TRENDING_REFRESH_INTERVAL"`
+	ACCOUNT_PURGE_INTERVAL       time.Duration `mapstructure:"ACCOUNT_PURGE_INTERVAL"`
+	DATA_EXPORT_INTERVAL         time.Duration `mapstructure:"DATA_EXPORT_INTERVAL"`
+	IDEMPOTENCY_PURGE_INTERVAL   time.Duration `mapstructure:"IDEMPOTENCY_PURGE_INTERVAL"`
+}
+
+// StreamConfiguration tunes the event stream: the last STREAM_HISTORY_SIZE
+// events of a topic are kept for STREAM_HISTORY_TTL, to resume the clients.
+type StreamConfiguration struct {
+	STREAM_HEARTBEAT    time.Duration `mapstructure:"STREAM_HEARTBEAT"`
+	STREAM_BUFFER_SIZE  int           `mapstructure:"STREAM_BUFFER_SIZE"`
+	STREAM_HISTORY_SIZE int           `mapstructure:"STREAM_HISTORY_SIZE"`
+	STREAM_HISTORY_TTL  time.Duration `mapstructure:"STREAM_HISTORY_TTL"`
 }
 
 type CacheConfiguration struct {
@@ -60,6 +194,27 @@ type ServerConfiguration struct {
 	EXTERNAL_ADDRESS string `mapstructure:"EXTERNAL_ADDRESS"`
 	EXTERNAL_PORT    string `mapstructure:"EXTERNAL_PORT"`
 	FRONTEND_URL     string `mapstructure:"FRONTEND_URL"`
+
+	SERVER_READ_TIMEOUT        time.Duration `mapstructure:"SERVER_READ_TIMEOUT"`
+	SERVER_READ_HEADER_TIMEOUT time.Duration `mapstructure:"SERVER_READ_HEADER_TIMEOUT"`
+	SERVER_WRITE_TIMEOUT       time.Duration `mapstructure:"SERVER_WRITE_TIMEOUT"`
+	SERVER_IDLE_TIMEOUT        time.Duration `mapstructure:"SERVER_IDLE_TIMEOUT"`
+	SERVER_MAX_HEADER_BYTES    int           `mapstructure:"SERVER_MAX_HEADER_BYTES"`
+	// SERVER_SHUTDOWN_TIMEOUT is how long the requests in flight have to
+	// finish once the server is asked to stop.
+	SERVER_SHUTDOWN_TIMEOUT time.Duration `mapstructure:"SERVER_SHUTDOWN_TIMEOUT"`
+	// SERVER_SHUTDOWN_DELAY is how long the server reports not ready before
+	// it stops accepting connections, for the load balancers to notice.
+	SERVER_SHUTDOWN_DELAY time.Duration `mapstructure:"SERVER_SHUTDOWN_DELAY"`
+	// The server speaks TLS when both files are set, they are read again
+	// when they change or on SIGHUP.
+	SERVER_TLS_CERT_FILE string `mapstructure:"SERVER_TLS_CERT_FILE"`
+	SERVER_TLS_KEY_FILE  string `mapstructure:"SERVER_TLS_KEY_FILE"`
+	// SERVER_TRUSTED_PROXIES lists the IPs and CIDRs of the proxies in
+	// front of the API, comma separated. Only their X-Forwarded-For and
+	// X-Real-IP headers are believed, the other clients are known by the
+	// address they connect from.
+	SERVER_TRUSTED_PROXIES []string `mapstructure:"SERVER_TRUSTED_PROXIES"`
 }
 
 type DatabaseConfiguration struct {
@@ -114,6 +269,17 @@ func LoadConfig(path string) (cfg Configuration, err error) {
 		EXTERNAL_ADDRESS: viper.GetString("EXTERNAL_ADDRESS"),
 		EXTERNAL_PORT:    viper.GetString("EXTERNAL_PORT"),
 		FRONTEND_URL:     viper.GetString("FRONTEND_URL"),
+
+		SERVER_READ_TIMEOUT:        viper.GetDuration("SERVER_READ_TIMEOUT"),
+		SERVER_READ_HEADER_TIMEOUT: viper.GetDuration("SERVER_READ_HEADER_TIMEOUT"),
+		SERVER_WRITE_TIMEOUT:       viper.GetDuration("SERVER_WRITE_TIMEOUT"),
+		SERVER_IDLE_TIMEOUT:        viper.GetDuration("SERVER_IDLE_TIMEOUT"),
+		SERVER_MAX_HEADER_BYTES:    viper.GetInt("SERVER_MAX_HEADER_BYTES"),
+		SERVER_SHUTDOWN_TIMEOUT:    viper.GetDuration("SERVER_SHUTDOWN_TIMEOUT"),
+		SERVER_SHUTDOWN_DELAY:      viper.GetDuration("SERVER_SHUTDOWN_DELAY"),
+		SERVER_TLS_CERT_FILE:       viper.GetString("SERVER_TLS_CERT_FILE"),
+		SERVER_TLS_KEY_FILE:        viper.GetString("SERVER_TLS_KEY_FILE"),
+		SERVER_TRUSTED_PROXIES:     splitList(viper.GetString("SERVER_TRUSTED_PROXIES")),
 	}
 
 	database_cfg := DatabaseConfiguration{
@@ -135,11 +301,124 @@ func LoadConfig(path string) (cfg Configuration, err error) {
 		CACHE_ENABLED:  viper.GetBool("CACHE_ENABLED"),
 	}
 
+	stream_cfg := StreamConfiguration{
+		STREAM_HEARTBEAT:    viper.GetDuration("STREAM_HEARTBEAT"),
+		STREAM_BUFFER_SIZE:  viper.GetInt("STREAM_BUFFER_SIZE"),
+		STREAM_HISTORY_SIZE: viper.GetInt("STREAM_HISTORY_SIZE"),
+		STREAM_HISTORY_TTL:  viper.GetDuration("STREAM_HISTORY_TTL"),
+	}
+
+	jobs_cfg := JobsConfiguration{
+		SUGGESTIONS_REFRESH_INTERVAL: viper.GetDuration("SUGGESTIONS_REFRESH_INTERVAL"),
+		TRENDING_REFRESH_INTERVAL:    viper.GetDuration("TRENDING_REFRESH_INTERVAL"),
+		ACCOUNT_PURGE_INTERVAL:       viper.GetDuration("ACCOUNT_PURGE_INTERVAL"),
+		DATA_EXPORT_INTERVAL:         viper.GetDuration("DATA_EXPORT_INTERVAL"),
+		IDEMPOTENCY_PURGE_INTERVAL:   viper.GetDuration("IDEMPOTENCY_PURGE_INTERVAL"),
+	}
+
+	media_cfg := MediaConfiguration{
+		MEDIA_DIR:      viper.GetString("MEDIA_DIR"),
+		MEDIA_BASE_URL: viper.GetString("MEDIA_BASE_URL"),
+	}
+
+	account_cfg := AccountConfiguration{
+		ACCOUNT_DELETION_GRACE:  viper.GetDuration("ACCOUNT_DELETION_GRACE"),
+		ACCOUNT_DELETION_POLICY: viper.GetString("ACCOUNT_DELETION_POLICY"),
+		EXPORT_DIR:              viper.GetString("EXPORT_DIR"),
+		EXPORT_LINK_EXP:         viper.GetDuration("EXPORT_LINK_EXP"),
+	}
+
+	audit_cfg := AuditConfiguration{
+		AUDIT_HASH_CHAIN: viper.GetBool("AUDIT_HASH_CHAIN"),
+	}
+
+	moderation_cfg := ModerationConfiguration{
+		MODERATION_FILTERS:            splitList(viper.GetString("MODERATION_FILTERS")),
+		MODERATION_ON_ERROR:           viper.GetString("MODERATION_ON_ERROR"),
+		MODERATION_BLOCKED_WORDS:      splitList(viper.GetString("MODERATION_BLOCKED_WORDS")),
+		MODERATION_BLOCKED_PATTERN:    viper.GetString("MODERATION_BLOCKED_PATTERN"),
+		MODERATION_BLOCKLIST_VERDICT:  viper.GetString("MODERATION_BLOCKLIST_VERDICT"),
+		MODERATION_BLOCKED_DOMAINS:    splitList(viper.GetString("MODERATION_BLOCKED_DOMAINS")),
+		MODERATION_SUSPICIOUS_DOMAINS: splitList(viper.GetString("MODERATION_SUSPICIOUS_DOMAINS")),
+		MODERATION_BURST_WINDOW:       viper.GetDuration("MODERATION_BURST_WINDOW"),
+		MODERATION_BURST_LIMIT:        viper.GetInt("MODERATION_BURST_LIMIT"),
+		MODERATION_CLASSIFIER_URL:     viper.GetString("MODERATION_CLASSIFIER_URL"),
+		MODERATION_CLASSIFIER_TIMEOUT: viper.GetDuration("MODERATION_CLASSIFIER_TIMEOUT"),
+	}
+
+	rate_limit_cfg := RateLimitConfiguration{
+		RATE_LIMIT_ENABLED:   viper.GetBool("RATE_LIMIT_ENABLED"),
+		RATE_LIMIT_ALGORITHM: viper.GetString("RATE_LIMIT_ALGORITHM"),
+		RATE_LIMIT_GLOBAL:    viper.GetString("RATE_LIMIT_GLOBAL"),
+		RATE_LIMIT_AUTH:      viper.GetString("RATE_LIMIT_AUTH"),
+		RATE_LIMIT_WRITE:     viper.GetString("RATE_LIMIT_WRITE"),
+		RATE_LIMIT_API_KEYS:  splitList(viper.GetString("RATE_LIMIT_API_KEYS")),
+	}
+
+	idempotency_cfg := IdempotencyConfiguration{
+		IDEMPOTENCY_TTL: viper.GetDuration("IDEMPOTENCY_TTL"),
+	}
+
+	health_cfg := HealthConfiguration{
+		HEALTH_CHECK_TIMEOUT: viper.GetDuration("HEALTH_CHECK_TIMEOUT"),
+		HEALTH_CACHE_TTL:     viper.GetDuration("HEALTH_CACHE_TTL"),
+	}
+
+	metrics_cfg := MetricsConfiguration{
+		METRICS_ENABLED: viper.GetBool("METRICS_ENABLED"),
+		METRICS_ADDRESS: viper.GetString("METRICS_ADDRESS"),
+		METRICS_TOKEN:   viper.GetString("METRICS_TOKEN"),
+	}
+
+	tracing_cfg := TracingConfiguration{
+		TRACING_EXPORTER:      viper.GetString("TRACING_EXPORTER"),
+		TRACING_SERVICE_NAME:  viper.GetString("TRACING_SERVICE_NAME"),
+		TRACING_OTLP_ENDPOINT: viper.GetString("TRACING_OTLP_ENDPOINT"),
+		TRACING_OTLP_INSECURE: viper.GetBool("TRACING_OTLP_INSECURE"),
+		TRACING_SAMPLE_RATIO:  viper.GetFloat64("TRACING_SAMPLE_RATIO"),
+	}
+
+	logging_cfg := LoggingConfiguration{
+		LOG_LEVEL:               viper.GetString("LOG_LEVEL"),
+		LOG_SAMPLING_INITIAL:    viper.GetInt("LOG_SAMPLING_INITIAL"),
+		LOG_SAMPLING_THEREAFTER: viper.GetInt("LOG_SAMPLING_THEREAFTER"),
+	}
+
+	versioning_cfg := VersioningConfiguration{
+		API_V1_DEPRECATED_AT: viper.GetTime("API_V1_DEPRECATED_AT"),
+		API_V1_SUNSET_AT:     viper.GetTime("API_V1_SUNSET_AT"),
+		API_CLIENTS:          splitList(viper.GetString("API_CLIENTS")),
+	}
+
 	return Configuration{
-		Server:   server_cfg,
-		Database: database_cfg,
-		Cache:    cache_cfg,
-		Mail:     mail_cfg,
-		Auth:     AuthConfiguration{Basic: basicAuth, Token: tokenAuth},
+		Server:      server_cfg,
+		Database:    database_cfg,
+		Cache:       cache_cfg,
+		Mail:        mail_cfg,
+		Auth:        AuthConfiguration{Basic: basicAuth, Token: tokenAuth},
+		Stream:      stream_cfg,
+		Jobs:        jobs_cfg,
+		Media:       media_cfg,
+		Account:     account_cfg,
+		Audit:       audit_cfg,
+		Moderation:  moderation_cfg,
+		RateLimit:   rate_limit_cfg,
+		Idempotency: idempotency_cfg,
+		Health:      health_cfg,
+		Metrics:     metrics_cfg,
+		Tracing:     tracing_cfg,
+		Logging:     logging_cfg,
+		Versioning:  versioning_cfg,
 	}, nil
 }
+
+// splitList splits a comma separated list, dropping the empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
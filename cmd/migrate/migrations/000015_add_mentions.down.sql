@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS comment_mentions;
+
+DROP TABLE IF EXISTS post_mentions;
+
+ALTER TABLE
+    comments
+DROP
+    COLUMN entities;
+
+ALTER TABLE
+    posts
+DROP
+    COLUMN entities;
@@ -0,0 +1,10 @@
+ALTER TABLE
+    users
+DROP
+    COLUMN dm_followed_only;
+
+DROP TABLE IF EXISTS messages;
+
+DROP TABLE IF EXISTS conversation_participants;
+
+DROP TABLE IF EXISTS conversations;
@@ -0,0 +1,32 @@
+DROP TRIGGER IF EXISTS posts_count ON posts;
+
+DROP FUNCTION IF EXISTS update_posts_count;
+
+DROP TRIGGER IF EXISTS followers_counts ON followers;
+
+DROP FUNCTION IF EXISTS update_follow_counts;
+
+DROP INDEX IF EXISTS idx_followers_follower_id_id;
+
+DROP INDEX IF EXISTS idx_followers_user_id_id;
+
+DROP INDEX IF EXISTS idx_followers_id;
+
+ALTER TABLE
+    followers
+DROP
+    COLUMN id;
+
+ALTER TABLE
+    followers
+DROP
+    CONSTRAINT followers_no_self_follow;
+
+ALTER TABLE
+    users
+DROP
+    COLUMN posts_count,
+DROP
+    COLUMN following_count,
+DROP
+    COLUMN followers_count;
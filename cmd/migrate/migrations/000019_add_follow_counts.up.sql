@@ -0,0 +1,67 @@
+-- Denormalized counters, kept in sync by triggers so that cascading deletes
+-- are counted as well
+
+ALTER TABLE
+    users
+ADD
+    COLUMN followers_count BIGINT NOT NULL DEFAULT 0,
+ADD
+    COLUMN following_count BIGINT NOT NULL DEFAULT 0,
+ADD
+    COLUMN posts_count BIGINT NOT NULL DEFAULT 0;
+
+DELETE FROM followers WHERE user_id = follower_id;
+
+ALTER TABLE
+    followers
+ADD
+    CONSTRAINT followers_no_self_follow CHECK (user_id <> follower_id);
+
+-- Cursor for the keyset pagination of followers and following lists
+ALTER TABLE
+    followers
+ADD
+    COLUMN id BIGSERIAL NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_followers_id ON followers (id);
+
+CREATE INDEX IF NOT EXISTS idx_followers_user_id_id ON followers (user_id, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id_id ON followers (follower_id, id DESC);
+
+UPDATE users SET
+    followers_count = (SELECT COUNT(*) FROM followers f WHERE f.user_id = users.id),
+    following_count = (SELECT COUNT(*) FROM followers f WHERE f.follower_id = users.id),
+    posts_count = (SELECT COUNT(*) FROM posts p WHERE p.user_id = users.id);
+
+CREATE OR REPLACE FUNCTION update_follow_counts() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET followers_count = followers_count + 1 WHERE id = NEW.user_id;
+        UPDATE users SET following_count = following_count + 1 WHERE id = NEW.follower_id;
+    ELSE
+        UPDATE users SET followers_count = followers_count - 1 WHERE id = OLD.user_id;
+        UPDATE users SET following_count = following_count - 1 WHERE id = OLD.follower_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER followers_counts
+AFTER INSERT OR DELETE ON followers
+FOR EACH ROW EXECUTE FUNCTION update_follow_counts();
+
+CREATE OR REPLACE FUNCTION update_posts_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET posts_count = posts_count + 1 WHERE id = NEW.user_id;
+    ELSE
+        UPDATE users SET posts_count = posts_count - 1 WHERE id = OLD.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_count
+AFTER INSERT OR DELETE ON posts
+FOR EACH ROW EXECUTE FUNCTION update_posts_count();
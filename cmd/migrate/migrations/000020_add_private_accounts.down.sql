@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS follow_requests;
+
+ALTER TABLE
+    users
+DROP
+    COLUMN is_private;
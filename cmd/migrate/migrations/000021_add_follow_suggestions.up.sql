@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS follow_suggestions (
+    user_id BIGINT NOT NULL,
+    suggested_id BIGINT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    mutual_count BIGINT NOT NULL DEFAULT 0,
+    shared_tags_count BIGINT NOT NULL DEFAULT 0,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, suggested_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (suggested_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_suggestions_user_id_score ON follow_suggestions (user_id, score DESC);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_comments_created_at;
+
+ALTER TABLE
+    posts
+DROP
+    COLUMN locale;
@@ -0,0 +1,6 @@
+ALTER TABLE
+    posts
+ADD
+    COLUMN locale VARCHAR(35) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments (created_at);
@@ -0,0 +1,38 @@
+ALTER TABLE
+    users
+ADD
+    COLUMN display_name VARCHAR(100) NOT NULL DEFAULT '',
+ADD
+    COLUMN bio TEXT NOT NULL DEFAULT '',
+ADD
+    COLUMN website VARCHAR(255) NOT NULL DEFAULT '',
+ADD
+    COLUMN location VARCHAR(100) NOT NULL DEFAULT '',
+ADD
+    COLUMN avatar_url TEXT NOT NULL DEFAULT '',
+ADD
+    COLUMN username_changed_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- Former usernames, to redirect the links to a renamed profile
+CREATE TABLE IF NOT EXISTS username_history (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_history_username ON username_history (username);
+
+-- Pending email changes, the new email is used once its token is confirmed
+CREATE TABLE IF NOT EXISTS email_verifications (
+    token bytea PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    email citext NOT NULL,
+    expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications (user_id);
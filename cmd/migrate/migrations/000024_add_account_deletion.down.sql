@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS data_exports;
+
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+
+ALTER TABLE
+    users
+DROP
+    COLUMN deleted_at,
+DROP
+    COLUMN deletion_scheduled_at;
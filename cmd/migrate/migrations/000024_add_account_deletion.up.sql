@@ -0,0 +1,28 @@
+ALTER TABLE
+    users
+ADD
+    COLUMN deletion_scheduled_at TIMESTAMP(0) WITH TIME ZONE,
+ADD
+    COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users (deletion_scheduled_at)
+WHERE
+    deletion_scheduled_at IS NOT NULL;
+
+-- Requested data exports, built in the background and downloaded with a token
+CREATE TABLE IF NOT EXISTS data_exports (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    token bytea UNIQUE,
+    file_key TEXT NOT NULL DEFAULT '',
+    expiry TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP(0) WITH TIME ZONE,
+    completed_at TIMESTAMP(0) WITH TIME ZONE,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports (user_id);
+CREATE INDEX IF NOT EXISTS idx_data_exports_status ON data_exports (status);
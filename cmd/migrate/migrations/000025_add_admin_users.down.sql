@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS audit_events;
+
+DROP TABLE IF EXISTS sessions;
+
+ALTER TABLE
+    users
+DROP
+    COLUMN tokens_valid_after;
@@ -0,0 +1,36 @@
+-- Tokens issued before this time are rejected, to log a user out everywhere
+ALTER TABLE
+    users
+ADD
+    COLUMN tokens_valid_after TIMESTAMP WITH TIME ZONE;
+
+-- Issued tokens, to show where a user is logged in
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP(0) WITH TIME ZONE,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id_id ON sessions (user_id, id DESC);
+
+-- Changes made by administrators
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    actor_id BIGINT,
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id BIGINT NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
@@ -0,0 +1,29 @@
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+
+DROP TRIGGER IF EXISTS audit_events_no_update_delete ON audit_events;
+
+DROP FUNCTION IF EXISTS audit_events_append_only();
+
+DROP INDEX IF EXISTS idx_audit_events_created_at;
+
+DROP INDEX IF EXISTS idx_audit_events_action;
+
+ALTER TABLE
+    audit_events
+DROP
+    COLUMN hash,
+DROP
+    COLUMN prev_hash,
+DROP
+    COLUMN ip,
+DROP
+    COLUMN request_id,
+DROP
+    COLUMN after,
+DROP
+    COLUMN before;
+
+ALTER TABLE
+    audit_events
+ADD
+    CONSTRAINT audit_events_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE SET NULL NOT VALID;
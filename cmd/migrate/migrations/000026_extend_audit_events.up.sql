@@ -0,0 +1,38 @@
+-- The audit log outlives the users, deleting one must not update its events
+ALTER TABLE
+    audit_events
+DROP
+    CONSTRAINT IF EXISTS audit_events_actor_id_fkey;
+
+ALTER TABLE
+    audit_events
+ADD
+    COLUMN before JSONB,
+ADD
+    COLUMN after JSONB,
+ADD
+    COLUMN request_id VARCHAR(255) NOT NULL DEFAULT '',
+ADD
+    COLUMN ip VARCHAR(64) NOT NULL DEFAULT '',
+ADD
+    COLUMN prev_hash VARCHAR(64),
+ADD
+    COLUMN hash VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- Events are only ever appended
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_delete
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
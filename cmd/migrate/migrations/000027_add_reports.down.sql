@@ -0,0 +1,18 @@
+ALTER TABLE
+    notifications
+DROP
+    COLUMN case_id;
+
+DROP TABLE IF EXISTS reports;
+
+DROP TABLE IF EXISTS moderation_cases;
+
+ALTER TABLE
+    comments
+DROP
+    COLUMN hidden_at;
+
+ALTER TABLE
+    posts
+DROP
+    COLUMN hidden_at;
@@ -0,0 +1,57 @@
+-- Content hidden by a moderator, still visible to its author
+ALTER TABLE
+    posts
+ADD
+    COLUMN hidden_at TIMESTAMP(0) WITH TIME ZONE;
+
+ALTER TABLE
+    comments
+ADD
+    COLUMN hidden_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- The reports about the same content are gathered in one case
+CREATE TABLE IF NOT EXISTS moderation_cases (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    target_type VARCHAR(16) NOT NULL,
+    target_id BIGINT NOT NULL,
+    target_user_id BIGINT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'open',
+    assignee_id BIGINT,
+    action VARCHAR(16) NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    reports_count INT NOT NULL DEFAULT 0,
+    resolved_by BIGINT,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP(0) WITH TIME ZONE,
+
+    FOREIGN KEY (target_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (assignee_id) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (resolved_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+-- Only one pending case per content
+CREATE UNIQUE INDEX IF NOT EXISTS idx_moderation_cases_pending_target ON moderation_cases (target_type, target_id)
+WHERE
+    status IN ('open', 'in_review');
+
+CREATE INDEX IF NOT EXISTS idx_moderation_cases_status_id ON moderation_cases (status, id DESC);
+
+CREATE TABLE IF NOT EXISTS reports (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    case_id BIGINT NOT NULL,
+    reporter_id BIGINT NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    UNIQUE (case_id, reporter_id),
+    FOREIGN KEY (case_id) REFERENCES moderation_cases (id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Notifications about a case: warnings and report outcomes
+ALTER TABLE
+    notifications
+ADD
+    COLUMN case_id BIGINT REFERENCES moderation_cases (id) ON DELETE CASCADE;
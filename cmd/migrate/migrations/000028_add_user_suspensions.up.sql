@@ -0,0 +1,25 @@
+-- Suspensions lock a user out, read-only restrictions only forbid posting
+-- and commenting. They end on their own at ends_at, or when lifted.
+CREATE TABLE IF NOT EXISTS user_suspensions (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    reason TEXT NOT NULL,
+    starts_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ends_at TIMESTAMP(0) WITH TIME ZONE,
+    issued_by BIGINT,
+    lifted_at TIMESTAMP(0) WITH TIME ZONE,
+    lifted_by BIGINT,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CHECK (ends_at IS NULL OR ends_at > starts_at),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (issued_by) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (lifted_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_suspensions_user_id_id ON user_suspensions (user_id, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_user_suspensions_pending ON user_suspensions (user_id)
+WHERE
+    lifted_at IS NULL;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS content_filter_decisions;
+
+ALTER TABLE
+    moderation_cases
+DROP
+    COLUMN source;
@@ -0,0 +1,22 @@
+-- Cases opened by the content filters rather than by a report
+ALTER TABLE
+    moderation_cases
+ADD
+    COLUMN source VARCHAR(16) NOT NULL DEFAULT 'report';
+
+-- Verdicts of the content filters other than allow. The target is missing
+-- when the content was rejected, and never saved.
+CREATE TABLE IF NOT EXISTS content_filter_decisions (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    target_type VARCHAR(16) NOT NULL,
+    target_id BIGINT,
+    user_id BIGINT NOT NULL,
+    filter VARCHAR(32) NOT NULL,
+    verdict VARCHAR(16) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_filter_decisions_user_id ON content_filter_decisions (user_id);
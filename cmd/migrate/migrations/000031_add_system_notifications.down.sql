@@ -0,0 +1,6 @@
+DELETE FROM notifications WHERE actor_id IS NULL;
+
+ALTER TABLE
+    notifications
+ALTER COLUMN
+    actor_id SET NOT NULL;
@@ -0,0 +1,6 @@
+-- The notifications from the moderators, warnings and report outcomes, come
+-- from the team rather than from one moderator: they have no actor
+ALTER TABLE
+    notifications
+ALTER COLUMN
+    actor_id DROP NOT NULL;
@@ -10,5 +10,5 @@ func (t *TestAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 }
 
 func (t *TestAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
-	return nil, nil
+	return &jwt.Token{Valid: true, Claims: jwt.MapClaims{"sub": float64(1)}}, nil
 }
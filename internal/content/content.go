@@ -0,0 +1,189 @@
+package content
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+const (
+	EntityMention = "mention"
+	EntityHashtag = "hashtag"
+
+	maxHashtagLength = 128
+)
+
+// Entity is a mention or hashtag found in a piece of content.
+// Start and End are rune offsets into the content, End is exclusive.
+type Entity struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	UserID int64  `json:"user_id,omitempty"`
+}
+
+type Entities []Entity
+
+// Parse extracts @username mentions and #hashtags from text.
+// A marker only starts an entity at the beginning of the text or after a
+// character that can't be part of a word, so emails like a@b.com are skipped.
+func Parse(text string) Entities {
+	runes := []rune(text)
+	entities := Entities{}
+
+	for i := 0; i < len(runes); i++ {
+		var entityType string
+		switch runes[i] {
+		case '@':
+			entityType = EntityMention
+		case '#':
+			entityType = EntityHashtag
+		default:
+			continue
+		}
+
+		if i > 0 && isWordRune(runes[i-1]) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		if end == i+1 {
+			continue
+		}
+		if entityType == EntityHashtag && end-(i+1) > maxHashtagLength {
+			i = end - 1
+			continue
+		}
+
+		entities = append(entities, Entity{
+			Type:  entityType,
+			Text:  string(runes[i+1 : end]),
+			Start: i,
+			End:   end,
+		})
+		i = end - 1
+	}
+
+	return entities
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Usernames returns the distinct usernames mentioned, in order of appearance.
+func (e Entities) Usernames() []string {
+	return e.distinct(EntityMention, false)
+}
+
+// Hashtags returns the distinct lowercased hashtags, in order of appearance.
+func (e Entities) Hashtags() []string {
+	return e.distinct(EntityHashtag, true)
+}
+
+// MentionedUserIDs returns the distinct IDs of resolved mentions.
+func (e Entities) MentionedUserIDs() []int64 {
+	seen := map[int64]bool{}
+	ids := []int64{}
+	for _, entity := range e {
+		if entity.Type != EntityMention || entity.UserID == 0 || seen[entity.UserID] {
+			continue
+		}
+		seen[entity.UserID] = true
+		ids = append(ids, entity.UserID)
+	}
+	return ids
+}
+
+// Resolve sets the user ID on every mention found in ids and drops the
+// mentions that don't match an existing user.
+func (e Entities) Resolve(ids map[string]int64) Entities {
+	resolved := Entities{}
+	for _, entity := range e {
+		if entity.Type == EntityMention {
+			userID, ok := ids[entity.Text]
+			if !ok {
+				continue
+			}
+			entity.UserID = userID
+		}
+		resolved = append(resolved, entity)
+	}
+	return resolved
+}
+
+func (e Entities) distinct(entityType string, lower bool) []string {
+	seen := map[string]bool{}
+	values := []string{}
+	for _, entity := range e {
+		if entity.Type != entityType {
+			continue
+		}
+		value := entity.Text
+		if lower {
+			value = strings.ToLower(value)
+		}
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		values = append(values, value)
+	}
+	return values
+}
+
+// MergeTags appends hashtags to tags, skipping the ones already present.
+func MergeTags(tags []string, hashtags []string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+	for _, tag := range append(append([]string{}, tags...), hashtags...) {
+		if seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		merged = append(merged, tag)
+	}
+	return merged
+}
+
+// RemoveTags returns tags without the ones found in removed.
+func RemoveTags(tags []string, removed []string) []string {
+	skip := map[string]bool{}
+	for _, tag := range removed {
+		skip[strings.ToLower(tag)] = true
+	}
+	kept := []string{}
+	for _, tag := range tags {
+		if !skip[strings.ToLower(tag)] {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+func (e Entities) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e)
+}
+
+func (e *Entities) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*e = Entities{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	default:
+		return errors.New("content: unsupported entities type")
+	}
+}
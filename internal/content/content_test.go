@@ -0,0 +1,40 @@
+package content
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("should extract mentions and hashtags with offsets", func(t *testing.T) {
+		entities := Parse("hi @alice, meet @bob #Go #go")
+
+		want := Entities{
+			{Type: EntityMention, Text: "alice", Start: 3, End: 9},
+			{Type: EntityMention, Text: "bob", Start: 16, End: 20},
+			{Type: EntityHashtag, Text: "Go", Start: 21, End: 24},
+			{Type: EntityHashtag, Text: "go", Start: 25, End: 28},
+		}
+		if !reflect.DeepEqual(entities, want) {
+			t.Errorf("WANT %v BUT GOT %v", want, entities)
+		}
+
+		if tags := entities.Hashtags(); !reflect.DeepEqual(tags, []string{"go"}) {
+			t.Errorf("WANT [go] BUT GOT %v", tags)
+		}
+	})
+
+	t.Run("should skip emails and lone markers", func(t *testing.T) {
+		entities := Parse("mail me at gopher@golang.org # @ ")
+		if len(entities) != 0 {
+			t.Errorf("WANT no entities BUT GOT %v", entities)
+		}
+	})
+
+	t.Run("should drop unresolved mentions", func(t *testing.T) {
+		entities := Parse("@alice @ghost").Resolve(map[string]int64{"alice": 7})
+		if ids := entities.MentionedUserIDs(); !reflect.DeepEqual(ids, []int64{7}) {
+			t.Errorf("WANT [7] BUT GOT %v", ids)
+		}
+	})
+}
@@ -4,10 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"time"
+
+	"github.com/XSAM/otelsql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 func New(connection string, maxOpenConns int, maxIdleConns int, maxIdleTime time.Duration) (*sql.DB, error) {
-	db, err := sql.Open("postgres", connection)
+	// every query is traced, with its SQL text but not its arguments
+	db, err := otelsql.Open("postgres", connection,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,41 @@
+// Package export builds the archives of the user data exports.
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// File is a JSON document of an archive.
+type File struct {
+	Name string
+	Data any
+}
+
+// WriteZIP writes the files to w as a ZIP archive of indented JSON documents,
+// in the given order.
+func WriteZIP(w io.Writer, files []File) error {
+	archive := zip.NewWriter(w)
+	now := time.Now()
+
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.Name,
+			Method:   zip.Deflate,
+			Modified: now,
+		})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.Data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
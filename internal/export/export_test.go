@@ -0,0 +1,48 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteZIP(t *testing.T) {
+	files := []File{
+		{Name: "profile.json", Data: map[string]string{"username": "gopher"}},
+		{Name: "posts.json", Data: []int{1, 2, 3}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteZIP(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.File) != len(files) {
+		t.Fatalf("WANT %d FILES BUT GOT %d", len(files), len(archive.File))
+	}
+
+	for i, f := range archive.File {
+		if f.Name != files[i].Name {
+			t.Errorf("WANT %s BUT GOT %s", files[i].Name, f.Name)
+		}
+	}
+
+	r, err := archive.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var posts []int
+	if err := json.NewDecoder(r).Decode(&posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 3 || posts[2] != 3 {
+		t.Errorf("WANT [1 2 3] BUT GOT %v", posts)
+	}
+}
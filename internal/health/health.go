@@ -0,0 +1,122 @@
+// Package health checks the dependencies of the API for the readiness probe.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// CheckFunc checks a dependency, it fails when the dependency is unusable.
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is the outcome of a single check. The error stays out of the
+// JSON, it may tell about the infrastructure.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Err       error   `json:"-"`
+}
+
+// Report is the outcome of all the checks.
+type Report struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]CheckResult `json:"checks"`
+	CheckedAt time.Time              `json:"checked_at"`
+}
+
+func (r *Report) Healthy() bool {
+	return r.Status == StatusUp
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs its checks concurrently, every check within the timeout, and
+// keeps the report for ttl so the probes do not hammer the dependencies.
+type Checker struct {
+	timeout time.Duration
+	ttl     time.Duration
+	checks  []check
+	now     func() time.Time
+
+	mu   sync.Mutex
+	last *Report
+}
+
+func NewChecker(timeout time.Duration, ttl time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Register adds a check, before the checker is used.
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Run returns the latest report, running the checks again once it is older
+// than the ttl. A nil checker has nothing to check.
+func (c *Checker) Run(ctx context.Context) Report {
+	if c == nil {
+		return Report{Status: StatusUp, Checks: map[string]CheckResult{}, CheckedAt: time.Now()}
+	}
+
+	// the callers arriving during a run wait for its report
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last != nil && c.now().Sub(c.last.CheckedAt) < c.ttl {
+		return *c.last
+	}
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(c.checks)), CheckedAt: c.now()}
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.runCheck(ctx, check.fn)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range c.checks {
+		report.Checks[check.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	c.last = &report
+	return report
+}
+
+func (c *Checker) runCheck(ctx context.Context, fn CheckFunc) CheckResult {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := fn(ctx)
+	result := CheckResult{
+		Status:    StatusUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Err:       err,
+	}
+	if err != nil {
+		result.Status = StatusDown
+	}
+	return result
+}
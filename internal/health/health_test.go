@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewChecker(50*time.Millisecond, time.Minute)
+	c.now = func() time.Time { return now }
+
+	calls := 0
+	c.Register("db", func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+	c.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Register("down", func(ctx context.Context) error {
+		return errors.New("refused")
+	})
+
+	report := c.Run(ctx)
+	if report.Healthy() {
+		t.Error("WANT an unhealthy report")
+	}
+	want := map[string]string{"db": StatusUp, "slow": StatusDown, "down": StatusDown}
+	for name, status := range want {
+		if got := report.Checks[name].Status; got != status {
+			t.Errorf("%s: WANT %s BUT GOT %s", name, status, got)
+		}
+	}
+
+	c.Run(ctx)
+	if calls != 1 {
+		t.Errorf("WANT the report cached BUT GOT %d runs", calls)
+	}
+	now = now.Add(time.Minute)
+	c.Run(ctx)
+	if calls != 2 {
+		t.Errorf("WANT the checks run again after the ttl BUT GOT %d runs", calls)
+	}
+}
@@ -1,16 +1,34 @@
 package mailer
 
-import "embed"
+import (
+	"context"
+	"embed"
+	"net"
+)
 
 const (
 	FromName            = "GopherSocial"
 	maxRetries          = 3
 	UserWelcomeTemplate = "user_invitation.tmpl"
+	EmailChangeTemplate = "email_verification.tmpl"
+	DataExportTemplate  = "data_export.tmpl"
 )
 
 //go:embed templates
 var FS embed.FS
 
 type Client interface {
-	Send(templateFile string, username string, email string, data any, isSanbox bool) (int, error)
+	Send(ctx context.Context, templateFile string, username string, email string, data any, isSanbox bool) (int, error)
+	// Ping checks that the mail transport can be reached, nothing is sent.
+	Ping(ctx context.Context) error
+}
+
+// dial opens and closes a connection to the transport at address.
+func dial(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
 }
@@ -2,11 +2,19 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	gomail "gopkg.in/mail.v2"
+	"net"
+	"strconv"
 	"text/template"
 )
 
+const (
+	mailtrapHost = "live.smtp.mailtrap.io"
+	mailtrapPort = 587
+)
+
 type mailtrapClient struct {
 	fromEmail string
 	apiKey    string
@@ -23,7 +31,7 @@ func NewMailTrapClient(apiKey, fromEmail string) (mailtrapClient, error) {
 	}, nil
 }
 
-func (m mailtrapClient) Send(templateFile string, username string, email string, data any, isSanbox bool) (int, error) {
+func (m mailtrapClient) Send(ctx context.Context, templateFile string, username string, email string, data any, isSanbox bool) (int, error) {
 	// Template parsing and building
 	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
 	if err != nil {
@@ -53,7 +61,7 @@ func (m mailtrapClient) Send(templateFile string, username string, email string,
 
 	message.AddAlternative("text/html", body.String())
 
-	dialer := gomail.NewDialer("live.smtp.mailtrap.io", 587, "api", m.apiKey)
+	dialer := gomail.NewDialer(mailtrapHost, mailtrapPort, "api", m.apiKey)
 
 	if err := dialer.DialAndSend(message); err != nil {
 		return -1, err
@@ -61,3 +69,7 @@ func (m mailtrapClient) Send(templateFile string, username string, email string,
 
 	return 200, nil
 }
+
+func (m mailtrapClient) Ping(ctx context.Context) error {
+	return dial(ctx, net.JoinHostPort(mailtrapHost, strconv.Itoa(mailtrapPort)))
+}
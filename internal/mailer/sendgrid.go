@@ -2,6 +2,7 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"time"
@@ -21,7 +22,7 @@ func NewSendGrid(apiKey string, fromEmail string) *SendGridMailer {
 	return &SendGridMailer{fromEmail: fromEmail, apiKey: apiKey, client: client}
 }
 
-func (s *SendGridMailer) Send(templateFile string, username string, email string, data any, isSanbox bool) (int, error) {
+func (s *SendGridMailer) Send(ctx context.Context, templateFile string, username string, email string, data any, isSanbox bool) (int, error) {
 	from := mail.NewEmail(FromName, s.fromEmail)
 	to := mail.NewEmail(username, email)
 
@@ -51,7 +52,7 @@ func (s *SendGridMailer) Send(templateFile string, username string, email string
 	})
 
 	for i := range maxRetries {
-		response, err := s.client.Send(message)
+		response, err := s.client.SendWithContext(ctx, message)
 		if err != nil {
 			// exponential backoff
 			time.Sleep(time.Duration(i+1) * time.Second)
@@ -63,3 +64,7 @@ func (s *SendGridMailer) Send(templateFile string, username string, email string
 
 	return -1, fmt.Errorf("failed to send email after %d retries", maxRetries)
 }
+
+func (s *SendGridMailer) Ping(ctx context.Context) error {
+	return dial(ctx, "api.sendgrid.com:443")
+}
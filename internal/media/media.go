@@ -0,0 +1,88 @@
+// Package media processes and stores the files uploaded by users.
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+
+	// decoders of the accepted upload formats
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// MaxAvatarSize is the largest avatar upload accepted, in bytes.
+	MaxAvatarSize = 5 << 20
+	// MaxAvatarDimension bounds the width and height of an uploaded avatar,
+	// so a small file cannot decode into a huge image.
+	MaxAvatarDimension = 4096
+	// AvatarSize is the width and height of a processed avatar.
+	AvatarSize = 256
+
+	avatarQuality = 85
+)
+
+var (
+	ErrNotFound          = errors.New("file not found")
+	ErrTooLarge          = errors.New("file is too large")
+	ErrUnsupportedFormat = errors.New("unsupported image format, use jpeg, png or gif")
+)
+
+// Storage keeps the processed files and tells where they are served from.
+type Storage interface {
+	Put(ctx context.Context, key string, contentType string, data []byte) (string, error)
+	// Open returns the content of a file, ErrNotFound when there is none.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// Key returns the key of a file from its URL, false when the URL is not
+	// one of this storage.
+	Key(url string) (string, bool)
+}
+
+// ProcessAvatar turns an uploaded image into a square JPEG avatar: the image
+// is cropped to its center square and scaled to AvatarSize. Encoding a new
+// image also drops the metadata of the upload, like its location.
+func ProcessAvatar(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxAvatarSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxAvatarSize {
+		return nil, ErrTooLarge
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width > MaxAvatarDimension || config.Height > MaxAvatarDimension {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, AvatarSize, AvatarSize))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, centerSquare(src.Bounds()), draw.Src, nil)
+
+	out := new(bytes.Buffer)
+	if err := jpeg.Encode(out, dst, &jpeg.Options{Quality: avatarQuality}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func centerSquare(bounds image.Rectangle) image.Rectangle {
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
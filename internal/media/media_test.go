@@ -0,0 +1,77 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestProcessAvatar(t *testing.T) {
+	t.Run("should crop and scale the image to a square avatar", func(t *testing.T) {
+		src := image.NewRGBA(image.Rect(0, 0, 600, 300))
+		for x := 0; x < 600; x++ {
+			for y := 0; y < 300; y++ {
+				src.Set(x, y, color.RGBA{R: 200, A: 255})
+			}
+		}
+		upload := new(bytes.Buffer)
+		if err := png.Encode(upload, src); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ProcessAvatar(upload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		avatar, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if avatar.Bounds().Dx() != AvatarSize || avatar.Bounds().Dy() != AvatarSize {
+			t.Errorf("WANT %dx%d BUT GOT %v", AvatarSize, AvatarSize, avatar.Bounds())
+		}
+	})
+
+	t.Run("should reject files which are not images", func(t *testing.T) {
+		_, err := ProcessAvatar(strings.NewReader("not an image"))
+		if err != ErrUnsupportedFormat {
+			t.Errorf("WANT %v BUT GOT %v", ErrUnsupportedFormat, err)
+		}
+	})
+
+	t.Run("should reject files too large", func(t *testing.T) {
+		_, err := ProcessAvatar(bytes.NewReader(make([]byte, MaxAvatarSize+1)))
+		if err != ErrTooLarge {
+			t.Errorf("WANT %v BUT GOT %v", ErrTooLarge, err)
+		}
+	})
+}
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocalStorage(t.TempDir(), "http://localhost/v1/media/")
+
+	url, err := s.Put(ctx, "avatars/1.jpg", "image/jpeg", []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "http://localhost/v1/media/avatars/1.jpg" {
+		t.Errorf("WANT the media URL BUT GOT %s", url)
+	}
+
+	key, ok := s.Key(url)
+	if !ok || key != "avatars/1.jpg" {
+		t.Errorf("WANT avatars/1.jpg BUT GOT %s", key)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Key("https://example.com/avatars/1.jpg"); ok {
+		t.Error("WANT foreign URLs to have no key")
+	}
+}
@@ -0,0 +1,64 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Blocklist rejects the content containing one of its words, matched as
+// whole words regardless of case, or matching one of its patterns.
+type Blocklist struct {
+	words    *regexp.Regexp
+	patterns []*regexp.Regexp
+	verdict  Verdict
+}
+
+// NewBlocklist compiles the words and the regular expressions of the list.
+// The content they match gets the given verdict.
+func NewBlocklist(words []string, patterns []string, verdict Verdict) (*Blocklist, error) {
+	b := &Blocklist{verdict: verdict}
+
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) > 0 {
+		b.words = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("blocklist pattern %q: %w", pattern, err)
+		}
+		b.patterns = append(b.patterns, re)
+	}
+
+	return b, nil
+}
+
+func (b *Blocklist) Name() string {
+	return "blocklist"
+}
+
+func (b *Blocklist) Check(ctx context.Context, content *Content) (Verdict, string, error) {
+	text := content.Text()
+	if b.words != nil {
+		if word := b.words.FindString(text); word != "" {
+			return b.verdict, fmt.Sprintf("blocked word %q", strings.ToLower(word)), nil
+		}
+	}
+	for _, re := range b.patterns {
+		if re.MatchString(text) {
+			return b.verdict, fmt.Sprintf("blocked pattern %q", re.String()), nil
+		}
+	}
+	return Allow, "", nil
+}
@@ -0,0 +1,111 @@
+package moderation
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BurstDetector tracks what every user posted within a sliding window: the
+// same text posted twice is rejected, and the content past the limit is held
+// for review. Only the content recorded once saved counts, and an edit is not
+// a new post, it is allowed. It keeps the history of a single process.
+type BurstDetector struct {
+	window time.Duration
+	limit  int
+	now    func() time.Time
+
+	mu        sync.Mutex
+	history   map[int64][]burstEntry
+	lastSweep time.Time
+}
+
+type burstEntry struct {
+	digest [sha256.Size]byte
+	at     time.Time
+}
+
+func NewBurstDetector(window time.Duration, limit int) *BurstDetector {
+	return &BurstDetector{
+		window:  window,
+		limit:   limit,
+		now:     time.Now,
+		history: map[int64][]burstEntry{},
+	}
+}
+
+func (d *BurstDetector) Name() string {
+	return "burst"
+}
+
+func (d *BurstDetector) Check(ctx context.Context, content *Content) (Verdict, string, error) {
+	if content.ID != 0 {
+		return Allow, "", nil
+	}
+	now := d.now()
+	digest := burstDigest(content)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(now)
+	entries := recent(d.history[content.UserID], now.Add(-d.window))
+	d.history[content.UserID] = entries
+
+	for _, entry := range entries {
+		if entry.digest == digest {
+			return Reject, "duplicate content", nil
+		}
+	}
+	if d.limit > 0 && len(entries) >= d.limit {
+		return Hold, fmt.Sprintf("more than %d posts in %s", d.limit, d.window), nil
+	}
+	return Allow, "", nil
+}
+
+// Record adds the saved content to the history of its author.
+func (d *BurstDetector) Record(content *Content) {
+	if content.ID != 0 {
+		return
+	}
+	now := d.now()
+	digest := burstDigest(content)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entries := recent(d.history[content.UserID], now.Add(-d.window))
+	d.history[content.UserID] = append(entries, burstEntry{digest: digest, at: now})
+}
+
+func burstDigest(content *Content) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join(strings.Fields(strings.ToLower(content.Text())), " ")))
+}
+
+// sweep forgets the users who did not post within the window, once per
+// window.
+func (d *BurstDetector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.window {
+		return
+	}
+	d.lastSweep = now
+	for userID, entries := range d.history {
+		if len(recent(entries, now.Add(-d.window))) == 0 {
+			delete(d.history, userID)
+		}
+	}
+}
+
+// recent drops the entries older than since, the entries are in
+// chronological order.
+func recent(entries []burstEntry, since time.Time) []burstEntry {
+	for i, entry := range entries {
+		if entry.at.After(since) {
+			return entries[i:]
+		}
+	}
+	return nil
+}
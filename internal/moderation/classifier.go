@@ -0,0 +1,83 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Classifier asks an external service for its verdict. The service receives
+// a JSON object with the kind, user_id, title and body of the content, and
+// answers with a verdict (allow, hold or reject) and a reason.
+type Classifier struct {
+	url    string
+	client *http.Client
+}
+
+type classifierRequest struct {
+	Kind   string `json:"kind"`
+	UserID int64  `json:"user_id"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+type classifierResponse struct {
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason"`
+}
+
+func NewClassifier(url string, timeout time.Duration) *Classifier {
+	// the trace context goes along with the requests
+	transport := otelhttp.NewTransport(http.DefaultTransport)
+	return &Classifier{
+		url:    url,
+		client: &http.Client{Timeout: timeout, Transport: transport},
+	}
+}
+
+func (c *Classifier) Name() string {
+	return "classifier"
+}
+
+func (c *Classifier) Check(ctx context.Context, content *Content) (Verdict, string, error) {
+	body, err := json.Marshal(classifierRequest{
+		Kind:   content.Kind,
+		UserID: content.UserID,
+		Title:  content.Title,
+		Body:   content.Body,
+	})
+	if err != nil {
+		return Allow, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return Allow, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return Allow, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return Allow, "", fmt.Errorf("classifier answered %s", res.Status)
+	}
+
+	var answer classifierResponse
+	if err := json.NewDecoder(res.Body).Decode(&answer); err != nil {
+		return Allow, "", err
+	}
+	verdict, err := ParseVerdict(answer.Verdict)
+	if err != nil {
+		return Allow, "", err
+	}
+	return verdict, answer.Reason, nil
+}
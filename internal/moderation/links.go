@@ -0,0 +1,76 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var linkHostRegexp = regexp.MustCompile(`(?i)\b(?:https?://)?((?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,})(?::\d+)?(?:[/?#]\S*)?`)
+
+// LinkFilter checks the domains of the links against a reputation list: the
+// blocked domains are rejected, the suspicious ones held for review. A domain
+// covers its subdomains.
+type LinkFilter struct {
+	blocked    map[string]bool
+	suspicious map[string]bool
+}
+
+func NewLinkFilter(blocked []string, suspicious []string) *LinkFilter {
+	return &LinkFilter{
+		blocked:    domainSet(blocked),
+		suspicious: domainSet(suspicious),
+	}
+}
+
+func domainSet(domains []string) map[string]bool {
+	set := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			set[strings.TrimPrefix(domain, ".")] = true
+		}
+	}
+	return set
+}
+
+func (f *LinkFilter) Name() string {
+	return "links"
+}
+
+func (f *LinkFilter) Check(ctx context.Context, content *Content) (Verdict, string, error) {
+	verdict, reason := Allow, ""
+	for _, host := range linkHosts(content.Text()) {
+		switch {
+		case matchDomain(f.blocked, host):
+			return Reject, fmt.Sprintf("blocked domain %q", host), nil
+		case verdict == Allow && matchDomain(f.suspicious, host):
+			verdict, reason = Hold, fmt.Sprintf("suspicious domain %q", host)
+		}
+	}
+	return verdict, reason, nil
+}
+
+// linkHosts returns the lowercased hosts of the links in text.
+func linkHosts(text string) []string {
+	hosts := []string{}
+	for _, match := range linkHostRegexp.FindAllStringSubmatch(text, -1) {
+		hosts = append(hosts, strings.ToLower(match[1]))
+	}
+	return hosts
+}
+
+// matchDomain reports whether host is one of the domains or a subdomain of
+// one of them.
+func matchDomain(domains map[string]bool, host string) bool {
+	for {
+		if domains[host] {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
@@ -0,0 +1,165 @@
+// Package moderation screens the content of the users before it is saved. A
+// pipeline runs a chain of filters, each of them allows the content, holds it
+// for a moderator to review or rejects it, and the most severe verdict wins.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Verdict is the outcome of a filter, from the mildest to the most severe.
+type Verdict int
+
+const (
+	Allow Verdict = iota
+	Hold
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Allow:
+		return "allow"
+	case Hold:
+		return "hold"
+	case Reject:
+		return "reject"
+	default:
+		return fmt.Sprintf("verdict(%d)", int(v))
+	}
+}
+
+func ParseVerdict(s string) (Verdict, error) {
+	switch strings.ToLower(s) {
+	case "allow":
+		return Allow, nil
+	case "hold":
+		return Hold, nil
+	case "reject":
+		return Reject, nil
+	default:
+		return Allow, fmt.Errorf("unknown verdict %q", s)
+	}
+}
+
+const (
+	KindPost    = "post"
+	KindComment = "comment"
+)
+
+// Content is a post or a comment about to be saved. ID is set when an
+// existing post or comment is edited, it is zero for new content.
+type Content struct {
+	Kind   string
+	ID     int64
+	UserID int64
+	Title  string
+	Body   string
+}
+
+// Text is everything the user wrote, the title along with the body.
+func (c *Content) Text() string {
+	if c.Title == "" {
+		return c.Body
+	}
+	return c.Title + "\n" + c.Body
+}
+
+// Decision is the verdict of one filter on the content. Err is set when the
+// filter failed, the verdict is then the one of the pipeline for failures.
+type Decision struct {
+	Filter  string
+	Verdict Verdict
+	Reason  string
+	Err     error
+}
+
+// Filter screens content. It returns Allow with no reason when it has nothing
+// against the content.
+type Filter interface {
+	Name() string
+	Check(ctx context.Context, content *Content) (Verdict, string, error)
+}
+
+// Recorder is a filter keeping track of the content it screened. The content
+// is recorded once it is saved, the content rejected or lost to a failure
+// does not count.
+type Recorder interface {
+	Record(content *Content)
+}
+
+// Result is the outcome of the pipeline: the most severe verdict and the
+// decisions of the filters that did not allow the content.
+type Result struct {
+	Verdict   Verdict
+	Decisions []Decision
+}
+
+// Reason sums up why the content was not allowed.
+func (r *Result) Reason() string {
+	reasons := make([]string, 0, len(r.Decisions))
+	for _, d := range r.Decisions {
+		if d.Verdict == r.Verdict {
+			reasons = append(reasons, d.Reason)
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Pipeline runs its filters in order, it stops at the first rejection.
+type Pipeline struct {
+	filters []Filter
+	// onError is the verdict of a filter that failed.
+	onError Verdict
+}
+
+func NewPipeline(onError Verdict, filters ...Filter) *Pipeline {
+	return &Pipeline{
+		filters: filters,
+		onError: onError,
+	}
+}
+
+// Run screens the content. A nil pipeline allows everything.
+func (p *Pipeline) Run(ctx context.Context, content *Content) Result {
+	result := Result{Verdict: Allow, Decisions: []Decision{}}
+	if p == nil {
+		return result
+	}
+
+	for _, filter := range p.filters {
+		verdict, reason, err := filter.Check(ctx, content)
+		if err != nil {
+			verdict, reason = p.onError, fmt.Sprintf("%s failed", filter.Name())
+		}
+		if verdict == Allow {
+			continue
+		}
+
+		result.Decisions = append(result.Decisions, Decision{
+			Filter:  filter.Name(),
+			Verdict: verdict,
+			Reason:  reason,
+			Err:     err,
+		})
+		result.Verdict = max(result.Verdict, verdict)
+		if verdict == Reject {
+			break
+		}
+	}
+	return result
+}
+
+// Record tells the filters keeping track of the content that it was saved.
+func (p *Pipeline) Record(content *Content) {
+	if p == nil {
+		return
+	}
+	for _, filter := range p.filters {
+		if recorder, ok := filter.(Recorder); ok {
+			recorder.Record(content)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type staticFilter struct {
+	verdict Verdict
+	err     error
+}
+
+func (f staticFilter) Name() string {
+	return "static"
+}
+
+func (f staticFilter) Check(ctx context.Context, content *Content) (Verdict, string, error) {
+	return f.verdict, f.verdict.String(), f.err
+}
+
+func TestPipeline(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should keep the most severe verdict and stop at a rejection", func(t *testing.T) {
+		p := NewPipeline(Allow, staticFilter{verdict: Hold}, staticFilter{verdict: Reject}, staticFilter{verdict: Hold})
+		result := p.Run(ctx, &Content{Body: "hello"})
+
+		if result.Verdict != Reject {
+			t.Errorf("WANT %s BUT GOT %s", Reject, result.Verdict)
+		}
+		if len(result.Decisions) != 2 {
+			t.Errorf("WANT 2 decisions BUT GOT %v", result.Decisions)
+		}
+	})
+
+	t.Run("should give failing filters the verdict for failures", func(t *testing.T) {
+		p := NewPipeline(Hold, staticFilter{err: errors.New("down")})
+		result := p.Run(ctx, &Content{Body: "hello"})
+
+		if result.Verdict != Hold || result.Decisions[0].Err == nil {
+			t.Errorf("WANT a failed hold BUT GOT %v", result.Decisions)
+		}
+	})
+
+	t.Run("should allow everything without a pipeline", func(t *testing.T) {
+		var p *Pipeline
+		if result := p.Run(ctx, &Content{Body: "hello"}); result.Verdict != Allow {
+			t.Errorf("WANT %s BUT GOT %s", Allow, result.Verdict)
+		}
+	})
+}
+
+func TestBlocklist(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewBlocklist([]string{"spam"}, []string{`(?i)buy\s+now`}, Reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]Verdict{
+		"SPAM everywhere":      Reject,
+		"spammer is not spam?": Reject,
+		"a spammer":            Allow,
+		"Buy   now!":           Reject,
+		"nothing to see":       Allow,
+	}
+	for text, want := range tests {
+		if got, _, _ := b.Check(ctx, &Content{Body: text}); got != want {
+			t.Errorf("%q: WANT %s BUT GOT %s", text, want, got)
+		}
+	}
+
+	if _, err := NewBlocklist(nil, []string{"("}, Reject); err == nil {
+		t.Error("WANT an error for an invalid pattern")
+	}
+}
+
+func TestLinkFilter(t *testing.T) {
+	ctx := context.Background()
+	f := NewLinkFilter([]string{"evil.com"}, []string{"bit.ly"})
+
+	tests := map[string]Verdict{
+		"see https://www.evil.com/page":       Reject,
+		"see http://bit.ly/x and notevil.com": Hold,
+		"see https://go.dev":                  Allow,
+		"see evil.com.example.org":            Allow,
+	}
+	for text, want := range tests {
+		if got, _, _ := f.Check(ctx, &Content{Body: text}); got != want {
+			t.Errorf("%q: WANT %s BUT GOT %s", text, want, got)
+		}
+	}
+}
+
+func TestBurstDetector(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := NewBurstDetector(time.Minute, 2)
+	d.now = func() time.Time { return now }
+
+	// the content is recorded when saved, that is unless it was rejected
+	check := func(userID int64, text string) Verdict {
+		content := &Content{UserID: userID, Body: text}
+		verdict, _, _ := d.Check(ctx, content)
+		if verdict != Reject {
+			d.Record(content)
+		}
+		return verdict
+	}
+
+	if got, _, _ := d.Check(ctx, &Content{UserID: 1, Body: "first"}); got != Allow {
+		t.Errorf("WANT %s BUT GOT %s", Allow, got)
+	}
+	if got := check(1, "first"); got != Allow {
+		t.Errorf("WANT %s for content never saved BUT GOT %s", Allow, got)
+	}
+	if got := check(1, "  FIRST "); got != Reject {
+		t.Errorf("WANT a duplicate %s BUT GOT %s", Reject, got)
+	}
+	if got := check(1, "second"); got != Allow {
+		t.Errorf("WANT %s BUT GOT %s", Allow, got)
+	}
+	if got := check(1, "third"); got != Hold {
+		t.Errorf("WANT a burst %s BUT GOT %s", Hold, got)
+	}
+	if got := check(2, "first"); got != Allow {
+		t.Errorf("WANT another user %s BUT GOT %s", Allow, got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got := check(1, "first"); got != Allow {
+		t.Errorf("WANT %s after the window BUT GOT %s", Allow, got)
+	}
+}
+
+func TestClassifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req classifierRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		verdict := "allow"
+		if req.Body == "toxic" {
+			verdict = "hold"
+		}
+		json.NewEncoder(w).Encode(classifierResponse{Verdict: verdict, Reason: "model"})
+	}))
+	defer server.Close()
+
+	c := NewClassifier(server.URL, time.Second)
+	if got, _, err := c.Check(context.Background(), &Content{Body: "toxic"}); err != nil || got != Hold {
+		t.Errorf("WANT %s BUT GOT %s (%v)", Hold, got, err)
+	}
+	if got, _, err := c.Check(context.Background(), &Content{Body: "fine"}); err != nil || got != Allow {
+		t.Errorf("WANT %s BUT GOT %s (%v)", Allow, got, err)
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter keeps the counters of a single process, used when the cache
+// is disabled and in tests.
+type MemoryLimiter struct {
+	algorithm Algorithm
+	now       func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+// memoryBucket holds the tokens and their last refill for the token bucket,
+// or the counts of the current and previous windows for the sliding window.
+type memoryBucket struct {
+	tokens   float64
+	window   int64
+	current  int64
+	previous int64
+	at       time.Time
+	expires  time.Time
+}
+
+func NewMemoryLimiter(algorithm Algorithm) (*MemoryLimiter, error) {
+	if !algorithm.Valid() {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", algorithm)
+	}
+	return &MemoryLimiter{
+		algorithm: algorithm,
+		now:       time.Now,
+		buckets:   map[string]*memoryBucket{},
+	}, nil
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(rule.Requests), at: now}
+		l.buckets[key] = bucket
+	}
+
+	if l.algorithm == TokenBucket {
+		return l.takeToken(bucket, rule, now), nil
+	}
+	return l.countRequest(bucket, rule, now), nil
+}
+
+func (l *MemoryLimiter) takeToken(bucket *memoryBucket, rule Rule, now time.Time) Result {
+	rate := float64(rule.Requests) / float64(rule.Window)
+	bucket.tokens = min(float64(rule.Requests), bucket.tokens+float64(now.Sub(bucket.at))*rate)
+	bucket.at = now
+	bucket.expires = now.Add(rule.Window)
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	return tokenBucketResult(rule, bucket.tokens, allowed)
+}
+
+func (l *MemoryLimiter) countRequest(bucket *memoryBucket, rule Rule, now time.Time) Result {
+	window := now.UnixNano() / int64(rule.Window)
+	switch window - bucket.window {
+	case 0:
+	case 1:
+		bucket.previous, bucket.current = bucket.current, 0
+	default:
+		bucket.previous, bucket.current = 0, 0
+	}
+	bucket.window = window
+	bucket.expires = now.Add(2 * rule.Window)
+
+	elapsed := time.Duration(now.UnixNano() - window*int64(rule.Window))
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	allowed := float64(bucket.previous)*weight+float64(bucket.current)+1 <= float64(rule.Requests)
+	if allowed {
+		bucket.current++
+	}
+	return slidingWindowResult(rule, bucket.current, bucket.previous, elapsed, allowed)
+}
+
+// sweep forgets the expired counters, once a minute.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if now.After(bucket.expires) {
+			delete(l.buckets, key)
+		}
+	}
+}
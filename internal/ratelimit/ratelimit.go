@@ -0,0 +1,143 @@
+// Package ratelimit counts the requests of the clients against limits. The
+// limits are kept either in Valkey, shared by all the API replicas, or in the
+// memory of a single process.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm is the way the requests are counted.
+type Algorithm string
+
+const (
+	// TokenBucket refills the bucket of a client steadily over the window, it
+	// lets a client spend its whole limit in a burst.
+	TokenBucket Algorithm = "token_bucket"
+	// SlidingWindow counts the requests of the current and previous fixed
+	// windows, weighting the previous one by how much it still overlaps.
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+func (a Algorithm) Valid() bool {
+	return a == TokenBucket || a == SlidingWindow
+}
+
+// What the clients are told apart by.
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyAPIKey = "api_key"
+)
+
+// Rule allows Requests per Window to every client, the clients being told
+// apart by Key. The zero Rule has no limit.
+type Rule struct {
+	Key      string
+	Requests int
+	Window   time.Duration
+}
+
+// ParseRule parses a rule written as key:requests/window, like ip:10/1m. An
+// empty string is the zero Rule.
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Rule{}, nil
+	}
+
+	key, limit, ok := strings.Cut(s, ":")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate limit %q: missing key", s)
+	}
+	if key != KeyIP && key != KeyUser && key != KeyAPIKey {
+		return Rule{}, fmt.Errorf("rate limit %q: unknown key %q", s, key)
+	}
+
+	requests, window, ok := strings.Cut(limit, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate limit %q: missing window", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Rule{}, fmt.Errorf("rate limit %q: invalid number of requests", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d < time.Second {
+		return Rule{}, fmt.Errorf("rate limit %q: invalid window", s)
+	}
+
+	return Rule{Key: key, Requests: n, Window: d}, nil
+}
+
+func (r Rule) Enabled() bool {
+	return r.Requests > 0
+}
+
+// Policy describes the rule for the RateLimit-Policy header.
+func (r Rule) Policy() string {
+	return fmt.Sprintf("%d;w=%d", r.Requests, int64(r.Window/time.Second))
+}
+
+// Result tells whether a request is allowed and what is left to the client.
+// Reset is the time until the limit is fully available again, RetryAfter the
+// time until the next request is allowed when this one was not.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter counts a request of the client identified by key against the rule.
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+// tokenBucketResult is the outcome of a request leaving tokens in the
+// bucket.
+func tokenBucketResult(rule Rule, tokens float64, allowed bool) Result {
+	rate := float64(rule.Requests) / float64(rule.Window)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     rule.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(rule.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate)
+	}
+	return result
+}
+
+// slidingWindowResult is the outcome of a request once counted in the
+// current window, elapsed being the time since the current window started.
+func slidingWindowResult(rule Rule, current int64, previous int64, elapsed time.Duration, allowed bool) Result {
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	estimate := float64(previous)*weight + float64(current)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     rule.Requests,
+		Remaining: max(0, rule.Requests-int(math.Ceil(estimate))),
+		Reset:     rule.Window - elapsed,
+	}
+	if !allowed {
+		// wait until the previous window weighs little enough, or else until
+		// the current one becomes the previous and weighs little enough
+		room := float64(rule.Requests-1) - float64(current)
+		if previous > 0 && room >= 0 {
+			result.RetryAfter = time.Duration((1-room/float64(previous))*float64(rule.Window)) - elapsed
+		} else {
+			room = float64(rule.Requests - 1)
+			result.RetryAfter = result.Reset + time.Duration(max(0, 1-room/float64(current))*float64(rule.Window))
+		}
+		result.RetryAfter = max(result.RetryAfter, time.Millisecond)
+	}
+	return result
+}
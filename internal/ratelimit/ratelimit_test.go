@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("ip:10/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule != (Rule{Key: KeyIP, Requests: 10, Window: time.Minute}) {
+		t.Errorf("WANT ip:10/1m BUT GOT %+v", rule)
+	}
+	if rule.Policy() != "10;w=60" {
+		t.Errorf("WANT 10;w=60 BUT GOT %s", rule.Policy())
+	}
+
+	if rule, err := ParseRule(""); err != nil || rule.Enabled() {
+		t.Errorf("WANT no limit BUT GOT %+v (%v)", rule, err)
+	}
+	for _, s := range []string{"10/1m", "host:10/1m", "ip:ten/1m", "ip:10", "ip:10/1ms"} {
+		if _, err := ParseRule(s); err == nil {
+			t.Errorf("%q: WANT an error", s)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	rule := Rule{Key: KeyIP, Requests: 2, Window: time.Minute}
+
+	for _, algorithm := range []Algorithm{TokenBucket, SlidingWindow} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			l, err := NewMemoryLimiter(algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// start right at a window so the previous one does not count
+			now := time.Now().Truncate(time.Minute)
+			l.now = func() time.Time { return now }
+
+			for i := 0; i < 2; i++ {
+				if result, _ := l.Allow(ctx, "a", rule); !result.Allowed || result.Remaining != 1-i {
+					t.Errorf("WANT request %d allowed BUT GOT %+v", i, result)
+				}
+			}
+			result, _ := l.Allow(ctx, "a", rule)
+			if result.Allowed || result.RetryAfter <= 0 {
+				t.Errorf("WANT a denial with a retry BUT GOT %+v", result)
+			}
+			if result, _ := l.Allow(ctx, "b", rule); !result.Allowed {
+				t.Errorf("WANT another client allowed BUT GOT %+v", result)
+			}
+
+			now = now.Add(result.RetryAfter)
+			if result, _ := l.Allow(ctx, "a", rule); !result.Allowed {
+				t.Errorf("WANT allowed after the retry BUT GOT %+v", result)
+			}
+		})
+	}
+
+	if _, err := NewMemoryLimiter("leaky_bucket"); err == nil {
+		t.Error("WANT an error for an unknown algorithm")
+	}
+}
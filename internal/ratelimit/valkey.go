@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The scripts read the clock of the server, so the replicas of the API agree
+// on the time. The tokens are returned as a string, Lua numbers are truncated
+// to integers in the replies.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(state[1]) or capacity
+local at = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - at) * capacity / window)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', now)
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, tostring(tokens)}
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local index = math.floor(now / window)
+local elapsed = now - index * window
+
+local state = redis.call('HMGET', KEYS[1], 'window', 'current', 'previous')
+local current, previous = 0, 0
+local last = tonumber(state[1])
+if last == index then
+	current, previous = tonumber(state[2]), tonumber(state[3])
+elseif last == index - 1 then
+	previous = tonumber(state[2])
+end
+
+local allowed = 0
+if previous * (1 - elapsed / window) + current + 1 <= limit then
+	current = current + 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'window', index, 'current', current, 'previous', previous)
+redis.call('PEXPIRE', KEYS[1], 2 * window)
+return {allowed, current, previous, elapsed}
+`)
+
+// ValkeyLimiter shares the counters between API replicas, every client has a
+// hash updated atomically by a script.
+type ValkeyLimiter struct {
+	rdb       *redis.Client
+	algorithm Algorithm
+}
+
+func NewValkeyLimiter(rdb *redis.Client, algorithm Algorithm) (*ValkeyLimiter, error) {
+	if !algorithm.Valid() {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", algorithm)
+	}
+	return &ValkeyLimiter{
+		rdb:       rdb,
+		algorithm: algorithm,
+	}, nil
+}
+
+func (l *ValkeyLimiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	keys := []string{fmt.Sprintf("ratelimit:%s:%s", l.algorithm, key)}
+	window := rule.Window.Milliseconds()
+
+	if l.algorithm == TokenBucket {
+		reply, err := tokenBucketScript.Run(ctx, l.rdb, keys, rule.Requests, window).Slice()
+		if err != nil {
+			return Result{}, err
+		}
+		if len(reply) != 2 {
+			return Result{}, fmt.Errorf("unexpected token bucket reply %v", reply)
+		}
+		tokens, err := strconv.ParseFloat(fmt.Sprint(reply[1]), 64)
+		if err != nil {
+			return Result{}, err
+		}
+		return tokenBucketResult(rule, tokens, reply[0] == int64(1)), nil
+	}
+
+	reply, err := slidingWindowScript.Run(ctx, l.rdb, keys, rule.Requests, window).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(reply) != 4 {
+		return Result{}, fmt.Errorf("unexpected sliding window reply %v", reply)
+	}
+	return slidingWindowResult(rule, reply[1], reply[2], time.Duration(reply[3])*time.Millisecond, reply[0] == 1), nil
+}
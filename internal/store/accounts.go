@@ -0,0 +1,250 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeletionPolicy tells what happens to the content of a deleted account.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete removes the account along with its posts,
+	// comments and follows.
+	DeletionPolicyDelete DeletionPolicy = "delete"
+	// DeletionPolicyAnonymize keeps the posts and comments under an
+	// anonymous account stripped of its personal data, and removes the
+	// follows.
+	DeletionPolicyAnonymize DeletionPolicy = "anonymize"
+)
+
+var (
+	ErrUnknownDeletionPolicy = errors.New("unknown deletion policy")
+)
+
+// Valid reports whether p is a known policy.
+func (p DeletionPolicy) Valid() bool {
+	return p == DeletionPolicyDelete || p == DeletionPolicyAnonymize
+}
+
+// ScheduleDeletion schedules the deletion of the account at the given time.
+// It fails with ErrConflict when a deletion is already scheduled.
+func (u *UserStore) ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error {
+	query := `
+		UPDATE users SET deletion_scheduled_at = $2
+		WHERE id = $1 AND deletion_scheduled_at IS NULL AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := u.db.ExecContext(ctx, query, userID, at)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// CancelDeletion cancels the scheduled deletion of the account, as long as
+// its grace period is not over.
+func (u *UserStore) CancelDeletion(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users SET deletion_scheduled_at = NULL
+		WHERE id = $1 AND deletion_scheduled_at > NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := u.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetDueDeletions returns up to limit accounts whose grace period is over.
+func (u *UserStore) GetDueDeletions(ctx context.Context, limit int) ([]int64, error) {
+	query := `
+		SELECT id FROM users
+		WHERE deletion_scheduled_at <= NOW()
+		ORDER BY deletion_scheduled_at
+		LIMIT $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// PurgedFiles are the files of a purged account, they are removed along with
+// it.
+type PurgedFiles struct {
+	AvatarURL string
+	// ExportKeys are the keys of the data exports of the account.
+	ExportKeys []string
+}
+
+// Purge deletes an account whose grace period is over according to the
+// policy, and returns its files so they can be removed as well. It fails with
+// ErrNotFound when the deletion was cancelled in the meantime.
+func (u *UserStore) Purge(ctx context.Context, userID int64, policy DeletionPolicy) (*PurgedFiles, error) {
+	if !policy.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDeletionPolicy, policy)
+	}
+
+	files := &PurgedFiles{ExportKeys: []string{}}
+	err := withTx(ctx, u.db, func(tx *sql.Tx) error {
+		query := `
+			SELECT avatar_url FROM users
+			WHERE id = $1 AND deletion_scheduled_at <= NOW()
+			FOR UPDATE
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := tx.QueryRowContext(ctx, query, userID).Scan(&files.AvatarURL); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		// the rows of the exports go away with the account, not their files
+		exportKeys, err := u.getExportKeys(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		files.ExportKeys = exportKeys
+
+		if policy == DeletionPolicyAnonymize {
+			return u.anonymize(ctx, tx, userID)
+		}
+
+		// comments are not tied to their user or post by a foreign key
+		query = `
+			DELETE FROM comments
+			WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+		if err := u.deleteUserInvitation(ctx, tx, userID); err != nil {
+			return err
+		}
+		return u.delete(ctx, tx, userID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (u *UserStore) getExportKeys(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	query := `
+		SELECT file_key FROM data_exports
+		WHERE user_id = $1 AND file_key <> ''
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// anonymize strips the account of its personal data and relationships, its
+// posts and comments stay under a placeholder name.
+func (u *UserStore) anonymize(ctx context.Context, tx *sql.Tx, userID int64) error {
+	queries := []string{
+		`DELETE FROM followers WHERE user_id = $1 OR follower_id = $1`,
+		`DELETE FROM follow_requests WHERE user_id = $1 OR requester_id = $1`,
+		`DELETE FROM follow_suggestions WHERE user_id = $1 OR suggested_id = $1`,
+		`DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1`,
+		`DELETE FROM user_mutes WHERE muter_id = $1 OR muted_id = $1`,
+		`DELETE FROM notifications WHERE user_id = $1 OR actor_id = $1`,
+		`DELETE FROM notification_preferences WHERE user_id = $1`,
+		`DELETE FROM username_history WHERE user_id = $1`,
+		`DELETE FROM email_verifications WHERE user_id = $1`,
+		`DELETE FROM user_invitations WHERE user_id = $1`,
+		`DELETE FROM data_exports WHERE user_id = $1`,
+		`DELETE FROM sessions WHERE user_id = $1`,
+		`DELETE FROM reports WHERE reporter_id = $1`,
+		`UPDATE users SET
+			username = 'deleted-' || id,
+			email = 'deleted-' || id || '@deleted.invalid',
+			password = '',
+			display_name = '',
+			bio = '',
+			website = '',
+			location = '',
+			avatar_url = '',
+			is_active = false,
+			is_private = false,
+			deletion_scheduled_at = NULL,
+			deleted_at = NOW()
+		WHERE id = $1`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
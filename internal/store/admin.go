@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UserActivity is a recent post or comment of a user.
+type UserActivity struct {
+	Type      string `json:"type"`
+	ID        int64  `json:"id"`
+	PostID    int64  `json:"post_id"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Search lists the users matching the filters, newest first. Anonymized
+// accounts are left out.
+func (u *UserStore) Search(ctx context.Context, p PaginatedUsers) ([]User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		JOIN roles ON (roles.id = users.role_id)
+		WHERE users.deleted_at IS NULL AND
+			($1::text = '' OR users.username ILIKE '%' || $1 || '%' OR users.email ILIKE '%' || $1 || '%') AND
+			($2::text = '' OR roles.name = $2) AND
+			($3::text = '' OR
+				($3 = 'active' AND users.is_active) OR
+				($3 = 'inactive' AND NOT users.is_active) OR
+				($3 = 'pending_deletion' AND users.deletion_scheduled_at IS NOT NULL) OR
+				($3 = 'suspended' AND EXISTS (
+					SELECT 1 FROM user_suspensions us
+					WHERE us.user_id = users.id AND us.lifted_at IS NULL AND us.starts_at <= NOW() AND
+						(us.ends_at IS NULL OR us.ends_at > NOW())
+				)))
+		ORDER BY users.id DESC
+		LIMIT $4 OFFSET $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.QueryContext(ctx, query, p.Search, p.Role, p.Status, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetRole gives the role named roleName to the user.
+func (u *UserStore) SetRole(ctx context.Context, userID int64, roleName string) error {
+	query := `
+		UPDATE users SET role_id = roles.id
+		FROM roles
+		WHERE users.id = $1 AND roles.name = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := u.db.ExecContext(ctx, query, userID, roleName)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetActive deactivates or reactivates the user. A deactivated user cannot
+// log in and is logged out everywhere.
+func (u *UserStore) SetActive(ctx context.Context, userID int64, active bool) error {
+	return withTx(ctx, u.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET is_active = $2 WHERE id = $1`, userID, active)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		if active {
+			return nil
+		}
+		return revokeTokens(ctx, tx, userID)
+	})
+}
+
+// RevokeTokens logs the user out everywhere: the tokens issued until now are
+// rejected and the sessions are marked as revoked.
+func (u *UserStore) RevokeTokens(ctx context.Context, userID int64) error {
+	return withTx(ctx, u.db, func(tx *sql.Tx) error {
+		return revokeTokens(ctx, tx, userID)
+	})
+}
+
+func revokeTokens(ctx context.Context, tx *sql.Tx, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET tokens_valid_after = NOW() WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	query := `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+	_, err = tx.ExecContext(ctx, query, userID)
+	return err
+}
+
+// CreateInvitation replaces the activation token of a user who is not
+// active yet. It fails with ErrConflict when the user is already active.
+func (u *UserStore) CreateInvitation(ctx context.Context, token string, userID int64, invitationExpirationDuration time.Duration) error {
+	return withTx(ctx, u.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var active bool
+		err := tx.QueryRowContext(ctx, `SELECT is_active FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&active)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		if active {
+			return ErrConflict
+		}
+
+		if err := u.deleteUserInvitation(ctx, tx, userID); err != nil {
+			return err
+		}
+		return u.createUserInvitation(ctx, tx, token, userID, invitationExpirationDuration)
+	})
+}
+
+// GetRecentActivity returns the latest posts and comments of the user.
+func (u *UserStore) GetRecentActivity(ctx context.Context, userID int64, limit int) ([]UserActivity, error) {
+	query := `
+		SELECT 'post', id, id, title, created_at FROM posts WHERE user_id = $1
+		UNION ALL
+		SELECT 'comment', id, post_id, content, created_at FROM comments WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := []UserActivity{}
+	for rows.Next() {
+		var activity UserActivity
+		err := rows.Scan(
+			&activity.Type,
+			&activity.ID,
+			&activity.PostID,
+			&activity.Text,
+			&activity.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return activities, nil
+}
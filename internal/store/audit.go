@@ -0,0 +1,297 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// auditChainLock is the advisory lock taken while appending to the hash
+// chain, so the events are chained one after the other.
+const auditChainLock = 7262797
+
+// AuditEvent records a security-sensitive or moderation action. ActorID is
+// zero for the actions of the system or of an unauthenticated client.
+type AuditEvent struct {
+	ID         int64          `json:"id"`
+	ActorID    int64          `json:"actor_id"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type"`
+	TargetID   int64          `json:"target_id"`
+	Before     map[string]any `json:"before,omitempty"`
+	After      map[string]any `json:"after,omitempty"`
+	Details    map[string]any `json:"details"`
+	RequestID  string         `json:"request_id"`
+	IP         string         `json:"ip"`
+	PrevHash   string         `json:"prev_hash,omitempty"`
+	Hash       string         `json:"hash,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// AuditVerification is the result of checking the hash chain. BrokenID is
+// the first event whose hash does not match, zero when the chain is intact.
+type AuditVerification struct {
+	Checked  int64 `json:"checked"`
+	BrokenID int64 `json:"broken_id"`
+}
+
+type AuditStore struct {
+	db *sql.DB
+	// hashChain links every new event to the previous one by its hash.
+	hashChain bool
+}
+
+func NewAudit(db *sql.DB, hashChain bool) *AuditStore {
+	return &AuditStore{
+		db:        db,
+		hashChain: hashChain,
+	}
+}
+
+func (s *AuditStore) Create(ctx context.Context, event *AuditEvent) error {
+	before, err := canonicalJSON(event.Before)
+	if err != nil {
+		return err
+	}
+	after, err := canonicalJSON(event.After)
+	if err != nil {
+		return err
+	}
+	details, err := canonicalJSON(event.Details)
+	if err != nil {
+		return err
+	}
+	if details == nil {
+		details = []byte("{}")
+	}
+	event.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var prevHash, hash sql.NullString
+		if s.hashChain {
+			if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock); err != nil {
+				return err
+			}
+			err := tx.QueryRowContext(ctx, `SELECT hash FROM audit_events WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			event.PrevHash = prevHash.String
+			event.Hash = auditDigest(event, before, after, details)
+			hash = sql.NullString{String: event.Hash, Valid: true}
+		}
+
+		query := `
+			INSERT INTO audit_events (actor_id, action, target_type, target_id, before, after, details, request_id, ip, prev_hash, hash, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			RETURNING id
+		`
+		return tx.QueryRowContext(
+			ctx,
+			query,
+			sql.NullInt64{Int64: event.ActorID, Valid: event.ActorID != 0},
+			event.Action,
+			event.TargetType,
+			event.TargetID,
+			nullJSON(before),
+			nullJSON(after),
+			details,
+			event.RequestID,
+			event.IP,
+			prevHash,
+			hash,
+			event.CreatedAt,
+		).Scan(&event.ID)
+	})
+}
+
+// Get returns the events matching the filters, newest first.
+func (s *AuditStore) Get(ctx context.Context, p PaginatedAudit) ([]AuditEvent, error) {
+	query := `
+		SELECT ` + auditColumns + `
+		FROM audit_events
+		WHERE ($1::bigint = 0 OR id < $1) AND
+			($2::bigint = 0 OR actor_id = $2) AND
+			($3::text = '' OR action = $3) AND
+			($4::text = '' OR target_type = $4) AND
+			($5::bigint = 0 OR target_id = $5) AND
+			($6::timestamptz IS NULL OR created_at >= $6) AND
+			($7::timestamptz IS NULL OR created_at < $7)
+		ORDER BY id DESC
+		LIMIT $8
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, p.Before, p.ActorID, p.Action, p.TargetType, p.TargetID, p.Since, p.Until, p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var event AuditEvent
+		if _, err := scanAuditEvent(rows, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Verify recomputes the hash chain from its first event and stops at the
+// first event that was altered, or whose predecessor was removed.
+func (s *AuditStore) Verify(ctx context.Context) (*AuditVerification, error) {
+	query := `
+		SELECT ` + auditColumns + `
+		FROM audit_events
+		WHERE hash IS NOT NULL
+		ORDER BY id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var verification AuditVerification
+	prevHash := ""
+	for rows.Next() {
+		var event AuditEvent
+		raw, err := scanAuditEvent(rows, &event)
+		if err != nil {
+			return nil, err
+		}
+
+		verification.Checked++
+		if event.PrevHash != prevHash || auditDigest(&event, raw.before, raw.after, raw.details) != event.Hash {
+			verification.BrokenID = event.ID
+			break
+		}
+		prevHash = event.Hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &verification, nil
+}
+
+const auditColumns = `id, COALESCE(actor_id, 0), action, target_type, target_id, before, after, details,
+			request_id, ip, COALESCE(prev_hash, ''), COALESCE(hash, ''), created_at`
+
+// rawAuditJSON holds the JSON columns of an event in their canonical form.
+type rawAuditJSON struct {
+	before, after, details []byte
+}
+
+func scanAuditEvent(row rowScanner, event *AuditEvent) (*rawAuditJSON, error) {
+	var before, after, details []byte
+	err := row.Scan(
+		&event.ID,
+		&event.ActorID,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&before,
+		&after,
+		&details,
+		&event.RequestID,
+		&event.IP,
+		&event.PrevHash,
+		&event.Hash,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	event.CreatedAt = event.CreatedAt.UTC()
+
+	var raw rawAuditJSON
+	if raw.before, err = decodeAuditJSON(before, &event.Before); err != nil {
+		return nil, err
+	}
+	if raw.after, err = decodeAuditJSON(after, &event.After); err != nil {
+		return nil, err
+	}
+	if raw.details, err = decodeAuditJSON(details, &event.Details); err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// decodeAuditJSON decodes a JSON column into m and returns its canonical
+// form, nil for a NULL column.
+func decodeAuditJSON(data []byte, m *map[string]any) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(*m)
+}
+
+// canonicalJSON encodes m the way it reads back from the database, with the
+// keys sorted and the numbers as floats, so its hash can be checked later.
+func canonicalJSON(m map[string]any) ([]byte, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
+func nullJSON(data []byte) any {
+	if data == nil {
+		return nil
+	}
+	return data
+}
+
+// auditDigest hashes the event along with the hash of the previous one.
+func auditDigest(event *AuditEvent, before, after, details []byte) string {
+	payload, _ := json.Marshal([]any{
+		event.PrevHash,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		json.RawMessage(orNull(before)),
+		json.RawMessage(orNull(after)),
+		json.RawMessage(orNull(details)),
+		event.RequestID,
+		event.IP,
+		event.CreatedAt.UTC().Format(time.RFC3339),
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+func orNull(data []byte) []byte {
+	if data == nil {
+		return []byte("null")
+	}
+	return data
+}
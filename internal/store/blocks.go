@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrBlocked = errors.New("user is blocked")
+)
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+func NewBlock(db *sql.DB) *BlockStore {
+	return &BlockStore{
+		db: db,
+	}
+}
+
+// Block blocks a user and removes the follow relationships and the pending
+// follow requests between both users.
+func (s *BlockStore) Block(ctx context.Context, blockerID int64, blockedID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO user_blocks (blocker_id, blocked_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return unknownUserError(err)
+		}
+
+		// a block is a forced unfollow both ways
+		query = `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return err
+		}
+
+		// and cancels the follow requests both ways
+		query = `
+			DELETE FROM follow_requests
+			WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+		`
+		_, err := tx.ExecContext(ctx, query, blockerID, blockedID)
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID int64, blockedID int64) error {
+	query := `
+		DELETE FROM user_blocks
+		WHERE blocker_id = $1 AND blocked_id = $2
+	`
+
+	return s.delete(ctx, query, blockerID, blockedID)
+}
+
+func (s *BlockStore) Mute(ctx context.Context, muterID int64, mutedID int64) error {
+	query := `
+		INSERT INTO user_mutes (muter_id, muted_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterID, mutedID)
+	return unknownUserError(err)
+}
+
+// unknownUserError maps the foreign key violation of a missing user to
+// ErrNotFound.
+func unknownUserError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, muterID int64, mutedID int64) error {
+	query := `
+		DELETE FROM user_mutes
+		WHERE muter_id = $1 AND muted_id = $2
+	`
+
+	return s.delete(ctx, query, muterID, mutedID)
+}
+
+// IsBlocked reports whether one of the users blocked the other.
+func (s *BlockStore) IsBlocked(ctx context.Context, userID int64, otherUserID int64) (bool, error) {
+	return isBlocked(ctx, s.db, userID, otherUserID)
+}
+
+// IsHidden reports whether the author is hidden from the viewer, because of a
+// block or a mute.
+func (s *BlockStore) IsHidden(ctx context.Context, viewerID int64, authorID int64) (bool, error) {
+	query := `SELECT ` + hiddenSQL("$1", "$2")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var hidden bool
+	err := s.db.QueryRowContext(ctx, query, viewerID, authorID).Scan(&hidden)
+	return hidden, err
+}
+
+func (s *BlockStore) GetBlocked(ctx context.Context, userID int64) ([]User, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at
+		FROM user_blocks ub
+		JOIN users u ON u.id = ub.blocked_id
+		WHERE ub.blocker_id = $1
+		ORDER BY ub.created_at DESC
+	`
+
+	return s.getUsers(ctx, query, userID)
+}
+
+func (s *BlockStore) GetMuted(ctx context.Context, userID int64) ([]User, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at
+		FROM user_mutes um
+		JOIN users u ON u.id = um.muted_id
+		WHERE um.muter_id = $1
+		ORDER BY um.created_at DESC
+	`
+
+	return s.getUsers(ctx, query, userID)
+}
+
+func (s *BlockStore) delete(ctx context.Context, query string, userID int64, otherUserID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, otherUserID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *BlockStore) getUsers(ctx context.Context, query string, userID int64) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func isBlocked(ctx context.Context, db queryRower, userID int64, otherUserID int64) (bool, error) {
+	query := `SELECT ` + blockedSQL("$1", "$2")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	err := db.QueryRowContext(ctx, query, userID, otherUserID).Scan(&blocked)
+	return blocked, err
+}
@@ -10,11 +10,18 @@ type Storage struct {
 	User interface {
 		Get(ctx context.Context, userID int64) (*store.User, error)
 		Set(ctx context.Context, user *store.User) error
+		Delete(ctx context.Context, userID int64) error
+	}
+	Suggestion interface {
+		Get(ctx context.Context, userID int64) ([]store.Suggestion, error)
+		Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error
+		Delete(ctx context.Context, userID int64) error
 	}
 }
 
 func NewCacheStorage(rdb *redis.Client) Storage {
 	return Storage{
-		User: NewUser(rdb),
+		User:       NewUser(rdb),
+		Suggestion: NewSuggestion(rdb),
 	}
 }
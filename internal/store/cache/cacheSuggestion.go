@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/longlnOff/social/internal/store"
+)
+
+var (
+	SUGGESTIONS_EXP_TIME = time.Duration(15 * time.Minute)
+)
+
+type SuggestionStore struct {
+	db *redis.Client
+}
+
+func NewSuggestion(db *redis.Client) *SuggestionStore {
+	return &SuggestionStore{
+		db: db,
+	}
+}
+
+func (s *SuggestionStore) Get(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	key := fmt.Sprintf("suggestions:%d", userID)
+	data, err := s.db.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil // Can't find in redis
+	}
+	if err != nil {
+		return nil, err
+	}
+	suggestions := []store.Suggestion{}
+	if err := json.Unmarshal([]byte(data), &suggestions); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+func (s *SuggestionStore) Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error {
+	key := fmt.Sprintf("suggestions:%d", userID)
+	json, err := json.Marshal(suggestions)
+	if err != nil {
+		return err
+	}
+	return s.db.SetEX(ctx, key, json, SUGGESTIONS_EXP_TIME).Err()
+}
+
+func (s *SuggestionStore) Delete(ctx context.Context, userID int64) error {
+	key := fmt.Sprintf("suggestions:%d", userID)
+	return s.db.Del(ctx, key).Err()
+}
@@ -14,6 +14,13 @@ var (
 	USER_EXP_TIME = time.Duration(2 * time.Hour)
 )
 
+// cachedUser keeps the fields of a user that are not part of its JSON.
+type cachedUser struct {
+	*store.User
+	TokensValidAfter *time.Time         `json:"tokens_valid_after,omitempty"`
+	Suspensions      []store.Suspension `json:"suspensions,omitempty"`
+}
+
 type UserStore struct {
 	db *redis.Client
 }
@@ -33,22 +40,29 @@ func (u *UserStore) Get(ctx context.Context, userID int64) (*store.User, error)
 	if err != nil {
 		return nil, err
 	}
-	var user store.User
+	user := cachedUser{User: &store.User{}}
 	if data != "" {
 		err := json.Unmarshal([]byte(data), &user)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return &user, nil
+	user.User.TokensValidAfter = user.TokensValidAfter
+	user.User.Suspensions = user.Suspensions
+	return user.User, nil
 }
 
 func (u *UserStore) Set(ctx context.Context, user *store.User) error {
 	// Should check if user has ID first in production implmentation
 	userIDKey := fmt.Sprintf("user:%d", user.ID)
-	json, err := json.Marshal(user)
+	json, err := json.Marshal(cachedUser{User: user, TokensValidAfter: user.TokensValidAfter, Suspensions: user.Suspensions})
 	if err != nil {
 		return err
 	}
 	return u.db.SetEX(ctx, userIDKey, json, USER_EXP_TIME).Err()
 }
+
+func (u *UserStore) Delete(ctx context.Context, userID int64) error {
+	userIDKey := fmt.Sprintf("user:%d", userID)
+	return u.db.Del(ctx, userIDKey).Err()
+}
@@ -10,6 +10,7 @@ import (
 func NewMockStore() Storage {
 	return Storage{
 		User: &MockUserStore{},
+		Suggestion: &MockSuggestionStore{},
 
 	}
 }
@@ -23,3 +24,21 @@ func (m *MockUserStore) Get(ctx context.Context, userID int64) (*store.User, err
 func (m *MockUserStore) Set(ctx context.Context, user *store.User) error {
 	return nil
 }
+
+func (m *MockUserStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockSuggestionStore struct {}
+
+func (m *MockSuggestionStore) Get(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	return nil, nil
+}
+
+func (m *MockSuggestionStore) Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error {
+	return nil
+}
+
+func (m *MockSuggestionStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
@@ -3,15 +3,22 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+
+	"github.com/longlnOff/social/internal/content"
 )
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID        int64            `json:"id"`
+	PostID    int64            `json:"post_id"`
+	UserID    int64            `json:"user_id"`
+	Content   string           `json:"content"`
+	Entities  content.Entities `json:"entities"`
+	CreatedAt string           `json:"created_at"`
+	User      User             `json:"user"`
+	// Hold is the reason to hold the new comment for review, it stays
+	// hidden until a moderator looks into it.
+	Hold string `json:"-"`
 }
 
 type CommentStore struct {
@@ -24,18 +31,23 @@ func NewComment(db *sql.DB) *CommentStore {
 	}
 }
 
-func (c *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// GetByPostID returns the comments of a post as seen by the viewer, without
+// the comments of blocked users. Nothing is returned when the post belongs to
+// a private account the viewer does not follow.
+func (c *CommentStore) GetByPostID(ctx context.Context, postID int64, viewerID int64) ([]Comment, error) {
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id FROM comments c
+		SELECT c.id, c.post_id, c.user_id, c.content, c.entities, c.created_at, users.username, users.id FROM comments c
 		JOIN users on users.id = c.user_id
-		WHERE c.post_id = $1
+		JOIN posts p ON p.id = c.post_id
+		WHERE c.post_id = $1 AND NOT ` + blockedSQL("$2", "c.user_id") + ` AND ` + visibleSQL("$2", "p.user_id") + ` AND
+			NOT ` + moderatedSQL("$2", "c.hidden_at", "c.user_id") + ` AND NOT ` + moderatedSQL("$2", "p.hidden_at", "p.user_id") + `
 		ORDER BY c.created_at DESC
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := c.db.QueryContext(ctx, query, postID)
+	rows, err := c.db.QueryContext(ctx, query, postID, viewerID)
 	if err != nil {
 		return []Comment{}, err
 	}
@@ -48,6 +60,7 @@ func (c *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 			&comment.PostID,
 			&comment.UserID,
 			&comment.Content,
+			&comment.Entities,
 			&comment.CreatedAt,
 			&comment.User.Username, // Note that this auto unmarshals into the User struct
 			&comment.User.ID)       // Note that this auto unmarshals into the User struct
@@ -63,20 +76,82 @@ func (c *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 }
 
 func (c *CommentStore) Create(ctx context.Context, comment *Comment) error {
+	return withTx(ctx, c.db, func(tx *sql.Tx) error {
+		// create the comment
+		if err := c.create(ctx, tx, comment); err != nil {
+			return err
+		}
+
+		// notify the post owner, who must not have a block with the commenter
+		ownerID, err := c.getPostOwnerID(ctx, tx, comment.PostID)
+		if err != nil {
+			return err
+		}
+		blocked, err := isBlocked(ctx, tx, comment.UserID, ownerID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		// record the mentioned users, nobody is notified of a held comment
+		mentioned, err := createCommentMentions(ctx, tx, comment.ID, comment.Entities.MentionedUserIDs())
+		if err != nil {
+			return err
+		}
+		if comment.Hold != "" {
+			return holdContent(ctx, tx, ReportTargetComment, comment.ID, comment.UserID, comment.Hold)
+		}
+
+		notification := Notification{ActorID: comment.UserID, PostID: &comment.PostID, CommentID: &comment.ID}
+		notification.Type = NotificationComment
+		if err := createNotifications(ctx, tx, notification, []int64{ownerID}); err != nil {
+			return err
+		}
+		notification.Type = NotificationMention
+		return createNotifications(ctx, tx, notification, mentioned)
+	})
+}
+
+func (c *CommentStore) getPostOwnerID(ctx context.Context, tx *sql.Tx, postID int64) (int64, error) {
+	query := `
+		SELECT user_id FROM posts
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var ownerID int64
+	err := tx.QueryRowContext(ctx, query, postID).Scan(&ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+	return ownerID, nil
+}
+
+func (c *CommentStore) create(ctx context.Context, tx *sql.Tx, comment *Comment) error {
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3)
+		INSERT INTO comments (post_id, user_id, content, entities, hidden_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $5 THEN NOW() END)
 		RETURNING id, created_at
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	return c.db.QueryRowContext(
+	return tx.QueryRowContext(
 		ctx,
 		query,
 		comment.PostID,
 		comment.UserID,
 		comment.Content,
+		comment.Entities,
+		comment.Hold != "",
 	).Scan(
 		&comment.ID,
 		&comment.CreatedAt,
@@ -0,0 +1,533 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrMessagingNotAllowed = errors.New("user does not accept messages from you")
+)
+
+type Conversation struct {
+	ID           int64         `json:"id"`
+	CreatedBy    int64         `json:"created_by"`
+	IsGroup      bool          `json:"is_group"`
+	CreatedAt    string        `json:"created_at"`
+	UnreadCount  int64         `json:"unread_count"`
+	LastMessage  *Message      `json:"last_message,omitempty"`
+	Participants []Participant `json:"participants"`
+}
+
+type Participant struct {
+	UserID            int64  `json:"user_id"`
+	Username          string `json:"username"`
+	LastReadMessageID int64  `json:"last_read_message_id"`
+	JoinedAt          string `json:"joined_at"`
+}
+
+type Message struct {
+	ID             int64  `json:"id"`
+	ConversationID int64  `json:"conversation_id"`
+	SenderID       int64  `json:"sender_id"`
+	Content        string `json:"content"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type MessagingSettings struct {
+	FollowedOnly bool `json:"followed_only"`
+}
+
+type ConversationStore struct {
+	db *sql.DB
+}
+
+func NewConversation(db *sql.DB) *ConversationStore {
+	return &ConversationStore{
+		db: db,
+	}
+}
+
+// Create starts a conversation between the creator and the participants with
+// its first message.
+func (s *ConversationStore) Create(ctx context.Context, conversation *Conversation, participantIDs []int64, message *Message) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// create the conversation
+		if err := s.create(ctx, tx, conversation); err != nil {
+			return err
+		}
+
+		// add the participants, creator included
+		userIDs := append([]int64{conversation.CreatedBy}, participantIDs...)
+		if err := s.createParticipants(ctx, tx, conversation.ID, userIDs); err != nil {
+			return err
+		}
+
+		// send the first message
+		message.ConversationID = conversation.ID
+		if err := s.createMessage(ctx, tx, message); err != nil {
+			return err
+		}
+		conversation.LastMessage = message
+
+		return nil
+	})
+}
+
+// FindDirect returns the 1:1 conversation between two users.
+func (s *ConversationStore) FindDirect(ctx context.Context, userID int64, otherUserID int64) (*Conversation, error) {
+	query := `
+		SELECT c.id FROM conversations c
+		JOIN conversation_participants a ON a.conversation_id = c.id AND a.user_id = $1
+		JOIN conversation_participants b ON b.conversation_id = c.id AND b.user_id = $2
+		WHERE c.is_group = false
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var conversationID int64
+	err := s.db.QueryRowContext(ctx, query, userID, otherUserID).Scan(&conversationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return s.GetByID(ctx, conversationID, userID)
+}
+
+// GetByID returns a conversation as seen by one of its participants.
+func (s *ConversationStore) GetByID(ctx context.Context, conversationID int64, userID int64) (*Conversation, error) {
+	query := `
+		SELECT c.id, c.created_by, c.is_group, c.created_at,
+			m.id, m.sender_id, m.content, m.created_at,
+			(
+				SELECT COUNT(*) FROM messages um
+				WHERE um.conversation_id = c.id AND um.id > p.last_read_message_id AND um.sender_id <> p.user_id
+			)
+		FROM conversations c
+		JOIN conversation_participants p ON p.conversation_id = c.id AND p.user_id = $2
+		LEFT JOIN messages m ON m.id = c.last_message_id
+		WHERE c.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	conversation, err := scanConversation(s.db.QueryRowContext(ctx, query, conversationID, userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	participants, err := s.getParticipants(ctx, []int64{conversation.ID})
+	if err != nil {
+		return nil, err
+	}
+	conversation.Participants = participants[conversation.ID]
+
+	return conversation, nil
+}
+
+// GetByUserID lists the conversations of a user, most recently active first.
+func (s *ConversationStore) GetByUserID(ctx context.Context, userID int64, p PaginatedKeyset) ([]Conversation, error) {
+	query := `
+		SELECT c.id, c.created_by, c.is_group, c.created_at,
+			m.id, m.sender_id, m.content, m.created_at,
+			(
+				SELECT COUNT(*) FROM messages um
+				WHERE um.conversation_id = c.id AND um.id > p.last_read_message_id AND um.sender_id <> p.user_id
+			)
+		FROM conversations c
+		JOIN conversation_participants p ON p.conversation_id = c.id AND p.user_id = $1
+		LEFT JOIN messages m ON m.id = c.last_message_id
+		WHERE ($2::bigint = 0 OR c.last_message_id < $2)
+		ORDER BY c.last_message_id DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, p.Before, p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	conversationIDs := []int64{}
+	for rows.Next() {
+		conversation, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, *conversation)
+		conversationIDs = append(conversationIDs, conversation.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	participants, err := s.getParticipants(ctx, conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range conversations {
+		conversations[i].Participants = participants[conversations[i].ID]
+	}
+
+	return conversations, nil
+}
+
+// CountUnread returns the number of unread messages over every conversation.
+func (s *ConversationStore) CountUnread(ctx context.Context, userID int64) (int64, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM conversation_participants p
+		JOIN messages m ON m.conversation_id = p.conversation_id
+		WHERE p.user_id = $1 AND m.id > p.last_read_message_id AND m.sender_id <> p.user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// CanMessage checks that every recipient exists and accepts messages from
+// the sender: no block between them and, when the recipient restricted its
+// messages, followed by the recipient.
+func (s *ConversationStore) CanMessage(ctx context.Context, senderID int64, recipientIDs []int64) error {
+	query := `
+		SELECT u.id, (u.dm_followed_only AND NOT EXISTS (
+			SELECT 1 FROM followers f
+			WHERE f.user_id = $1 AND f.follower_id = u.id
+		)) OR ` + blockedSQL("$1", "u.id") + `
+		FROM users u
+		WHERE u.id = ANY($2) AND u.is_active = true
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, senderID, pq.Array(recipientIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var userID int64
+		var restricted bool
+		if err := rows.Scan(&userID, &restricted); err != nil {
+			return err
+		}
+		if restricted {
+			return ErrMessagingNotAllowed
+		}
+		found++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if found != len(recipientIDs) {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateMessage sends a message to an existing conversation. Nothing can be
+// sent to a 1:1 conversation once one of its participants blocked the other.
+func (s *ConversationStore) CreateMessage(ctx context.Context, message *Message) error {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM conversations c
+			JOIN conversation_participants p ON p.conversation_id = c.id AND p.user_id <> $2
+			WHERE c.id = $1 AND c.is_group = false AND ` + blockedSQL("$2", "p.user_id") + `
+		)
+	`
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var blocked bool
+		if err := tx.QueryRowContext(ctx, query, message.ConversationID, message.SenderID).Scan(&blocked); err != nil {
+			return err
+		}
+		if blocked {
+			return ErrMessagingNotAllowed
+		}
+
+		return s.createMessage(ctx, tx, message)
+	})
+}
+
+// GetMessages lists the messages of a conversation, newest first.
+func (s *ConversationStore) GetMessages(ctx context.Context, conversationID int64, p PaginatedKeyset) ([]Message, error) {
+	query := `
+		SELECT id, conversation_id, sender_id, content, created_at
+		FROM messages
+		WHERE conversation_id = $1 AND ($2::bigint = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, conversationID, p.Before, p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var message Message
+		err := rows.Scan(
+			&message.ID,
+			&message.ConversationID,
+			&message.SenderID,
+			&message.Content,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// MarkRead moves the read receipt of a participant up to messageID.
+func (s *ConversationStore) MarkRead(ctx context.Context, conversationID int64, userID int64, messageID int64) error {
+	query := `
+		UPDATE conversation_participants
+		SET last_read_message_id = GREATEST(last_read_message_id, $3)
+		WHERE conversation_id = $1 AND user_id = $2 AND EXISTS (
+			SELECT 1 FROM messages WHERE id = $3 AND conversation_id = $1
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, conversationID, userID, messageID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *ConversationStore) GetSettings(ctx context.Context, userID int64) (*MessagingSettings, error) {
+	query := `
+		SELECT dm_followed_only FROM users
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var settings MessagingSettings
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&settings.FollowedOnly)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &settings, nil
+}
+
+func (s *ConversationStore) UpdateSettings(ctx context.Context, userID int64, settings *MessagingSettings) error {
+	query := `
+		UPDATE users
+		SET dm_followed_only = $1
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, settings.FollowedOnly, userID)
+	return err
+}
+
+func (s *ConversationStore) create(ctx context.Context, tx *sql.Tx, conversation *Conversation) error {
+	query := `
+		INSERT INTO conversations (created_by, is_group)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(ctx, query, conversation.CreatedBy, conversation.IsGroup).Scan(
+		&conversation.ID,
+		&conversation.CreatedAt,
+	)
+}
+
+func (s *ConversationStore) createParticipants(ctx context.Context, tx *sql.Tx, conversationID int64, userIDs []int64) error {
+	query := `
+		INSERT INTO conversation_participants (conversation_id, user_id)
+		SELECT $1, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, conversationID, pq.Array(userIDs))
+	return err
+}
+
+// createMessage stores a message, makes it the last message of its
+// conversation and marks it as read by its sender.
+func (s *ConversationStore) createMessage(ctx context.Context, tx *sql.Tx, message *Message) error {
+	query := `
+		INSERT INTO messages (conversation_id, sender_id, content)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(ctx, query, message.ConversationID, message.SenderID, message.Content).Scan(
+		&message.ID,
+		&message.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE conversations
+		SET last_message_id = $1
+		WHERE id = $2
+	`
+	if _, err := tx.ExecContext(ctx, query, message.ID, message.ConversationID); err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE conversation_participants
+		SET last_read_message_id = $1
+		WHERE conversation_id = $2 AND user_id = $3
+	`
+	_, err = tx.ExecContext(ctx, query, message.ID, message.ConversationID, message.SenderID)
+	return err
+}
+
+func (s *ConversationStore) getParticipants(ctx context.Context, conversationIDs []int64) (map[int64][]Participant, error) {
+	query := `
+		SELECT p.conversation_id, p.user_id, u.username, p.last_read_message_id, p.joined_at
+		FROM conversation_participants p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.conversation_id = ANY($1)
+		ORDER BY p.joined_at
+	`
+
+	participants := map[int64][]Participant{}
+	if len(conversationIDs) == 0 {
+		return participants, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var conversationID int64
+		var participant Participant
+		err := rows.Scan(
+			&conversationID,
+			&participant.UserID,
+			&participant.Username,
+			&participant.LastReadMessageID,
+			&participant.JoinedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		participants[conversationID] = append(participants[conversationID], participant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return participants, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanConversation(row rowScanner) (*Conversation, error) {
+	var conversation Conversation
+	var messageID, senderID sql.NullInt64
+	var content, createdAt sql.NullString
+	err := row.Scan(
+		&conversation.ID,
+		&conversation.CreatedBy,
+		&conversation.IsGroup,
+		&conversation.CreatedAt,
+		&messageID,
+		&senderID,
+		&content,
+		&createdAt,
+		&conversation.UnreadCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageID.Valid {
+		conversation.LastMessage = &Message{
+			ID:             messageID.Int64,
+			ConversationID: conversation.ID,
+			SenderID:       senderID.Int64,
+			Content:        content.String,
+			CreatedAt:      createdAt.String,
+		}
+	}
+	return &conversation, nil
+}
@@ -0,0 +1,35 @@
+package store
+
+import "errors"
+
+// errorCodes are the stable codes of the domain errors, the clients rely on
+// them rather than on the messages. A code never changes once published.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrNotFound, "not_found"},
+	{ErrConflict, "conflict"},
+	{ErrDuplicateEmail, "duplicate_email"},
+	{ErrDuplicateUsername, "duplicate_username"},
+	{ErrUnknownDeletionPolicy, "unknown_deletion_policy"},
+	{ErrBlocked, "blocked"},
+	{ErrMessagingNotAllowed, "messaging_not_allowed"},
+	{ErrSelfFollow, "self_follow"},
+	{ErrUsernameChangeTooSoon, "username_change_too_soon"},
+	{ErrSelfReport, "self_report"},
+	{ErrCaseResolved, "case_resolved"},
+	{ErrInvalidModerationAction, "invalid_moderation_action"},
+}
+
+// ErrorCode returns the code of the domain error err wraps, along with the
+// error itself, whose message is safe to show. ok is false when err is not a
+// domain error.
+func ErrorCode(err error) (code string, domainErr error, ok bool) {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.code, e.err, true
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,400 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ExportPending    = "pending"
+	ExportProcessing = "processing"
+	ExportReady      = "ready"
+	ExportFailed     = "failed"
+	ExportExpired    = "expired"
+
+	// exportClaimTimeout is how long an export may stay in processing before
+	// another worker picks it up again, in case its worker died.
+	exportClaimTimeout = time.Hour
+	// exportSessionsLimit bounds the sessions of an export to the latest ones.
+	exportSessionsLimit = 1000
+)
+
+// DataExport is a request of a user for a copy of their data.
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	FileKey     string     `json:"-"`
+	Expiry      *time.Time `json:"expiry,omitempty"`
+	CreatedAt   string     `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// ExportedFollow is a follower or a followed account in a data export.
+type ExportedFollow struct {
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username"`
+	FollowedAt string `json:"followed_at"`
+}
+
+// UserData is everything a data export holds about a user.
+type UserData struct {
+	Profile   *User            `json:"profile"`
+	Posts     []Post           `json:"posts"`
+	Comments  []Comment        `json:"comments"`
+	Followers []ExportedFollow `json:"followers"`
+	Following []ExportedFollow `json:"following"`
+	Sessions  []Session        `json:"sessions"`
+}
+
+type ExportStore struct {
+	db *sql.DB
+}
+
+func NewExport(db *sql.DB) *ExportStore {
+	return &ExportStore{
+		db: db,
+	}
+}
+
+// Create requests a new export for the user. It fails with ErrConflict while
+// another export of the user is on its way.
+func (s *ExportStore) Create(ctx context.Context, userID int64) (*DataExport, error) {
+	query := `
+		INSERT INTO data_exports (user_id)
+		SELECT $1
+		WHERE NOT EXISTS (
+			SELECT 1 FROM data_exports
+			WHERE user_id = $1 AND status IN ('pending', 'processing')
+		)
+		RETURNING id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	export := DataExport{UserID: userID}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&export.ID, &export.Status, &export.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrConflict
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// Claim marks the oldest pending export as processing and returns it, so
+// only one worker builds it. It fails with ErrNotFound when there is nothing
+// to do.
+func (s *ExportStore) Claim(ctx context.Context) (*DataExport, error) {
+	query := `
+		UPDATE data_exports SET status = 'processing', started_at = NOW()
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = 'pending' OR (status = 'processing' AND started_at < $1)
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var export DataExport
+	err := s.db.QueryRowContext(ctx, query, time.Now().Add(-exportClaimTimeout)).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// Complete makes the export downloadable with token, the hash of the token
+// emailed to the user, until expiry.
+func (s *ExportStore) Complete(ctx context.Context, exportID int64, fileKey string, token string, expiry time.Time) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'ready', file_key = $2, token = $3, expiry = $4, completed_at = NOW()
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// the export is gone when its account was purged in the meantime
+	res, err := s.db.ExecContext(ctx, query, exportID, fileKey, token, expiry)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *ExportStore) Fail(ctx context.Context, exportID int64) error {
+	query := `
+		UPDATE data_exports SET status = 'failed', completed_at = NOW()
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, exportID)
+	return err
+}
+
+// GetByToken returns the ready export the token gives access to.
+func (s *ExportStore) GetByToken(ctx context.Context, token string) (*DataExport, error) {
+	query := `
+		SELECT id, user_id, status, file_key, expiry, created_at, completed_at
+		FROM data_exports
+		WHERE token = $1 AND status = 'ready' AND expiry > $2
+	`
+
+	hash := sha256.Sum256([]byte(token))
+	hashedToken := hex.EncodeToString(hash[:])
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var export DataExport
+	err := s.db.QueryRowContext(ctx, query, hashedToken, time.Now()).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.FileKey,
+		&export.Expiry,
+		&export.CreatedAt,
+		&export.CompletedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// Expire marks the exports whose link expired and returns the keys of their
+// files, for them to be removed.
+func (s *ExportStore) Expire(ctx context.Context) ([]string, error) {
+	query := `
+		WITH expired AS (
+			SELECT id, file_key FROM data_exports
+			WHERE status = 'ready' AND expiry <= NOW()
+			FOR UPDATE
+		)
+		UPDATE data_exports d SET status = 'expired', file_key = '', token = NULL
+		FROM expired
+		WHERE d.id = expired.id
+		RETURNING expired.file_key
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetData gathers the data of the user for an export.
+func (s *ExportStore) GetData(ctx context.Context, userID int64) (*UserData, error) {
+	profile, err := NewUser(s.db).GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := UserData{Profile: profile}
+	if data.Posts, err = s.getPosts(ctx, userID); err != nil {
+		return nil, err
+	}
+	if data.Comments, err = s.getComments(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	followers := `
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1
+		ORDER BY f.id
+	`
+	if data.Followers, err = s.getFollows(ctx, followers, userID); err != nil {
+		return nil, err
+	}
+
+	following := `
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1
+		ORDER BY f.id
+	`
+	if data.Following, err = s.getFollows(ctx, following, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Sessions, err = NewSession(s.db).GetByUserID(ctx, userID, PaginatedKeyset{Limit: exportSessionsLimit}); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (s *ExportStore) getPosts(ctx context.Context, userID int64) ([]Post, error) {
+	query := `
+		SELECT id, content, title, user_id, tags, locale, entities, created_at, updated_at, version
+		FROM posts
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID,
+			&post.Content,
+			&post.Title,
+			&post.UserID,
+			pq.Array(&post.Tags),
+			&post.Locale,
+			&post.Entities,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (s *ExportStore) getComments(ctx context.Context, userID int64) ([]Comment, error) {
+	query := `
+		SELECT id, post_id, user_id, content, entities, created_at
+		FROM comments
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.UserID,
+			&comment.Content,
+			&comment.Entities,
+			&comment.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (s *ExportStore) getFollows(ctx context.Context, query string, userID int64) ([]ExportedFollow, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []ExportedFollow{}
+	for rows.Next() {
+		var follow ExportedFollow
+		if err := rows.Scan(&follow.UserID, &follow.Username, &follow.FollowedAt); err != nil {
+			return nil, err
+		}
+		follows = append(follows, follow)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return follows, nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// FilterDecision records a verdict of a content filter other than allow.
+// TargetID is nil when the content was rejected and never saved.
+type FilterDecision struct {
+	ID         int64     `json:"id"`
+	TargetType string    `json:"target_type"`
+	TargetID   *int64    `json:"target_id"`
+	UserID     int64     `json:"user_id"`
+	Filter     string    `json:"filter"`
+	Verdict    string    `json:"verdict"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type FilterDecisionStore struct {
+	db *sql.DB
+}
+
+func NewFilterDecision(db *sql.DB) *FilterDecisionStore {
+	return &FilterDecisionStore{
+		db: db,
+	}
+}
+
+func (s *FilterDecisionStore) Create(ctx context.Context, decisions []FilterDecision) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO content_filter_decisions (target_type, target_id, user_id, filter, verdict, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		for i := range decisions {
+			d := &decisions[i]
+			err := tx.QueryRowContext(
+				ctx,
+				query,
+				d.TargetType,
+				d.TargetID,
+				d.UserID,
+				d.Filter,
+				d.Verdict,
+				d.Reason,
+			).Scan(&d.ID, &d.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get returns the decisions about the content of the user, or of everyone
+// when userID is zero, newest first.
+func (s *FilterDecisionStore) Get(ctx context.Context, userID int64, p PaginatedKeyset) ([]FilterDecision, error) {
+	query := `
+		SELECT id, target_type, target_id, user_id, filter, verdict, reason, created_at
+		FROM content_filter_decisions
+		WHERE ($1::bigint = 0 OR user_id = $1) AND ($2::bigint = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, p.Before, p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := []FilterDecision{}
+	for rows.Next() {
+		var d FilterDecision
+		err := rows.Scan(
+			&d.ID,
+			&d.TargetType,
+			&d.TargetID,
+			&d.UserID,
+			&d.Filter,
+			&d.Verdict,
+			&d.Reason,
+			&d.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return decisions, nil
+}
@@ -8,12 +8,44 @@ import (
 	"github.com/lib/pq"
 )
 
+var (
+	ErrSelfFollow = errors.New("cannot follow yourself")
+)
+
 type Follower struct {
 	UserID     int64  `json:"user_id"`
 	FollowerID int64  `json:"follower_id"`
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowEntry is a user of a followers or following list. Cursor is the value
+// to pass as before to get the next page.
+type FollowEntry struct {
+	Cursor     int64  `json:"cursor"`
+	User       User   `json:"user"`
+	FollowedAt string `json:"followed_at"`
+}
+
+// FollowRequest is a pending follow of a private account.
+type FollowRequest struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Requester User   `json:"requester"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Relationship describes how the authenticated user relates to another user.
+type Relationship struct {
+	UserID     int64 `json:"user_id"`
+	Following  bool  `json:"following"`
+	Requested  bool  `json:"requested"`
+	FollowedBy bool  `json:"followed_by"`
+	Mutual     bool  `json:"mutual"`
+	Blocking   bool  `json:"blocking"`
+	BlockedBy  bool  `json:"blocked_by"`
+	Muting     bool  `json:"muting"`
+}
+
 type FollowerStore struct {
 	db *sql.DB
 }
@@ -24,14 +56,106 @@ func NewFollower(db *sql.DB) *FollowerStore {
 	}
 }
 
-func (s *FollowerStore) Follow(ctx context.Context, followerID int64, followedUserID int64) error {
+// Follow makes followerID follow followedUserID. When the followed account is
+// private a follow request is created instead and pending is true.
+func (s *FollowerStore) Follow(ctx context.Context, followerID int64, followedUserID int64) (bool, error) {
+	if followerID == followedUserID {
+		return false, ErrSelfFollow
+	}
+
+	var pending bool
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// nobody can follow across a block
+		blocked, err := isBlocked(ctx, tx, followerID, followedUserID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		pending, err = s.requiresApproval(ctx, tx, followerID, followedUserID)
+		if err != nil {
+			return err
+		}
+		if pending {
+			if err := s.createRequest(ctx, tx, followerID, followedUserID); err != nil {
+				return err
+			}
+			return createNotifications(ctx, tx, Notification{ActorID: followerID, Type: NotificationFollowRequest}, []int64{followedUserID})
+		}
+
+		// create the follow relationship
+		if err := s.follow(ctx, tx, followerID, followedUserID); err != nil {
+			return err
+		}
+
+		// notify the followed user
+		return createNotifications(ctx, tx, Notification{ActorID: followerID, Type: NotificationFollow}, []int64{followedUserID})
+	})
+
+	return pending, err
+}
+
+// requiresApproval reports whether following the user goes through a follow
+// request. Following an account twice is a conflict, private or not.
+func (s *FollowerStore) requiresApproval(ctx context.Context, tx *sql.Tx, followerID int64, followedUserID int64) (bool, error) {
+	query := `
+		SELECT is_private, EXISTS (
+			SELECT 1 FROM followers
+			WHERE user_id = $1 AND follower_id = $2
+		)
+		FROM users
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var private, following bool
+	err := tx.QueryRowContext(ctx, query, followedUserID, followerID).Scan(&private, &following)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrNotFound
+		default:
+			return false, err
+		}
+	}
+	if private && following {
+		return false, ErrConflict
+	}
+
+	return private, nil
+}
+
+func (s *FollowerStore) createRequest(ctx context.Context, tx *sql.Tx, requesterID int64, userID int64) error {
+	query := `
+		INSERT INTO follow_requests (user_id, requester_id)
+		VALUES ($1, $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FollowerStore) follow(ctx context.Context, tx *sql.Tx, followerID int64, followedUserID int64) error {
 	query := `
 		INSERT INTO followers (user_id, follower_id)
 		VALUES ($1,$2)
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, followedUserID, followerID)
+	_, err := tx.ExecContext(ctx, query, followedUserID, followerID)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			switch pqErr.Code.Name() {
@@ -41,26 +165,249 @@ func (s *FollowerStore) Follow(ctx context.Context, followerID int64, followedUs
 				return err
 			}
 		}
+		return err
 	}
 	return nil
 }
 
+// Unfollow removes the follow relationship, or the pending follow request.
 func (s *FollowerStore) Unfollow(ctx context.Context, followerID int64, followedUserID int64) error {
 	query := `
-		DELETE FROM followers
-		WHERE user_id = $1 AND follower_id = $2
+		WITH unfollowed AS (
+			DELETE FROM followers
+			WHERE user_id = $1 AND follower_id = $2
+			RETURNING 1
+		), cancelled AS (
+			DELETE FROM follow_requests
+			WHERE user_id = $1 AND requester_id = $2
+			RETURNING 1
+		)
+		SELECT (SELECT COUNT(*) FROM unfollowed) + (SELECT COUNT(*) FROM cancelled)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, followedUserID, followerID)
+
+	var deleted int64
+	if err := s.db.QueryRowContext(ctx, query, followedUserID, followerID).Scan(&deleted); err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetRequests lists the pending follow requests received by userID, most
+// recent first.
+func (s *FollowerStore) GetRequests(ctx context.Context, userID int64, p PaginatedKeyset) ([]FollowRequest, error) {
+	query := `
+		SELECT fr.id, fr.user_id, fr.created_at, u.id, u.username, u.created_at
+		FROM follow_requests fr
+		JOIN users u ON u.id = fr.requester_id
+		WHERE fr.user_id = $1 AND ($2::bigint = 0 OR fr.id < $2)
+		ORDER BY fr.id DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, p.Before, p.Limit)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+	for rows.Next() {
+		var request FollowRequest
+		err := rows.Scan(
+			&request.ID,
+			&request.UserID,
+			&request.CreatedAt,
+			&request.Requester.ID,
+			&request.Requester.Username,
+			&request.Requester.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// ApproveRequest turns the pending request of requesterID into a follow.
+func (s *FollowerStore) ApproveRequest(ctx context.Context, userID int64, requesterID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.deleteRequest(ctx, tx, userID, requesterID); err != nil {
 			return err
 		}
+
+		if err := s.follow(ctx, tx, requesterID, userID); err != nil {
+			return err
+		}
+
+		// notify the requester its request was accepted
+		return createNotifications(ctx, tx, Notification{ActorID: userID, Type: NotificationFollowAccepted}, []int64{requesterID})
+	})
+}
+
+func (s *FollowerStore) RejectRequest(ctx context.Context, userID int64, requesterID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return s.deleteRequest(ctx, tx, userID, requesterID)
+	})
+}
+
+func (s *FollowerStore) deleteRequest(ctx context.Context, tx *sql.Tx, userID int64, requesterID int64) error {
+	query := `
+		DELETE FROM follow_requests
+		WHERE user_id = $1 AND requester_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
 	}
 	return nil
 }
+
+// GetFollowers lists the users following userID, most recent first. Users
+// having a block with the viewer are left out.
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID int64, viewerID int64, p PaginatedKeyset) ([]FollowEntry, error) {
+	query := `
+		SELECT f.id, u.id, u.username, u.created_at, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1 AND ($2::bigint = 0 OR f.id < $2) AND NOT ` + blockedSQL("$4", "u.id") + `
+		ORDER BY f.id DESC
+		LIMIT $3
+	`
+
+	return s.getEntries(ctx, query, userID, p.Before, p.Limit, viewerID)
+}
+
+// GetFollowing lists the users followed by userID, most recent first. Users
+// having a block with the viewer are left out.
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID int64, viewerID int64, p PaginatedKeyset) ([]FollowEntry, error) {
+	query := `
+		SELECT f.id, u.id, u.username, u.created_at, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1 AND ($2::bigint = 0 OR f.id < $2) AND NOT ` + blockedSQL("$4", "u.id") + `
+		ORDER BY f.id DESC
+		LIMIT $3
+	`
+
+	return s.getEntries(ctx, query, userID, p.Before, p.Limit, viewerID)
+}
+
+func (s *FollowerStore) GetRelationship(ctx context.Context, userID int64, otherUserID int64) (*Relationship, error) {
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1),
+			EXISTS (SELECT 1 FROM follow_requests WHERE user_id = $2 AND requester_id = $1),
+			EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2),
+			EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2),
+			EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $2 AND blocked_id = $1),
+			EXISTS (SELECT 1 FROM user_mutes WHERE muter_id = $1 AND muted_id = $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	relationship := Relationship{UserID: otherUserID}
+	err := s.db.QueryRowContext(ctx, query, userID, otherUserID).Scan(
+		&relationship.Following,
+		&relationship.Requested,
+		&relationship.FollowedBy,
+		&relationship.Blocking,
+		&relationship.BlockedBy,
+		&relationship.Muting,
+	)
+	if err != nil {
+		return nil, err
+	}
+	relationship.Mutual = relationship.Following && relationship.FollowedBy
+
+	return &relationship, nil
+}
+
+func (s *FollowerStore) getEntries(ctx context.Context, query string, args ...any) ([]FollowEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []FollowEntry{}
+	for rows.Next() {
+		var entry FollowEntry
+		err := rows.Scan(
+			&entry.Cursor,
+			&entry.User.ID,
+			&entry.User.Username,
+			&entry.User.CreatedAt,
+			&entry.FollowedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetFollowerIDs returns the followers of the user who did not block or mute
+// it, the ones its posts are pushed to.
+func (s *FollowerStore) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+		SELECT follower_id FROM followers
+		WHERE user_id = $1 AND NOT ` + hiddenSQL("follower_id", "$1") + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// IdempotencyLockTimeout is how long a request may stay in flight. Past it the
+// request is taken for abandoned and its key may be claimed again.
+const IdempotencyLockTimeout = 2 * time.Minute
+
+// IdempotencyRecord is a request sent with an Idempotency-Key and, once it
+// completed, its response. Scope tells apart the keys of different clients
+// and routes.
+type IdempotencyRecord struct {
+	Scope       string
+	Key         string
+	Fingerprint string
+	Status      int
+	Headers     http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// InFlight reports whether the request has no response yet.
+func (r *IdempotencyRecord) InFlight() bool {
+	return r.Status == 0
+}
+
+type IdempotencyStore struct {
+	db *sql.DB
+}
+
+func NewIdempotency(db *sql.DB) *IdempotencyStore {
+	return &IdempotencyStore{
+		db: db,
+	}
+}
+
+// Claim reserves the key of the record for a new request. It returns nil when
+// the key is claimed, or else the record already holding the key. Expired
+// records and abandoned requests give their key up.
+func (s *IdempotencyStore) Claim(ctx context.Context, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	var existing *IdempotencyRecord
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			DELETE FROM idempotency_keys
+			WHERE scope = $1 AND key = $2 AND
+				(expires_at < NOW() OR (status IS NULL AND created_at < NOW() - make_interval(secs => $3)))
+		`
+		if _, err := tx.ExecContext(ctx, query, record.Scope, record.Key, IdempotencyLockTimeout.Seconds()); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO idempotency_keys (scope, key, fingerprint, expires_at)
+			VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+			ON CONFLICT (scope, key) DO NOTHING
+			RETURNING created_at, expires_at
+		`
+		err := tx.QueryRowContext(ctx, query, record.Scope, record.Key, record.Fingerprint, ttl.Seconds()).Scan(&record.CreatedAt, &record.ExpiresAt)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// the key is taken
+		query = `
+			SELECT fingerprint, status, headers, body, created_at, expires_at
+			FROM idempotency_keys
+			WHERE scope = $1 AND key = $2
+		`
+		var status sql.NullInt64
+		var headers []byte
+		existing = &IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+		err = tx.QueryRowContext(ctx, query, record.Scope, record.Key).Scan(
+			&existing.Fingerprint,
+			&status,
+			&headers,
+			&existing.Body,
+			&existing.CreatedAt,
+			&existing.ExpiresAt,
+		)
+		if err != nil {
+			return err
+		}
+		existing.Status = int(status.Int64)
+		return json.Unmarshal(headers, &existing.Headers)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// Complete saves the response of the request holding the key.
+func (s *IdempotencyStore) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	headers, err := json.Marshal(record.Headers)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = $3, headers = $4, body = $5
+		WHERE scope = $1 AND key = $2 AND fingerprint = $6
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, record.Scope, record.Key, record.Status, headers, record.Body, record.Fingerprint)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Release gives the key of a request that is still in flight up, so the
+// request can be retried.
+func (s *IdempotencyStore) Release(ctx context.Context, scope string, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+// DeleteExpired drops the records past their expiry.
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context) error {
+	query := `DELETE FROM idempotency_keys WHERE expires_at < NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query)
+	return err
+}
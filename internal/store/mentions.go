@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// createPostMentions records the mentioned users of a post and returns the
+// ones that weren't mentioned before.
+func createPostMentions(ctx context.Context, tx *sql.Tx, postID int64, userIDs []int64) ([]int64, error) {
+	query := `
+		INSERT INTO post_mentions (post_id, user_id)
+		SELECT $1, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+		RETURNING user_id
+	`
+
+	return insertMentions(ctx, tx, query, postID, userIDs)
+}
+
+// deletePostMentions removes the mentions of a post except the ones in keep.
+func deletePostMentions(ctx context.Context, tx *sql.Tx, postID int64, keep []int64) error {
+	query := `
+		DELETE FROM post_mentions
+		WHERE post_id = $1 AND NOT (user_id = ANY($2::bigint[]))
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, postID, pq.Array(keep))
+	return err
+}
+
+// createCommentMentions records the mentioned users of a comment and returns
+// the ones that weren't mentioned before.
+func createCommentMentions(ctx context.Context, tx *sql.Tx, commentID int64, userIDs []int64) ([]int64, error) {
+	query := `
+		INSERT INTO comment_mentions (comment_id, user_id)
+		SELECT $1, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+		RETURNING user_id
+	`
+
+	return insertMentions(ctx, tx, query, commentID, userIDs)
+}
+
+func insertMentions(ctx context.Context, tx *sql.Tx, query string, id int64, userIDs []int64) ([]int64, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, query, id, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var created []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		created = append(created, userID)
+	}
+
+	return created, rows.Err()
+}
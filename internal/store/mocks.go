@@ -3,39 +3,964 @@ package store
 import (
 	"context"
 	"database/sql"
+	"sort"
+	"sync"
 	"time"
-)
 
+	"github.com/longlnOff/social/internal/trending"
+)
 
 func NewMockStore() Storage {
+	graph := newMockGraph()
+	posts := &MockPostStore{graph: graph, posts: map[int64]*Post{}, hidden: map[int64]bool{}}
 	return Storage{
-		User: &MockUserStore{},
+		User:           &MockUserStore{graph: graph},
+		Post:           posts,
+		Comment:        &MockCommentStore{posts: posts},
+		Block:          &MockBlockStore{graph: graph},
+		Follower:       &MockFollowerStore{graph: graph},
+		Suggestion:     &MockSuggestionStore{graph: graph},
+		Role:           &MockRoleStore{},
+		Audit:          &MockAuditStore{},
+		Suspension:     &MockSuspensionStore{graph: graph},
+		FilterDecision: &MockFilterDecisionStore{},
+		Idempotency:    NewMockIdempotencyStore(),
+		Notification:   &MockNotificationStore{graph: graph},
+		Conversation:   &MockConversationStore{graph: graph, conversations: map[int64]*Conversation{}, followedOnly: map[int64]bool{}},
+	}
+}
+
+// mockGraph is the state shared by the mock stores: the users and their
+// suspensions, usernames and roles, the private accounts, the follows and
+// the blocks. It applies the rules of visibility.go, so the
+// handlers can be tested against them without a database.
+type mockGraph struct {
+	mu          sync.Mutex
+	users       map[string]*User // by email
+	usernames   map[int64]string
+	suspensions map[int64][]Suspension
+	renames     map[string]string // former username, current username
+	roles       map[int64]string
+	private     map[int64]bool
+	follows     map[[2]int64]bool // followed user, follower
+	requests    map[[2]int64]bool // requested user, requester
+	blocks      map[[2]int64]bool // blocker, blocked user
+	mutes       map[[2]int64]bool // muter, muted user
+	deleted     map[int64]bool
+}
 
+func newMockGraph() *mockGraph {
+	return &mockGraph{
+		users:       map[string]*User{},
+		suspensions: map[int64][]Suspension{},
+		usernames:   map[int64]string{},
+		renames:     map[string]string{},
+		roles:       map[int64]string{},
+		private:     map[int64]bool{},
+		follows:     map[[2]int64]bool{},
+		requests:    map[[2]int64]bool{},
+		blocks:      map[[2]int64]bool{},
+		mutes:       map[[2]int64]bool{},
+		deleted:     map[int64]bool{},
 	}
 }
 
-type MockUserStore struct {}
+// pendingSuspensions is getPendingSuspensions.
+func (g *mockGraph) pendingSuspensions(userID int64) []Suspension {
+	suspensions := []Suspension{}
+	for _, s := range g.suspensions[userID] {
+		if s.LiftedAt == nil && (s.EndsAt == nil || s.EndsAt.After(time.Now())) {
+			suspensions = append(suspensions, s)
+		}
+	}
+	return suspensions
+}
+
+// blocked is blockedSQL.
+func (g *mockGraph) blocked(userID int64, otherUserID int64) bool {
+	return g.blocks[[2]int64{userID, otherUserID}] || g.blocks[[2]int64{otherUserID, userID}]
+}
+
+// hidden is hiddenSQL.
+func (g *mockGraph) hidden(viewerID int64, authorID int64) bool {
+	return g.blocked(viewerID, authorID) || g.mutes[[2]int64{viewerID, authorID}]
+}
+
+// visible is visibleSQL.
+func (g *mockGraph) visible(viewerID int64, authorID int64) bool {
+	return viewerID == authorID || !g.private[authorID] || g.follows[[2]int64{authorID, viewerID}]
+}
+
+type MockUserStore struct {
+	graph *mockGraph
+}
 
 func (m *MockUserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	return nil
 }
 
 func (m *MockUserStore) GetByUserID(ctx context.Context, userID int64) (*User, error) {
-	return nil, nil
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if m.graph.deleted[userID] {
+		return nil, ErrNotFound
+	}
+	user := &User{ID: userID, IsPrivate: m.graph.private[userID], Suspensions: m.graph.pendingSuspensions(userID)}
+	if name, ok := m.graph.roles[userID]; ok {
+		role, err := (&MockRoleStore{}).GetByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		user.RoleID, user.Role = role.ID, *role
+	}
+	return user, nil
 }
 
 func (m *MockUserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
-	return nil, nil
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	user, ok := m.graph.users[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *user
+	copied.Suspensions = m.graph.pendingSuspensions(user.ID)
+	return &copied, nil
 }
 
-func (m *MockUserStore) CreateAndInvite(ctx context.Context, token string, user *User, invitationExpirationDuration time.Duration) error {
+func (m *MockUserStore) GetIDsByUsernames(ctx context.Context, usernames []string, actorID int64) (map[string]int64, error) {
+	return map[string]int64{}, nil
+}
+
+func (m *MockUserStore) SetPrivacy(ctx context.Context, userID int64, private bool) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	m.graph.private[userID] = private
 	return nil
 }
 
-func (m *MockUserStore) ActivateUser(ctx context.Context, token string) error {
+func (m *MockUserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if _, renamed := m.graph.renames[username]; renamed {
+		return nil, ErrNotFound
+	}
+	for userID, current := range m.graph.usernames {
+		if current == username {
+			return &User{ID: userID, Username: username}, nil
+		}
+	}
+	return &User{ID: 1, Username: username}, nil
+}
+
+func (m *MockUserStore) GetUsernameRedirect(ctx context.Context, username string) (string, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	current, ok := m.graph.renames[username]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return current, nil
+}
+
+func (m *MockUserStore) UpdateProfile(ctx context.Context, userID int64, update ProfileUpdate) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if update.Username != nil {
+		if former, ok := m.graph.usernames[userID]; ok {
+			for old, current := range m.graph.renames {
+				if current == former {
+					m.graph.renames[old] = *update.Username
+				}
+			}
+			m.graph.renames[former] = *update.Username
+		}
+		delete(m.graph.renames, *update.Username)
+		m.graph.usernames[userID] = *update.Username
+	}
 	return nil
 }
 
+func (m *MockUserStore) UpdateAvatar(ctx context.Context, userID int64, avatarURL string) (string, error) {
+	return "", nil
+}
+
+func (m *MockUserStore) VerifyEmail(ctx context.Context, token string) (int64, error) {
+	return 1, nil
+}
+
+func (m *MockUserStore) GetStats(ctx context.Context, userID int64) (*UserStats, error) {
+	return &UserStats{}, nil
+}
+
+func (m *MockUserStore) CreateAndInvite(ctx context.Context, token string, user *User, invitationExpirationDuration time.Duration) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if _, ok := m.graph.users[user.Email]; ok {
+		return ErrDuplicateEmail
+	}
+	user.ID = int64(len(m.graph.users) + 1)
+	copied := *user
+	m.graph.users[user.Email] = &copied
+	return nil
+}
+
+func (m *MockUserStore) ActivateUser(ctx context.Context, token string) (int64, error) {
+	return 1, nil
+}
+
 func (m *MockUserStore) Delete(ctx context.Context, userID int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	m.graph.deleted[userID] = true
+	return nil
+}
+
+func (m *MockUserStore) ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error {
+	return nil
+}
+
+func (m *MockUserStore) CancelDeletion(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) GetDueDeletions(ctx context.Context, limit int) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (m *MockUserStore) Purge(ctx context.Context, userID int64, policy DeletionPolicy) (*PurgedFiles, error) {
+	return &PurgedFiles{ExportKeys: []string{}}, nil
+}
+
+func (m *MockUserStore) Search(ctx context.Context, p PaginatedUsers) ([]User, error) {
+	return []User{}, nil
+}
+
+func (m *MockUserStore) SetRole(ctx context.Context, userID int64, roleName string) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	m.graph.roles[userID] = roleName
+	return nil
+}
+
+func (m *MockUserStore) SetActive(ctx context.Context, userID int64, active bool) error {
+	return nil
+}
+
+func (m *MockUserStore) RevokeTokens(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) CreateInvitation(ctx context.Context, token string, userID int64, invitationExpirationDuration time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) GetRecentActivity(ctx context.Context, userID int64, limit int) ([]UserActivity, error) {
+	return []UserActivity{}, nil
+}
+
+type MockBlockStore struct {
+	graph *mockGraph
+}
+
+func (m *MockBlockStore) Block(ctx context.Context, blockerID int64, blockedID int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if m.graph.deleted[blockedID] {
+		return ErrNotFound
+	}
+	m.graph.blocks[[2]int64{blockerID, blockedID}] = true
+	delete(m.graph.follows, [2]int64{blockerID, blockedID})
+	delete(m.graph.follows, [2]int64{blockedID, blockerID})
+	delete(m.graph.requests, [2]int64{blockerID, blockedID})
+	delete(m.graph.requests, [2]int64{blockedID, blockerID})
+	return nil
+}
+
+func (m *MockBlockStore) Unblock(ctx context.Context, blockerID int64, blockedID int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if !m.graph.blocks[[2]int64{blockerID, blockedID}] {
+		return ErrNotFound
+	}
+	delete(m.graph.blocks, [2]int64{blockerID, blockedID})
+	return nil
+}
+
+func (m *MockBlockStore) Mute(ctx context.Context, muterID int64, mutedID int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if m.graph.deleted[mutedID] {
+		return ErrNotFound
+	}
+	m.graph.mutes[[2]int64{muterID, mutedID}] = true
+	return nil
+}
+
+func (m *MockBlockStore) Unmute(ctx context.Context, muterID int64, mutedID int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if !m.graph.mutes[[2]int64{muterID, mutedID}] {
+		return ErrNotFound
+	}
+	delete(m.graph.mutes, [2]int64{muterID, mutedID})
+	return nil
+}
+
+func (m *MockBlockStore) IsBlocked(ctx context.Context, userID int64, otherUserID int64) (bool, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	return m.graph.blocked(userID, otherUserID), nil
+}
+
+func (m *MockBlockStore) IsHidden(ctx context.Context, viewerID int64, authorID int64) (bool, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	return m.graph.hidden(viewerID, authorID), nil
+}
+
+func (m *MockBlockStore) GetBlocked(ctx context.Context, userID int64) ([]User, error) {
+	return []User{}, nil
+}
+
+func (m *MockBlockStore) GetMuted(ctx context.Context, userID int64) ([]User, error) {
+	return []User{}, nil
+}
+
+// MockPostStore keeps the posts in memory and shows them to the viewers
+// like PostStore does.
+type MockPostStore struct {
+	graph  *mockGraph
+	posts  map[int64]*Post
+	hidden map[int64]bool
+}
+
+func (m *MockPostStore) Create(ctx context.Context, post *Post) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	post.ID = int64(len(m.posts) + 1)
+	copied := *post
+	copied.Hold = ""
+	m.posts[post.ID] = &copied
+	m.hidden[post.ID] = post.Hold != ""
+	return nil
+}
+
+func (m *MockPostStore) GetByID(ctx context.Context, id int64, viewerID int64) (*Post, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	post, ok := m.posts[id]
+	if !ok || m.graph.blocked(viewerID, post.UserID) || !m.graph.visible(viewerID, post.UserID) ||
+		(m.hidden[id] && post.UserID != viewerID) {
+		return nil, ErrNotFound
+	}
+	copied := *post
+	return &copied, nil
+}
+
+func (m *MockPostStore) GetByIDForModeration(ctx context.Context, id int64) (*Post, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	post, ok := m.posts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *post
+	return &copied, nil
+}
+
+func (m *MockPostStore) Update(ctx context.Context, post *Post) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if _, ok := m.posts[post.ID]; !ok {
+		return ErrNotFound
+	}
+	post.Version++
+	copied := *post
+	copied.Hold = ""
+	m.posts[post.ID] = &copied
+	if post.Hold != "" {
+		m.hidden[post.ID] = true
+	}
+	return nil
+}
+
+func (m *MockPostStore) Delete(ctx context.Context, id int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if _, ok := m.posts[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.posts, id)
+	return nil
+}
+
+func (m *MockPostStore) GetUserFeed(ctx context.Context, userID int64, p PaginatedFeed) ([]PostWithMetadata, error) {
+	return []PostWithMetadata{}, nil
+}
+
+func (m *MockPostStore) GetByIDs(ctx context.Context, ids []int64, viewerID int64) ([]Post, error) {
+	return []Post{}, nil
+}
+
+func (m *MockPostStore) GetActivity(ctx context.Context, since time.Time) ([]trending.Activity, error) {
+	return []trending.Activity{}, nil
+}
+
+// MockCommentStore keeps the comments in memory, refusing the ones across a
+// block with the owner of the post like CommentStore does.
+type MockCommentStore struct {
+	posts    *MockPostStore
+	Comments []Comment
+}
+
+func (m *MockCommentStore) Create(ctx context.Context, comment *Comment) error {
+	m.posts.graph.mu.Lock()
+	defer m.posts.graph.mu.Unlock()
+
+	post, ok := m.posts.posts[comment.PostID]
+	if !ok {
+		return ErrNotFound
+	}
+	if m.posts.graph.blocked(comment.UserID, post.UserID) {
+		return ErrBlocked
+	}
+	comment.ID = int64(len(m.Comments) + 1)
+	m.Comments = append(m.Comments, *comment)
+	return nil
+}
+
+func (m *MockCommentStore) GetByPostID(ctx context.Context, postID int64, viewerID int64) ([]Comment, error) {
+	m.posts.graph.mu.Lock()
+	defer m.posts.graph.mu.Unlock()
+
+	comments := []Comment{}
+	for _, comment := range m.Comments {
+		if comment.PostID == postID && !m.posts.graph.blocked(viewerID, comment.UserID) {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+// MockFollowerStore keeps the follows and the follow requests in the graph.
+type MockFollowerStore struct {
+	graph *mockGraph
+}
+
+func (m *MockFollowerStore) Follow(ctx context.Context, followerID int64, followedUserID int64) (bool, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	if followerID == followedUserID {
+		return false, ErrSelfFollow
+	}
+	if m.graph.blocked(followerID, followedUserID) {
+		return false, ErrBlocked
+	}
+	key := [2]int64{followedUserID, followerID}
+	if m.graph.follows[key] {
+		return false, ErrConflict
+	}
+	if m.graph.private[followedUserID] {
+		if m.graph.requests[key] {
+			return false, ErrConflict
+		}
+		m.graph.requests[key] = true
+		return true, nil
+	}
+	m.graph.follows[key] = true
+	return false, nil
+}
+
+func (m *MockFollowerStore) Unfollow(ctx context.Context, followerID int64, followedUserID int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	key := [2]int64{followedUserID, followerID}
+	if !m.graph.follows[key] && !m.graph.requests[key] {
+		return ErrNotFound
+	}
+	delete(m.graph.follows, key)
+	delete(m.graph.requests, key)
 	return nil
 }
+
+func (m *MockFollowerStore) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	ids := []int64{}
+	for key := range m.graph.follows {
+		if key[0] == userID && !m.graph.hidden(key[1], userID) {
+			ids = append(ids, key[1])
+		}
+	}
+	return ids, nil
+}
+
+func (m *MockFollowerStore) GetFollowers(ctx context.Context, userID int64, viewerID int64, p PaginatedKeyset) ([]FollowEntry, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	entries := []FollowEntry{}
+	for key := range m.graph.follows {
+		if key[0] == userID && !m.graph.blocked(viewerID, key[1]) {
+			entries = append(entries, FollowEntry{User: User{ID: key[1]}})
+		}
+	}
+	return entries, nil
+}
+
+func (m *MockFollowerStore) GetFollowing(ctx context.Context, userID int64, viewerID int64, p PaginatedKeyset) ([]FollowEntry, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	entries := []FollowEntry{}
+	for key := range m.graph.follows {
+		if key[1] == userID && !m.graph.blocked(viewerID, key[0]) {
+			entries = append(entries, FollowEntry{User: User{ID: key[0]}})
+		}
+	}
+	return entries, nil
+}
+
+func (m *MockFollowerStore) GetRelationship(ctx context.Context, userID int64, otherUserID int64) (*Relationship, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	relationship := &Relationship{
+		UserID:     otherUserID,
+		Following:  m.graph.follows[[2]int64{otherUserID, userID}],
+		Requested:  m.graph.requests[[2]int64{otherUserID, userID}],
+		FollowedBy: m.graph.follows[[2]int64{userID, otherUserID}],
+		Blocking:   m.graph.blocks[[2]int64{userID, otherUserID}],
+		BlockedBy:  m.graph.blocks[[2]int64{otherUserID, userID}],
+		Muting:     m.graph.mutes[[2]int64{userID, otherUserID}],
+	}
+	relationship.Mutual = relationship.Following && relationship.FollowedBy
+	return relationship, nil
+}
+
+func (m *MockFollowerStore) GetRequests(ctx context.Context, userID int64, p PaginatedKeyset) ([]FollowRequest, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	requests := []FollowRequest{}
+	for key := range m.graph.requests {
+		if key[0] == userID {
+			requests = append(requests, FollowRequest{UserID: userID, Requester: User{ID: key[1]}})
+		}
+	}
+	return requests, nil
+}
+
+func (m *MockFollowerStore) ApproveRequest(ctx context.Context, userID int64, requesterID int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	key := [2]int64{userID, requesterID}
+	if !m.graph.requests[key] {
+		return ErrNotFound
+	}
+	delete(m.graph.requests, key)
+	m.graph.follows[key] = true
+	return nil
+}
+
+func (m *MockFollowerStore) RejectRequest(ctx context.Context, userID int64, requesterID int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	key := [2]int64{userID, requesterID}
+	if !m.graph.requests[key] {
+		return ErrNotFound
+	}
+	delete(m.graph.requests, key)
+	return nil
+}
+
+// MockSuggestionStore suggests the accounts followed by the accounts the
+// user follows, by number of mutual follows, like SuggestionStore does.
+type MockSuggestionStore struct {
+	graph *mockGraph
+}
+
+func (m *MockSuggestionStore) Refresh(ctx context.Context) error {
+	return nil
+}
+
+func (m *MockSuggestionStore) GetByUserID(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	mutuals := map[int64]int64{}
+	for followed := range m.graph.follows {
+		if followed[1] != userID {
+			continue
+		}
+		for next := range m.graph.follows {
+			suggestedID := next[0]
+			if next[1] == followed[0] && suggestedID != userID && m.suggestable(userID, suggestedID) {
+				mutuals[suggestedID]++
+			}
+		}
+	}
+
+	suggestions := []Suggestion{}
+	for suggestedID, count := range mutuals {
+		suggestions = append(suggestions, Suggestion{User: User{ID: suggestedID}, Score: float64(count), MutualCount: count})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].User.ID < suggestions[j].User.ID
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// suggestable is suggestableSQL.
+func (m *MockSuggestionStore) suggestable(userID int64, suggestedID int64) bool {
+	key := [2]int64{suggestedID, userID}
+	return !m.graph.follows[key] && !m.graph.requests[key] && !m.graph.blocked(userID, suggestedID)
+}
+
+type MockRoleStore struct{}
+
+func (m *MockRoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
+	levels := map[string]int64{"user": 0, "moderator": 1, "admin": 2}
+	level, ok := levels[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &Role{Name: name, Level: level}, nil
+}
+
+type MockAuditStore struct{}
+
+func (m *MockAuditStore) Create(ctx context.Context, event *AuditEvent) error {
+	return nil
+}
+
+func (m *MockAuditStore) Get(ctx context.Context, p PaginatedAudit) ([]AuditEvent, error) {
+	return []AuditEvent{}, nil
+}
+
+func (m *MockAuditStore) Verify(ctx context.Context) (*AuditVerification, error) {
+	return &AuditVerification{}, nil
+}
+
+type MockSuspensionStore struct {
+	graph *mockGraph
+}
+
+func (m *MockSuspensionStore) Create(ctx context.Context, suspension *Suspension) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	suspension.ID = int64(len(m.graph.suspensions[suspension.UserID]) + 1)
+	m.graph.suspensions[suspension.UserID] = append(m.graph.suspensions[suspension.UserID], *suspension)
+	return nil
+}
+
+func (m *MockSuspensionStore) Lift(ctx context.Context, userID int64, suspensionID int64, liftedBy int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	for i, s := range m.graph.suspensions[userID] {
+		if s.ID == suspensionID && s.LiftedAt == nil {
+			now := time.Now()
+			m.graph.suspensions[userID][i].LiftedAt = &now
+			m.graph.suspensions[userID][i].LiftedBy = &liftedBy
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MockSuspensionStore) GetByUserID(ctx context.Context, userID int64) ([]Suspension, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	return append([]Suspension{}, m.graph.suspensions[userID]...), nil
+}
+
+type MockFilterDecisionStore struct{}
+
+func (m *MockFilterDecisionStore) Create(ctx context.Context, decisions []FilterDecision) error {
+	return nil
+}
+
+func (m *MockFilterDecisionStore) Get(ctx context.Context, userID int64, p PaginatedKeyset) ([]FilterDecision, error) {
+	return []FilterDecision{}, nil
+}
+
+// MockIdempotencyStore keeps the records in memory, so the replays can be
+// tested.
+type MockIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+}
+
+func NewMockIdempotencyStore() *MockIdempotencyStore {
+	return &MockIdempotencyStore{records: map[string]*IdempotencyRecord{}}
+}
+
+func (m *MockIdempotencyStore) Claim(ctx context.Context, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[record.Scope+" "+record.Key]; ok {
+		copied := *existing
+		return &copied, nil
+	}
+	copied := *record
+	m.records[record.Scope+" "+record.Key] = &copied
+	return nil, nil
+}
+
+func (m *MockIdempotencyStore) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copied := *record
+	m.records[record.Scope+" "+record.Key] = &copied
+	return nil
+}
+
+func (m *MockIdempotencyStore) Release(ctx context.Context, scope string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, scope+" "+key)
+	return nil
+}
+
+func (m *MockIdempotencyStore) DeleteExpired(ctx context.Context) error {
+	return nil
+}
+
+// MockNotificationStore keeps the notifications in memory, so the tests can
+// check who sees which.
+type MockNotificationStore struct {
+	graph         *mockGraph
+	mu            sync.Mutex
+	Notifications []Notification
+}
+
+func (m *MockNotificationStore) GetRecipients(ctx context.Context, n Notification, userIDs []int64) ([]int64, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	ids := []int64{}
+	for _, id := range userIDs {
+		if id != n.ActorID && !m.graph.hidden(id, n.ActorID) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *MockNotificationStore) GetByUserID(ctx context.Context, userID int64, p PaginatedNotifications) ([]Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	notifications := []Notification{}
+	for _, n := range m.Notifications {
+		if n.UserID == userID {
+			notifications = append(notifications, n)
+		}
+	}
+	return notifications, nil
+}
+
+func (m *MockNotificationStore) GetGroupedByUserID(ctx context.Context, userID int64, p PaginatedNotifications) ([]NotificationGroup, error) {
+	return []NotificationGroup{}, nil
+}
+
+func (m *MockNotificationStore) MarkRead(ctx context.Context, userID int64, notificationID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, n := range m.Notifications {
+		if n.ID == notificationID && n.UserID == userID {
+			readAt := "now"
+			m.Notifications[i].ReadAt = &readAt
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MockNotificationStore) MarkAllRead(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockNotificationStore) GetPreferences(ctx context.Context, userID int64) (*NotificationPreferences, error) {
+	return &NotificationPreferences{Follow: true, Comment: true, Mention: true}, nil
+}
+
+func (m *MockNotificationStore) UpdatePreferences(ctx context.Context, userID int64, prefs *NotificationPreferences) error {
+	return nil
+}
+
+// MockConversationStore keeps the conversations in memory and lets users
+// message each other like ConversationStore does.
+type MockConversationStore struct {
+	graph         *mockGraph
+	conversations map[int64]*Conversation
+	messages      []Message
+	followedOnly  map[int64]bool
+}
+
+func (m *MockConversationStore) Create(ctx context.Context, conversation *Conversation, participantIDs []int64, message *Message) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	conversation.ID = int64(len(m.conversations) + 1)
+	for _, userID := range append([]int64{conversation.CreatedBy}, participantIDs...) {
+		conversation.Participants = append(conversation.Participants, Participant{UserID: userID})
+	}
+	message.ConversationID = conversation.ID
+	m.createMessage(message)
+	conversation.LastMessage = message
+
+	copied := *conversation
+	m.conversations[conversation.ID] = &copied
+	return nil
+}
+
+func (m *MockConversationStore) FindDirect(ctx context.Context, userID int64, otherUserID int64) (*Conversation, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	for _, conversation := range m.conversations {
+		if !conversation.IsGroup && m.isParticipant(conversation, userID) && m.isParticipant(conversation, otherUserID) {
+			copied := *conversation
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MockConversationStore) GetByID(ctx context.Context, conversationID int64, userID int64) (*Conversation, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	conversation, ok := m.conversations[conversationID]
+	if !ok || !m.isParticipant(conversation, userID) {
+		return nil, ErrNotFound
+	}
+	copied := *conversation
+	return &copied, nil
+}
+
+func (m *MockConversationStore) GetByUserID(ctx context.Context, userID int64, p PaginatedKeyset) ([]Conversation, error) {
+	return []Conversation{}, nil
+}
+
+func (m *MockConversationStore) CountUnread(ctx context.Context, userID int64) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockConversationStore) CanMessage(ctx context.Context, senderID int64, recipientIDs []int64) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	for _, recipientID := range recipientIDs {
+		if m.graph.blocked(senderID, recipientID) ||
+			(m.followedOnly[recipientID] && !m.graph.follows[[2]int64{senderID, recipientID}]) {
+			return ErrMessagingNotAllowed
+		}
+	}
+	return nil
+}
+
+func (m *MockConversationStore) CreateMessage(ctx context.Context, message *Message) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	conversation, ok := m.conversations[message.ConversationID]
+	if !ok {
+		return ErrNotFound
+	}
+	if !conversation.IsGroup {
+		for _, participant := range conversation.Participants {
+			if participant.UserID != message.SenderID && m.graph.blocked(message.SenderID, participant.UserID) {
+				return ErrMessagingNotAllowed
+			}
+		}
+	}
+	m.createMessage(message)
+	return nil
+}
+
+func (m *MockConversationStore) GetMessages(ctx context.Context, conversationID int64, p PaginatedKeyset) ([]Message, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	messages := []Message{}
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].ConversationID == conversationID {
+			messages = append(messages, m.messages[i])
+		}
+	}
+	return messages, nil
+}
+
+func (m *MockConversationStore) MarkRead(ctx context.Context, conversationID int64, userID int64, messageID int64) error {
+	return nil
+}
+
+func (m *MockConversationStore) GetSettings(ctx context.Context, userID int64) (*MessagingSettings, error) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	return &MessagingSettings{FollowedOnly: m.followedOnly[userID]}, nil
+}
+
+func (m *MockConversationStore) UpdateSettings(ctx context.Context, userID int64, settings *MessagingSettings) error {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+
+	m.followedOnly[userID] = settings.FollowedOnly
+	return nil
+}
+
+func (m *MockConversationStore) isParticipant(conversation *Conversation, userID int64) bool {
+	for _, participant := range conversation.Participants {
+		if participant.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockConversationStore) createMessage(message *Message) {
+	message.ID = int64(len(m.messages) + 1)
+	m.messages = append(m.messages, *message)
+}
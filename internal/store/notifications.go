@@ -0,0 +1,417 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const (
+	NotificationFollow         = "follow"
+	NotificationFollowRequest  = "follow_request"
+	NotificationFollowAccepted = "follow_accepted"
+	NotificationComment        = "comment"
+	NotificationMention        = "mention"
+	NotificationWarning        = "moderation_warning"
+	NotificationReportResolved = "report_resolved"
+
+	// number of actor usernames kept on a notification group
+	maxGroupActors = 3
+)
+
+var NotificationTypes = []string{NotificationFollow, NotificationComment, NotificationMention}
+
+// Notification is about what the actor did. The notifications from the
+// moderators have no actor, their ActorID is zero, so the moderator stays
+// anonymous and cannot be muted away.
+type Notification struct {
+	ID        int64   `json:"id"`
+	UserID    int64   `json:"user_id"`
+	ActorID   int64   `json:"actor_id"`
+	Type      string  `json:"type"`
+	PostID    *int64  `json:"post_id,omitempty"`
+	CommentID *int64  `json:"comment_id,omitempty"`
+	CaseID    *int64  `json:"case_id,omitempty"`
+	ReadAt    *string `json:"read_at"`
+	CreatedAt string  `json:"created_at"`
+	Actor     User    `json:"actor"`
+}
+
+// NotificationGroup aggregates the notifications of the same type about the
+// same post, e.g. "alice and 3 others commented on your post".
+type NotificationGroup struct {
+	Type        string   `json:"type"`
+	PostID      *int64   `json:"post_id,omitempty"`
+	Actors      []string `json:"actors"`
+	ActorsCount int64    `json:"actors_count"`
+	Unread      bool     `json:"unread"`
+	LatestAt    string   `json:"latest_at"`
+	Summary     string   `json:"summary"`
+}
+
+type NotificationPreferences struct {
+	Follow  bool `json:"follow"`
+	Comment bool `json:"comment"`
+	Mention bool `json:"mention"`
+}
+
+// Enabled reports whether notifications of the given type are wanted.
+func (p *NotificationPreferences) Enabled(notificationType string) bool {
+	switch preferenceType(notificationType) {
+	case NotificationFollow:
+		return p.Follow
+	case NotificationComment:
+		return p.Comment
+	case NotificationMention:
+		return p.Mention
+	default:
+		return true
+	}
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+func NewNotification(db *sql.DB) *NotificationStore {
+	return &NotificationStore{
+		db: db,
+	}
+}
+
+func (s *NotificationStore) GetByUserID(ctx context.Context, userID int64, p PaginatedNotifications) ([]Notification, error) {
+	query := `
+		SELECT n.id, n.user_id, COALESCE(n.actor_id, 0), n.type, n.post_id, n.comment_id, n.case_id, n.read_at, n.created_at, COALESCE(u.username, '')
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		WHERE
+			n.user_id = $1 AND
+			($2 = false OR n.read_at IS NULL) AND
+			($3 = '' OR n.type = $3) AND
+			(n.actor_id IS NULL OR NOT ` + hiddenSQL("$1", "n.actor_id") + `)
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $4 OFFSET $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, p.Unread, p.Type, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.ActorID,
+			&n.Type,
+			&n.PostID,
+			&n.CommentID,
+			&n.CaseID,
+			&n.ReadAt,
+			&n.CreatedAt,
+			&n.Actor.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+		n.Actor.ID = n.ActorID
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (s *NotificationStore) GetGroupedByUserID(ctx context.Context, userID int64, p PaginatedNotifications) ([]NotificationGroup, error) {
+	query := `
+		SELECT
+			n.type,
+			n.post_id,
+			array_remove(array_agg(u.username ORDER BY n.created_at DESC), NULL),
+			COUNT(DISTINCT n.actor_id),
+			bool_or(n.read_at IS NULL),
+			MAX(n.created_at)
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		WHERE
+			n.user_id = $1 AND
+			($2 = false OR n.read_at IS NULL) AND
+			($3 = '' OR n.type = $3) AND
+			(n.actor_id IS NULL OR NOT ` + hiddenSQL("$1", "n.actor_id") + `)
+		GROUP BY n.type, n.post_id
+		ORDER BY MAX(n.created_at) DESC
+		LIMIT $4 OFFSET $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, p.Unread, p.Type, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []NotificationGroup{}
+	for rows.Next() {
+		var g NotificationGroup
+		var actors []string
+		err := rows.Scan(
+			&g.Type,
+			&g.PostID,
+			pq.Array(&actors),
+			&g.ActorsCount,
+			&g.Unread,
+			&g.LatestAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		g.Actors = latestActors(actors)
+		g.Summary = g.summarize()
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// GetRecipients returns the users among userIDs who want the notification:
+// they did not turn its type off, nor block or mute its actor.
+func (s *NotificationStore) GetRecipients(ctx context.Context, n Notification, userIDs []int64) ([]int64, error) {
+	query := `
+		SELECT r.id
+		FROM unnest($1::bigint[]) AS r(id)
+		WHERE r.id <> $2 AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences np
+			WHERE np.user_id = r.id AND np.type = $3 AND np.enabled = false
+		) AND NOT ` + hiddenSQL("r.id", "$2") + `
+	`
+
+	if len(userIDs) == 0 {
+		return []int64{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(userIDs), n.ActorID, preferenceType(n.Type))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (s *NotificationStore) MarkRead(ctx context.Context, userID int64, notificationID int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, notificationID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (s *NotificationStore) GetPreferences(ctx context.Context, userID int64) (*NotificationPreferences, error) {
+	query := `
+		SELECT type, enabled
+		FROM notification_preferences
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// every type is enabled unless the user turned it off
+	prefs := &NotificationPreferences{Follow: true, Comment: true, Mention: true}
+	for rows.Next() {
+		var notificationType string
+		var enabled bool
+		if err := rows.Scan(&notificationType, &enabled); err != nil {
+			return nil, err
+		}
+		switch notificationType {
+		case NotificationFollow:
+			prefs.Follow = enabled
+		case NotificationComment:
+			prefs.Comment = enabled
+		case NotificationMention:
+			prefs.Mention = enabled
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+func (s *NotificationStore) UpdatePreferences(ctx context.Context, userID int64, prefs *NotificationPreferences) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, type, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE
+		SET enabled = EXCLUDED.enabled, updated_at = NOW()
+	`
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		for _, notificationType := range NotificationTypes {
+			ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+			_, err := tx.ExecContext(ctx, query, userID, notificationType, prefs.Enabled(notificationType))
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createNotifications emits a notification of the given type to every
+// recipient, skipping the actor itself, the recipients who turned the type
+// off in their preferences and the ones who blocked or muted the actor.
+func createNotifications(ctx context.Context, tx *sql.Tx, n Notification, recipients []int64) error {
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id, case_id)
+		SELECT r.id, NULLIF($2, 0), $3, $4, $5, $7
+		FROM unnest($1::bigint[]) AS r(id)
+		WHERE r.id <> $2 AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences np
+			WHERE np.user_id = r.id AND np.type = $6 AND np.enabled = false
+		) AND NOT ` + hiddenSQL("r.id", "$2") + `
+	`
+
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, pq.Array(recipients), n.ActorID, n.Type, n.PostID, n.CommentID, preferenceType(n.Type), n.CaseID)
+	return err
+}
+
+// preferenceType returns the preference governing a notification type, the
+// follow requests go along with the follows.
+func preferenceType(notificationType string) string {
+	switch notificationType {
+	case NotificationFollowRequest, NotificationFollowAccepted:
+		return NotificationFollow
+	default:
+		return notificationType
+	}
+}
+
+func latestActors(actors []string) []string {
+	seen := map[string]bool{}
+	latest := []string{}
+	for _, actor := range actors {
+		if seen[actor] {
+			continue
+		}
+		seen[actor] = true
+		latest = append(latest, actor)
+		if len(latest) == maxGroupActors {
+			break
+		}
+	}
+	return latest
+}
+
+func (g *NotificationGroup) summarize() string {
+	var action string
+	switch g.Type {
+	case NotificationFollow:
+		action = "followed you"
+	case NotificationFollowRequest:
+		action = "requested to follow you"
+	case NotificationFollowAccepted:
+		action = "accepted your follow request"
+	case NotificationComment:
+		action = "commented on your post"
+	case NotificationMention:
+		action = "mentioned you"
+	case NotificationWarning:
+		action = "warned you about your content"
+	case NotificationReportResolved:
+		action = "reviewed your report"
+	default:
+		action = g.Type
+	}
+
+	if len(g.Actors) == 0 {
+		if g.ActorsCount == 0 {
+			return "The moderators " + action
+		}
+		return ""
+	}
+	switch {
+	case g.ActorsCount <= 1:
+		return fmt.Sprintf("%s %s", g.Actors[0], action)
+	case g.ActorsCount == 2 && len(g.Actors) >= 2:
+		return fmt.Sprintf("%s and %s %s", g.Actors[0], g.Actors[1], action)
+	default:
+		return fmt.Sprintf("%s and %d others %s", g.Actors[0], g.ActorsCount-1, action)
+	}
+}
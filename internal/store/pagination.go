@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type PaginatedFeed struct {
@@ -51,3 +52,227 @@ func (p PaginatedFeed) Parse(r *http.Request) (PaginatedFeed, error) {
 
 	return p, nil
 }
+
+type PaginatedNotifications struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Unread bool   `json:"unread"`
+	Type   string `json:"type" validate:"omitempty,oneof=follow follow_request follow_accepted comment mention moderation_warning report_resolved"`
+}
+
+func (p PaginatedNotifications) Parse(r *http.Request) (PaginatedNotifications, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return p, err
+		}
+		p.Limit = limitInt
+	}
+
+	offset := r.URL.Query().Get("offset")
+	if offset != "" {
+		offsetInt, err := strconv.Atoi(offset)
+		if err != nil {
+			return p, err
+		}
+		p.Offset = offsetInt
+	}
+
+	unread := r.URL.Query().Get("unread")
+	if unread != "" {
+		unreadBool, err := strconv.ParseBool(unread)
+		if err != nil {
+			return p, err
+		}
+		p.Unread = unreadBool
+	}
+
+	notificationType := r.URL.Query().Get("type")
+	if notificationType != "" {
+		p.Type = notificationType
+	}
+
+	return p, nil
+}
+
+// PaginatedKeyset pages through rows ordered by a descending ID, Before is
+// the ID of the last row of the previous page.
+type PaginatedKeyset struct {
+	Limit  int   `json:"limit" validate:"gte=1,lte=50"`
+	Before int64 `json:"before" validate:"gte=0"`
+}
+
+func (p PaginatedKeyset) Parse(r *http.Request) (PaginatedKeyset, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return p, err
+		}
+		p.Limit = limitInt
+	}
+
+	before := r.URL.Query().Get("before")
+	if before != "" {
+		beforeInt, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			return p, err
+		}
+		p.Before = beforeInt
+	}
+
+	return p, nil
+}
+
+// PaginatedUsers searches the users for the administrators.
+type PaginatedUsers struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Search string `json:"search" validate:"max=100"`
+	Role   string `json:"role" validate:"omitempty,oneof=user moderator admin"`
+	Status string `json:"status" validate:"omitempty,oneof=active inactive pending_deletion suspended"`
+}
+
+func (p PaginatedUsers) Parse(r *http.Request) (PaginatedUsers, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return p, err
+		}
+		p.Limit = limitInt
+	}
+
+	offset := r.URL.Query().Get("offset")
+	if offset != "" {
+		offsetInt, err := strconv.Atoi(offset)
+		if err != nil {
+			return p, err
+		}
+		p.Offset = offsetInt
+	}
+
+	if search := r.URL.Query().Get("search"); search != "" {
+		p.Search = search
+	}
+
+	if role := r.URL.Query().Get("role"); role != "" {
+		p.Role = role
+	}
+
+	if status := r.URL.Query().Get("status"); status != "" {
+		p.Status = status
+	}
+
+	return p, nil
+}
+
+// PaginatedAudit filters the audit log, pages go back in time by event ID.
+type PaginatedAudit struct {
+	Limit      int        `json:"limit" validate:"gte=1,lte=100"`
+	Before     int64      `json:"before" validate:"gte=0"`
+	ActorID    int64      `json:"actor_id" validate:"gte=0"`
+	Action     string     `json:"action" validate:"max=100"`
+	TargetType string     `json:"target_type" validate:"max=50"`
+	TargetID   int64      `json:"target_id" validate:"gte=0"`
+	Since      *time.Time `json:"since"`
+	Until      *time.Time `json:"until"`
+}
+
+func (p PaginatedAudit) Parse(r *http.Request) (PaginatedAudit, error) {
+	query := r.URL.Query()
+
+	ints := map[string]*int64{
+		"before":    &p.Before,
+		"actor_id":  &p.ActorID,
+		"target_id": &p.TargetID,
+	}
+	for name, dest := range ints {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return p, err
+			}
+			*dest = parsed
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return p, err
+		}
+		p.Limit = limitInt
+	}
+
+	if action := query.Get("action"); action != "" {
+		p.Action = action
+	}
+
+	if targetType := query.Get("target_type"); targetType != "" {
+		p.TargetType = targetType
+	}
+
+	times := map[string]**time.Time{
+		"since": &p.Since,
+		"until": &p.Until,
+	}
+	for name, dest := range times {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return p, err
+			}
+			*dest = &parsed
+		}
+	}
+
+	return p, nil
+}
+
+// PaginatedCases filters the moderation queue, pages go back in time by case
+// ID.
+type PaginatedCases struct {
+	Limit      int    `json:"limit" validate:"gte=1,lte=100"`
+	Before     int64  `json:"before" validate:"gte=0"`
+	Status     string `json:"status" validate:"omitempty,oneof=open in_review actioned dismissed"`
+	TargetType string `json:"target_type" validate:"omitempty,oneof=post comment user"`
+	AssigneeID int64  `json:"assignee_id" validate:"gte=0"`
+}
+
+func (p PaginatedCases) Parse(r *http.Request) (PaginatedCases, error) {
+	query := r.URL.Query()
+
+	ints := map[string]*int64{
+		"before":      &p.Before,
+		"assignee_id": &p.AssigneeID,
+	}
+	for name, dest := range ints {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return p, err
+			}
+			*dest = parsed
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return p, err
+		}
+		p.Limit = limitInt
+	}
+
+	if status := query.Get("status"); status != "" {
+		p.Status = status
+	}
+
+	if targetType := query.Get("target_type"); targetType != "" {
+		p.TargetType = targetType
+	}
+
+	return p, nil
+}
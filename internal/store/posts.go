@@ -4,21 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
+	"github.com/longlnOff/social/internal/content"
+	"github.com/longlnOff/social/internal/trending"
 )
 
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	Version   int64     `json:"version"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID        int64            `json:"id"`
+	Content   string           `json:"content"`
+	Title     string           `json:"title"`
+	UserID    int64            `json:"user_id"`
+	Tags      []string         `json:"tags"`
+	Locale    string           `json:"locale"`
+	Entities  content.Entities `json:"entities"`
+	Version   int64            `json:"version"`
+	CreatedAt string           `json:"created_at"`
+	UpdatedAt string           `json:"updated_at"`
+	Comments  []Comment        `json:"comments"`
+	User      User             `json:"user"`
+	// Hold is the reason to hold the new or edited post for review, it
+	// stays hidden until a moderator looks into it.
+	Hold string `json:"-"`
 }
 
 type PostWithMetadata struct {
@@ -39,16 +47,18 @@ func NewPost(db *sql.DB) *PostStore {
 func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, p PaginatedFeed) ([]PostWithMetadata, error) {
 	query := `
 		SELECT 
-		p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username,
+		p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.locale, p.entities, u.username,
 		COUNT(c.id) AS comments_count
 		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
+		LEFT JOIN comments c ON c.post_id = p.id AND c.hidden_at IS NULL
 		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
 		WHERE 
-			f.user_id = $1 OR p.user_id = $1 AND
+			(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1)) AND
 			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-			(p.tags @> $5 OR p.tags='{}')
+			(p.tags @> $5 OR p.tags='{}') AND
+			NOT ` + hiddenSQL("$1", "p.user_id") + ` AND
+			NOT ` + moderatedSQL("$1", "p.hidden_at", "p.user_id") + ` AND
+			` + visibleSQL("$1", "p.user_id") + `
 		GROUP BY p.id, u.username
 		ORDER BY p.created_at ` + p.Sort + ` 
 		LIMIT $2 OFFSET $3
@@ -75,6 +85,8 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, p PaginatedFe
 			&feed.CreatedAt,
 			&feed.Version,
 			pq.Array(&feed.Tags),
+			&feed.Locale,
+			&feed.Entities,
 			&feed.User.Username,
 			&feed.CommentsCount,
 		)
@@ -88,22 +100,44 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, p PaginatedFe
 }
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// create the post
+		if err := s.create(ctx, tx, post); err != nil {
+			return err
+		}
+
+		// record the mentioned users and notify them, unless the post is held
+		mentioned, err := createPostMentions(ctx, tx, post.ID, post.Entities.MentionedUserIDs())
+		if err != nil {
+			return err
+		}
+		if post.Hold != "" {
+			return holdContent(ctx, tx, ReportTargetPost, post.ID, post.UserID, post.Hold)
+		}
+		return createNotifications(ctx, tx, Notification{ActorID: post.UserID, Type: NotificationMention, PostID: &post.ID}, mentioned)
+	})
+}
+
+func (s *PostStore) create(ctx context.Context, tx *sql.Tx, post *Post) error {
 	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1,$2,$3,$4)
+		INSERT INTO posts (content, title, user_id, tags, entities, locale, hidden_at)
+		VALUES ($1,$2,$3,$4,$5,$6, CASE WHEN $7 THEN NOW() END)
 		RETURNING id, created_at, updated_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	return s.db.QueryRowContext(
+	return tx.QueryRowContext(
 		ctx,
 		query,
 		post.Content,
 		post.Title,
 		post.UserID,
 		pq.Array(post.Tags),
+		post.Entities,
+		post.Locale,
+		post.Hold != "",
 	).Scan(
 		&post.ID,
 		&post.CreatedAt,
@@ -111,9 +145,48 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	)
 }
 
-func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
+// GetByID returns a post as seen by the viewer, the posts of blocked users
+// and of private accounts the viewer does not follow are not found.
+func (s *PostStore) GetByID(ctx context.Context, id int64, viewerID int64) (*Post, error) {
+	query := `
+		SELECT id, content, title, user_id, tags, locale, entities, created_at, updated_at, version
+		FROM posts
+		WHERE id = $1 AND NOT ` + blockedSQL("$2", "posts.user_id") + ` AND ` + visibleSQL("$2", "posts.user_id") + ` AND
+			NOT ` + moderatedSQL("$2", "posts.hidden_at", "posts.user_id") + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var post Post
+	err := s.db.QueryRowContext(ctx, query, id, viewerID).Scan(
+		&post.ID,
+		&post.Content,
+		&post.Title,
+		&post.UserID,
+		pq.Array(&post.Tags),
+		&post.Locale,
+		&post.Entities,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &post, nil
+}
+
+// GetByIDForModeration returns a post whoever the author is and whether it
+// is hidden, for the moderators.
+func (s *PostStore) GetByIDForModeration(ctx context.Context, id int64) (*Post, error) {
 	query := `
-		SELECT id, content, title, user_id, tags, created_at, updated_at, version
+		SELECT id, content, title, user_id, tags, locale, entities, created_at, updated_at, version
 		FROM posts
 		WHERE id = $1
 	`
@@ -127,6 +200,8 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		&post.Title,
 		&post.UserID,
 		pq.Array(&post.Tags),
+		&post.Locale,
+		&post.Entities,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.Version,
@@ -144,22 +219,50 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 }
 
 func (s *PostStore) Update(ctx context.Context, post *Post) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// update the post
+		if err := s.update(ctx, tx, post); err != nil {
+			return err
+		}
+
+		// replace the mentioned users and notify the new ones
+		mentionedIDs := post.Entities.MentionedUserIDs()
+		if err := deletePostMentions(ctx, tx, post.ID, mentionedIDs); err != nil {
+			return err
+		}
+		mentioned, err := createPostMentions(ctx, tx, post.ID, mentionedIDs)
+		if err != nil {
+			return err
+		}
+		if post.Hold != "" {
+			return holdContent(ctx, tx, ReportTargetPost, post.ID, post.UserID, post.Hold)
+		}
+		return createNotifications(ctx, tx, Notification{ActorID: post.UserID, Type: NotificationMention, PostID: &post.ID}, mentioned)
+	})
+}
+
+func (s *PostStore) update(ctx context.Context, tx *sql.Tx, post *Post) error {
 	query := `
 		UPDATE posts
-		SET title = $1, content = $2, version = version + 1
-		WHERE id = $3 AND version = $4
+		SET title = $1, content = $2, tags = $3, entities = $4, locale = $5, version = version + 1,
+			hidden_at = CASE WHEN $8 THEN NOW() ELSE hidden_at END
+		WHERE id = $6 AND version = $7
 		RETURNING version
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx,
+	err := tx.QueryRowContext(ctx,
 		query,
 		post.Title,
 		post.Content,
+		pq.Array(post.Tags),
+		post.Entities,
+		post.Locale,
 		post.ID,
-		post.Version).Scan(&post.Version)
+		post.Version,
+		post.Hold != "").Scan(&post.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -171,6 +274,96 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	return err
 }
 
+// GetByIDs returns the posts visible to the viewer among ids, in no
+// particular order.
+func (s *PostStore) GetByIDs(ctx context.Context, ids []int64, viewerID int64) ([]Post, error) {
+	query := `
+		SELECT p.id, p.content, p.title, p.user_id, p.tags, p.locale, p.entities, p.created_at, p.updated_at, p.version, u.username
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.id = ANY($1) AND NOT ` + hiddenSQL("$2", "p.user_id") + ` AND ` + visibleSQL("$2", "p.user_id") + ` AND
+			NOT ` + moderatedSQL("$2", "p.hidden_at", "p.user_id") + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID,
+			&post.Content,
+			&post.Title,
+			&post.UserID,
+			pq.Array(&post.Tags),
+			&post.Locale,
+			&post.Entities,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+			&post.User.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+		post.User.ID = post.UserID
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetActivity returns the activity on the posts of public accounts since the
+// given time, for the trending computation.
+func (s *PostStore) GetActivity(ctx context.Context, since time.Time) ([]trending.Activity, error) {
+	query := `
+		SELECT p.id, p.tags, p.locale, c.created_at
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = p.user_id
+		WHERE c.created_at > $1 AND u.is_private = false AND p.hidden_at IS NULL AND c.hidden_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := []trending.Activity{}
+	for rows.Next() {
+		activity := trending.Activity{Kind: trending.KindComment}
+		err := rows.Scan(
+			&activity.PostID,
+			pq.Array(&activity.Tags),
+			&activity.Locale,
+			&activity.At,
+		)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return activities, nil
+}
+
 func (s *PostStore) Delete(ctx context.Context, id int64) error {
 	query := `
 		DELETE FROM posts
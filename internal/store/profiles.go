@@ -0,0 +1,260 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UsernameChangeInterval is the time to wait between two username changes.
+const UsernameChangeInterval = 30 * 24 * time.Hour
+
+var (
+	ErrUsernameChangeTooSoon = errors.New("username was changed too recently")
+)
+
+// Profile holds the public profile fields of a user.
+type Profile struct {
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Website     string `json:"website"`
+	Location    string `json:"location"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// ProfileUpdate lists the fields to change, nil fields are left as they are.
+// A new Email is not applied: it is kept along with EmailToken, the hash of
+// the token emailed to the user, until the token is confirmed with
+// VerifyEmail.
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	Website     *string
+	Location    *string
+	Username    *string
+	Email       *string
+	EmailToken  string
+	EmailExpiry time.Duration
+}
+
+// UpdateProfile applies the update to the user in a single transaction.
+func (u *UserStore) UpdateProfile(ctx context.Context, userID int64, update ProfileUpdate) error {
+	return withTx(ctx, u.db, func(tx *sql.Tx) error {
+		if update.Username != nil {
+			if err := u.changeUsername(ctx, tx, userID, *update.Username); err != nil {
+				return err
+			}
+		}
+
+		if err := u.updateProfile(ctx, tx, userID, update); err != nil {
+			return err
+		}
+
+		if update.Email != nil {
+			return u.createEmailVerification(ctx, tx, userID, *update.Email, update.EmailToken, update.EmailExpiry)
+		}
+		return nil
+	})
+}
+
+// UpdateAvatar sets the avatar of the user and returns the previous one.
+func (u *UserStore) UpdateAvatar(ctx context.Context, userID int64, avatarURL string) (string, error) {
+	query := `
+		UPDATE users u SET avatar_url = $2
+		FROM (SELECT avatar_url FROM users WHERE id = $1 FOR UPDATE) previous
+		WHERE u.id = $1
+		RETURNING previous.avatar_url
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var previous string
+	err := u.db.QueryRowContext(ctx, query, userID, avatarURL).Scan(&previous)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return previous, nil
+}
+
+// GetUsernameRedirect returns the current username of the user who last
+// went by username.
+func (u *UserStore) GetUsernameRedirect(ctx context.Context, username string) (string, error) {
+	query := `
+		SELECT u.username
+		FROM username_history h
+		JOIN users u ON u.id = h.user_id
+		WHERE h.username = $1 AND u.is_active = true
+		ORDER BY h.id DESC
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var current string
+	err := u.db.QueryRowContext(ctx, query, username).Scan(&current)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return current, nil
+}
+
+// VerifyEmail applies the pending email change of the token and returns the
+// ID of its user.
+func (u *UserStore) VerifyEmail(ctx context.Context, token string) (int64, error) {
+	var userID int64
+	err := withTx(ctx, u.db, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM email_verifications
+			WHERE token = $1 AND expiry > $2
+			RETURNING user_id, email
+		`
+
+		hash := sha256.Sum256([]byte(token))
+		hashedToken := hex.EncodeToString(hash[:])
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var email string
+		err := tx.QueryRowContext(ctx, query, hashedToken, time.Now()).Scan(&userID, &email)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET email = $2 WHERE id = $1`, userID, email); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+				return ErrDuplicateEmail
+			}
+			return err
+		}
+
+		// other pending changes are void once the email changed
+		_, err = tx.ExecContext(ctx, `DELETE FROM email_verifications WHERE user_id = $1`, userID)
+		return err
+	})
+
+	return userID, err
+}
+
+func (u *UserStore) changeUsername(ctx context.Context, tx *sql.Tx, userID int64, username string) error {
+	query := `
+		SELECT username, username_changed_at
+		FROM users
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var current string
+	var changedAt sql.NullTime
+	if err := tx.QueryRowContext(ctx, query, userID).Scan(&current, &changedAt); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	if current == username {
+		return nil
+	}
+	if changedAt.Valid && time.Since(changedAt.Time) < UsernameChangeInterval {
+		return ErrUsernameChangeTooSoon
+	}
+
+	query = `
+		UPDATE users SET username = $2, username_changed_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, username); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrDuplicateUsername
+		}
+		return err
+	}
+
+	query = `
+		INSERT INTO username_history (user_id, username)
+		VALUES ($1, $2)
+	`
+	_, err := tx.ExecContext(ctx, query, userID, current)
+	return err
+}
+
+func (u *UserStore) updateProfile(ctx context.Context, tx *sql.Tx, userID int64, update ProfileUpdate) error {
+	query := `
+		UPDATE users SET
+			display_name = COALESCE($2, display_name),
+			bio = COALESCE($3, bio),
+			website = COALESCE($4, website),
+			location = COALESCE($5, location)
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, userID, update.DisplayName, update.Bio, update.Website, update.Location)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (u *UserStore) createEmailVerification(ctx context.Context, tx *sql.Tx, userID int64, email string, token string, expiry time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var taken bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, email).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateEmail
+	}
+
+	// only the latest requested email can be confirmed
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_verifications WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO email_verifications (token, user_id, email, expiry)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := tx.ExecContext(ctx, query, token, userID, email, time.Now().Add(expiry))
+	return err
+}
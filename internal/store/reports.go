@@ -0,0 +1,493 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+
+	// CaseSourceReport cases are opened by the reports of users,
+	// CaseSourceFilter ones by the content filters holding content.
+	CaseSourceReport = "report"
+	CaseSourceFilter = "filter"
+
+	CaseOpen      = "open"
+	CaseInReview  = "in_review"
+	CaseActioned  = "actioned"
+	CaseDismissed = "dismissed"
+
+	// ModerationHide hides the reported post or comment from everyone but
+	// its author.
+	ModerationHide = "hide"
+	// ModerationWarn notifies the author of the reported content.
+	ModerationWarn = "warn"
+	// ModerationSuspend suspends the author of the reported content.
+	ModerationSuspend = "suspend"
+	// ModerationDismiss closes the case without action.
+	ModerationDismiss = "dismiss"
+)
+
+var (
+	ErrSelfReport              = errors.New("cannot report yourself or your own content")
+	ErrCaseResolved            = errors.New("moderation case is already resolved")
+	ErrInvalidModerationAction = errors.New("action does not apply to the reported content")
+)
+
+// Report is the complaint of a user about a post, a comment or a user.
+type Report struct {
+	ID         int64  `json:"id"`
+	CaseID     int64  `json:"case_id"`
+	ReporterID int64  `json:"reporter_id"`
+	TargetType string `json:"target_type"`
+	TargetID   int64  `json:"target_id"`
+	Reason     string `json:"reason"`
+	Note       string `json:"note"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// ModerationCase gathers the reports about the same content, until a
+// moderator acts on it or dismisses it. TargetUserID is the author of the
+// content, or the reported user.
+type ModerationCase struct {
+	ID           int64      `json:"id"`
+	TargetType   string     `json:"target_type"`
+	TargetID     int64      `json:"target_id"`
+	TargetUserID int64      `json:"target_user_id"`
+	Source       string     `json:"source"`
+	Status       string     `json:"status"`
+	AssigneeID   *int64     `json:"assignee_id,omitempty"`
+	Action       string     `json:"action,omitempty"`
+	Note         string     `json:"note,omitempty"`
+	ReportsCount int64      `json:"reports_count"`
+	ResolvedBy   *int64     `json:"resolved_by,omitempty"`
+	CreatedAt    string     `json:"created_at"`
+	UpdatedAt    string     `json:"updated_at"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+	Reports      []Report   `json:"reports,omitempty"`
+}
+
+// CaseResolution is the decision of a moderator on a case. SuspendUntil ends
+// the suspension of the suspend action, nil suspends for good.
+type CaseResolution struct {
+	ModeratorID  int64
+	Action       string
+	Note         string
+	SuspendUntil *time.Time
+}
+
+// Pending reports whether the case still waits for a decision.
+func (c *ModerationCase) Pending() bool {
+	return c.Status == CaseOpen || c.Status == CaseInReview
+}
+
+type ReportStore struct {
+	db *sql.DB
+}
+
+func NewReport(db *sql.DB) *ReportStore {
+	return &ReportStore{
+		db: db,
+	}
+}
+
+// Create files the report under the pending case of its target, opening one
+// when there is none. It fails with ErrNotFound when the target does not
+// exist, ErrSelfReport when it belongs to the reporter and ErrConflict when
+// the reporter already reported it.
+func (s *ReportStore) Create(ctx context.Context, report *Report) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		targetUserID, err := getReportTargetUserID(ctx, tx, report.TargetType, report.TargetID)
+		if err != nil {
+			return err
+		}
+		if targetUserID == report.ReporterID {
+			return ErrSelfReport
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			INSERT INTO moderation_cases (target_type, target_id, target_user_id, reports_count)
+			VALUES ($1, $2, $3, 1)
+			ON CONFLICT (target_type, target_id) WHERE status IN ('open', 'in_review')
+			DO UPDATE SET reports_count = moderation_cases.reports_count + 1, updated_at = NOW()
+			RETURNING id
+		`
+		if err := tx.QueryRowContext(ctx, query, report.TargetType, report.TargetID, targetUserID).Scan(&report.CaseID); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO reports (case_id, reporter_id, reason, note)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at
+		`
+		err = tx.QueryRowContext(ctx, query, report.CaseID, report.ReporterID, report.Reason, report.Note).Scan(
+			&report.ID,
+			&report.CreatedAt,
+		)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+				return ErrConflict
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// getReportTargetUserID returns the author of the reported content, or the
+// reported user itself.
+func getReportTargetUserID(ctx context.Context, tx *sql.Tx, targetType string, targetID int64) (int64, error) {
+	var query string
+	switch targetType {
+	case ReportTargetPost:
+		query = `SELECT user_id FROM posts WHERE id = $1`
+	case ReportTargetComment:
+		query = `SELECT user_id FROM comments WHERE id = $1`
+	case ReportTargetUser:
+		query = `SELECT id FROM users WHERE id = $1 AND deleted_at IS NULL`
+	default:
+		return 0, fmt.Errorf("unknown report target %q", targetType)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	if err := tx.QueryRowContext(ctx, query, targetID).Scan(&userID); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+const caseColumns = `id, target_type, target_id, target_user_id, source, status, assignee_id, action, note,
+			reports_count, resolved_by, created_at, updated_at, resolved_at`
+
+func scanCase(row rowScanner, c *ModerationCase) error {
+	return row.Scan(
+		&c.ID,
+		&c.TargetType,
+		&c.TargetID,
+		&c.TargetUserID,
+		&c.Source,
+		&c.Status,
+		&c.AssigneeID,
+		&c.Action,
+		&c.Note,
+		&c.ReportsCount,
+		&c.ResolvedBy,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.ResolvedAt,
+	)
+}
+
+// GetCases returns the cases matching the filters, newest first.
+func (s *ReportStore) GetCases(ctx context.Context, p PaginatedCases) ([]ModerationCase, error) {
+	query := `
+		SELECT ` + caseColumns + `
+		FROM moderation_cases
+		WHERE ($1::bigint = 0 OR id < $1) AND
+			($2::text = '' OR status = $2) AND
+			($3::text = '' OR target_type = $3) AND
+			($4::bigint = 0 OR assignee_id = $4)
+		ORDER BY id DESC
+		LIMIT $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, p.Before, p.Status, p.TargetType, p.AssigneeID, p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cases := []ModerationCase{}
+	for rows.Next() {
+		var c ModerationCase
+		if err := scanCase(rows, &c); err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cases, nil
+}
+
+// GetCase returns the case along with its reports.
+func (s *ReportStore) GetCase(ctx context.Context, caseID int64) (*ModerationCase, error) {
+	query := `
+		SELECT ` + caseColumns + `
+		FROM moderation_cases
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var c ModerationCase
+	if err := scanCase(s.db.QueryRowContext(ctx, query, caseID), &c); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		SELECT id, case_id, reporter_id, reason, note, created_at
+		FROM reports
+		WHERE case_id = $1
+		ORDER BY id
+	`
+	rows, err := s.db.QueryContext(ctx, query, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c.Reports = []Report{}
+	for rows.Next() {
+		report := Report{TargetType: c.TargetType, TargetID: c.TargetID}
+		err := rows.Scan(
+			&report.ID,
+			&report.CaseID,
+			&report.ReporterID,
+			&report.Reason,
+			&report.Note,
+			&report.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.Reports = append(c.Reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Assign puts the case in review by the moderator. It fails with
+// ErrCaseResolved when the case is already resolved.
+func (s *ReportStore) Assign(ctx context.Context, caseID int64, assigneeID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := lockPendingCase(ctx, tx, caseID); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			UPDATE moderation_cases
+			SET assignee_id = $2, status = 'in_review', updated_at = NOW()
+			WHERE id = $1
+		`
+		_, err := tx.ExecContext(ctx, query, caseID, assigneeID)
+		return err
+	})
+}
+
+// Resolve applies the action of the moderator to the case and notifies its
+// reporters of the outcome. It fails with ErrCaseResolved when the case is
+// already resolved and with ErrInvalidModerationAction when the action does
+// not apply to the target, like hiding a user.
+func (s *ReportStore) Resolve(ctx context.Context, caseID int64, resolution CaseResolution) (*ModerationCase, error) {
+	var c *ModerationCase
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		if c, err = lockPendingCase(ctx, tx, caseID); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		// the moderators notify as a team, the moderator is only known to
+		// the other moderators
+		notification := Notification{CaseID: &c.ID}
+		switch c.TargetType {
+		case ReportTargetPost:
+			notification.PostID = &c.TargetID
+		case ReportTargetComment:
+			notification.CommentID = &c.TargetID
+		}
+
+		status := CaseActioned
+		switch resolution.Action {
+		case ModerationHide:
+			var query string
+			switch c.TargetType {
+			case ReportTargetPost:
+				query = `UPDATE posts SET hidden_at = NOW() WHERE id = $1`
+			case ReportTargetComment:
+				query = `UPDATE comments SET hidden_at = NOW() WHERE id = $1`
+			default:
+				return ErrInvalidModerationAction
+			}
+			if _, err := tx.ExecContext(ctx, query, c.TargetID); err != nil {
+				return err
+			}
+		case ModerationWarn:
+			notification.Type = NotificationWarning
+			if err := createNotifications(ctx, tx, notification, []int64{c.TargetUserID}); err != nil {
+				return err
+			}
+		case ModerationSuspend:
+			suspension := Suspension{
+				UserID:   c.TargetUserID,
+				Kind:     SuspensionFull,
+				Reason:   resolution.Note,
+				StartsAt: time.Now(),
+				EndsAt:   resolution.SuspendUntil,
+				IssuedBy: &resolution.ModeratorID,
+			}
+			if err := createSuspension(ctx, tx, &suspension); err != nil {
+				return err
+			}
+		case ModerationDismiss:
+			status = CaseDismissed
+			// the content held by the filters is fine after all
+			if c.Source == CaseSourceFilter {
+				if err := unhideContent(ctx, tx, c.TargetType, c.TargetID); err != nil {
+					return err
+				}
+			}
+		default:
+			return ErrInvalidModerationAction
+		}
+
+		query := `
+			UPDATE moderation_cases
+			SET status = $2, action = $3, note = $4, resolved_by = $5,
+				assignee_id = COALESCE(assignee_id, $5), resolved_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+			RETURNING ` + caseColumns + `
+		`
+		if err := scanCase(tx.QueryRowContext(ctx, query, c.ID, status, resolution.Action, resolution.Note, resolution.ModeratorID), c); err != nil {
+			return err
+		}
+
+		reporterIDs, err := getCaseReporterIDs(ctx, tx, c.ID)
+		if err != nil {
+			return err
+		}
+		notification.Type = NotificationReportResolved
+		return createNotifications(ctx, tx, notification, reporterIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// holdContent opens a case for the content held by the filters, which was
+// saved hidden.
+func holdContent(ctx context.Context, tx *sql.Tx, targetType string, targetID int64, userID int64, reason string) error {
+	query := `
+		INSERT INTO moderation_cases (target_type, target_id, target_user_id, source, note)
+		VALUES ($1, $2, $3, 'filter', $4)
+		ON CONFLICT (target_type, target_id) WHERE status IN ('open', 'in_review') DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, targetType, targetID, userID, reason)
+	return err
+}
+
+func unhideContent(ctx context.Context, tx *sql.Tx, targetType string, targetID int64) error {
+	var query string
+	switch targetType {
+	case ReportTargetPost:
+		query = `UPDATE posts SET hidden_at = NULL WHERE id = $1`
+	case ReportTargetComment:
+		query = `UPDATE comments SET hidden_at = NULL WHERE id = $1`
+	default:
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, targetID)
+	return err
+}
+
+// lockPendingCase locks the case until the end of the transaction.
+func lockPendingCase(ctx context.Context, tx *sql.Tx, caseID int64) (*ModerationCase, error) {
+	query := `
+		SELECT ` + caseColumns + `
+		FROM moderation_cases
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var c ModerationCase
+	if err := scanCase(tx.QueryRowContext(ctx, query, caseID), &c); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	if !c.Pending() {
+		return nil, ErrCaseResolved
+	}
+	return &c, nil
+}
+
+func getCaseReporterIDs(ctx context.Context, tx *sql.Tx, caseID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, `SELECT reporter_id FROM reports WHERE case_id = $1`, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
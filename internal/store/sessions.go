@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Session records a token issued to a user. Tokens are stateless, a session
+// only tells where and when a user logged in.
+type Session struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"user_agent"`
+	CreatedAt string     `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+func NewSession(db *sql.DB) *SessionStore {
+	return &SessionStore{
+		db: db,
+	}
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *Session) error {
+	query := `
+		INSERT INTO sessions (user_id, ip, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		session.UserID,
+		session.IP,
+		session.UserAgent,
+		session.ExpiresAt,
+	).Scan(
+		&session.ID,
+		&session.CreatedAt,
+	)
+}
+
+// GetByUserID returns the sessions of the user, newest first.
+func (s *SessionStore) GetByUserID(ctx context.Context, userID int64, p PaginatedKeyset) ([]Session, error) {
+	query := `
+		SELECT id, user_id, ip, user_agent, created_at, expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1 AND ($2::bigint = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, p.Before, p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.IP,
+			&session.UserAgent,
+			&session.CreatedAt,
+			&session.ExpiresAt,
+			&session.RevokedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
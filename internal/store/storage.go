@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"github.com/longlnOff/social/internal/trending"
 )
 
 var (
-	ErrNotFound          = errors.New("resouce not found")
-	ErrConflict          = errors.New("resouce already exists")
+	ErrNotFound          = errors.New("resource not found")
+	ErrConflict          = errors.New("resource already exists")
 	QueryTimeoutDuration = 5 * time.Second
 )
 
@@ -19,39 +21,165 @@ type Storage struct {
 	}
 	Post interface {
 		Create(ctx context.Context, post *Post) error
-		GetByID(ctx context.Context, id int64) (*Post, error)
+		GetByID(ctx context.Context, id int64, viewerID int64) (*Post, error)
+		GetByIDForModeration(ctx context.Context, id int64) (*Post, error)
 		Update(ctx context.Context, post *Post) error
 		Delete(ctx context.Context, id int64) error
 		GetUserFeed(ctx context.Context, userID int64, p PaginatedFeed) ([]PostWithMetadata, error)
+		GetByIDs(ctx context.Context, ids []int64, viewerID int64) ([]Post, error)
+		GetActivity(ctx context.Context, since time.Time) ([]trending.Activity, error)
 	}
 
 	User interface {
 		Create(ctx context.Context, tx *sql.Tx, user *User) error
 		GetByUserID(ctx context.Context, userID int64) (*User, error)
 		GetByEmail(ctx context.Context, email string) (*User, error)
+		GetIDsByUsernames(ctx context.Context, usernames []string, actorID int64) (map[string]int64, error)
+		GetStats(ctx context.Context, userID int64) (*UserStats, error)
+		SetPrivacy(ctx context.Context, userID int64, private bool) error
+		GetByUsername(ctx context.Context, username string) (*User, error)
+		GetUsernameRedirect(ctx context.Context, username string) (string, error)
+		UpdateProfile(ctx context.Context, userID int64, update ProfileUpdate) error
+		UpdateAvatar(ctx context.Context, userID int64, avatarURL string) (string, error)
+		VerifyEmail(ctx context.Context, token string) (int64, error)
 		CreateAndInvite(ctx context.Context, token string, user *User, invitationExpirationDuration time.Duration) error
-		ActivateUser(ctx context.Context, token string) error
+		ActivateUser(ctx context.Context, token string) (int64, error)
 		Delete(ctx context.Context, userID int64) error
+		ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error
+		CancelDeletion(ctx context.Context, userID int64) error
+		GetDueDeletions(ctx context.Context, limit int) ([]int64, error)
+		Purge(ctx context.Context, userID int64, policy DeletionPolicy) (*PurgedFiles, error)
+		Search(ctx context.Context, p PaginatedUsers) ([]User, error)
+		SetRole(ctx context.Context, userID int64, roleName string) error
+		SetActive(ctx context.Context, userID int64, active bool) error
+		RevokeTokens(ctx context.Context, userID int64) error
+		CreateInvitation(ctx context.Context, token string, userID int64, invitationExpirationDuration time.Duration) error
+		GetRecentActivity(ctx context.Context, userID int64, limit int) ([]UserActivity, error)
+	}
+
+	Session interface {
+		Create(ctx context.Context, session *Session) error
+		GetByUserID(ctx context.Context, userID int64, p PaginatedKeyset) ([]Session, error)
+	}
+
+	Suspension interface {
+		Create(ctx context.Context, suspension *Suspension) error
+		Lift(ctx context.Context, userID int64, suspensionID int64, liftedBy int64) error
+		GetByUserID(ctx context.Context, userID int64) ([]Suspension, error)
+	}
+
+	Audit interface {
+		Create(ctx context.Context, event *AuditEvent) error
+		Get(ctx context.Context, p PaginatedAudit) ([]AuditEvent, error)
+		Verify(ctx context.Context) (*AuditVerification, error)
+	}
+
+	Report interface {
+		Create(ctx context.Context, report *Report) error
+		GetCases(ctx context.Context, p PaginatedCases) ([]ModerationCase, error)
+		GetCase(ctx context.Context, caseID int64) (*ModerationCase, error)
+		Assign(ctx context.Context, caseID int64, assigneeID int64) error
+		Resolve(ctx context.Context, caseID int64, resolution CaseResolution) (*ModerationCase, error)
+	}
+
+	FilterDecision interface {
+		Create(ctx context.Context, decisions []FilterDecision) error
+		Get(ctx context.Context, userID int64, p PaginatedKeyset) ([]FilterDecision, error)
+	}
+
+	Idempotency interface {
+		Claim(ctx context.Context, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error)
+		Complete(ctx context.Context, record *IdempotencyRecord) error
+		Release(ctx context.Context, scope string, key string) error
+		DeleteExpired(ctx context.Context) error
+	}
+
+	Export interface {
+		Create(ctx context.Context, userID int64) (*DataExport, error)
+		Claim(ctx context.Context) (*DataExport, error)
+		Complete(ctx context.Context, exportID int64, fileKey string, token string, expiry time.Time) error
+		Fail(ctx context.Context, exportID int64) error
+		GetByToken(ctx context.Context, token string) (*DataExport, error)
+		Expire(ctx context.Context) ([]string, error)
+		GetData(ctx context.Context, userID int64) (*UserData, error)
 	}
 
 	Comment interface {
 		Create(ctx context.Context, comment *Comment) error
-		GetByPostID(ctx context.Context, postID int64) ([]Comment, error)
+		GetByPostID(ctx context.Context, postID int64, viewerID int64) ([]Comment, error)
+	}
+
+	Notification interface {
+		GetByUserID(ctx context.Context, userID int64, p PaginatedNotifications) ([]Notification, error)
+		GetGroupedByUserID(ctx context.Context, userID int64, p PaginatedNotifications) ([]NotificationGroup, error)
+		GetRecipients(ctx context.Context, n Notification, userIDs []int64) ([]int64, error)
+		MarkRead(ctx context.Context, userID int64, notificationID int64) error
+		MarkAllRead(ctx context.Context, userID int64) error
+		GetPreferences(ctx context.Context, userID int64) (*NotificationPreferences, error)
+		UpdatePreferences(ctx context.Context, userID int64, prefs *NotificationPreferences) error
+	}
+
+	Conversation interface {
+		Create(ctx context.Context, conversation *Conversation, participantIDs []int64, message *Message) error
+		FindDirect(ctx context.Context, userID int64, otherUserID int64) (*Conversation, error)
+		GetByID(ctx context.Context, conversationID int64, userID int64) (*Conversation, error)
+		GetByUserID(ctx context.Context, userID int64, p PaginatedKeyset) ([]Conversation, error)
+		CountUnread(ctx context.Context, userID int64) (int64, error)
+		CanMessage(ctx context.Context, senderID int64, recipientIDs []int64) error
+		CreateMessage(ctx context.Context, message *Message) error
+		GetMessages(ctx context.Context, conversationID int64, p PaginatedKeyset) ([]Message, error)
+		MarkRead(ctx context.Context, conversationID int64, userID int64, messageID int64) error
+		GetSettings(ctx context.Context, userID int64) (*MessagingSettings, error)
+		UpdateSettings(ctx context.Context, userID int64, settings *MessagingSettings) error
+	}
+
+	Block interface {
+		Block(ctx context.Context, blockerID int64, blockedID int64) error
+		Unblock(ctx context.Context, blockerID int64, blockedID int64) error
+		Mute(ctx context.Context, muterID int64, mutedID int64) error
+		Unmute(ctx context.Context, muterID int64, mutedID int64) error
+		IsBlocked(ctx context.Context, userID int64, otherUserID int64) (bool, error)
+		IsHidden(ctx context.Context, viewerID int64, authorID int64) (bool, error)
+		GetBlocked(ctx context.Context, userID int64) ([]User, error)
+		GetMuted(ctx context.Context, userID int64) ([]User, error)
+	}
+
+	Suggestion interface {
+		Refresh(ctx context.Context) error
+		GetByUserID(ctx context.Context, userID int64, limit int) ([]Suggestion, error)
 	}
 
 	Follower interface {
-		Follow(ctx context.Context, followerID int64, followedUserID int64) error
+		Follow(ctx context.Context, followerID int64, followedUserID int64) (bool, error)
 		Unfollow(ctx context.Context, followerID int64, followedUserID int64) error
+		GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error)
+		GetFollowers(ctx context.Context, userID int64, viewerID int64, p PaginatedKeyset) ([]FollowEntry, error)
+		GetFollowing(ctx context.Context, userID int64, viewerID int64, p PaginatedKeyset) ([]FollowEntry, error)
+		GetRelationship(ctx context.Context, userID int64, otherUserID int64) (*Relationship, error)
+		GetRequests(ctx context.Context, userID int64, p PaginatedKeyset) ([]FollowRequest, error)
+		ApproveRequest(ctx context.Context, userID int64, requesterID int64) error
+		RejectRequest(ctx context.Context, userID int64, requesterID int64) error
 	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Post:     NewPost(db),
-		User:     NewUser(db),
-		Comment:  NewComment(db),
-		Follower: NewFollower(db),
-		Role:     NewRole(db),
+		Post:           NewPost(db),
+		User:           NewUser(db),
+		Comment:        NewComment(db),
+		Follower:       NewFollower(db),
+		Role:           NewRole(db),
+		Notification:   NewNotification(db),
+		Conversation:   NewConversation(db),
+		Block:          NewBlock(db),
+		Suggestion:     NewSuggestion(db),
+		Export:         NewExport(db),
+		Session:        NewSession(db),
+		Audit:          NewAudit(db, false),
+		Report:         NewReport(db),
+		Suspension:     NewSuspension(db),
+		FilterDecision: NewFilterDecision(db),
+		Idempotency:    NewIdempotency(db),
 	}
 }
 
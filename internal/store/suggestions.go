@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Weights of the signals making the score of a suggestion and limits of the
+// periodic refresh.
+const (
+	suggestionMutualWeight    = 1.0
+	suggestionSharedTagWeight = 0.5
+	suggestionActivityWeight  = 0.25
+	suggestionActivityWindow  = 30 * 24 * time.Hour
+	suggestionsPerUser        = 50
+	suggestionRefreshTimeout  = 5 * time.Minute
+)
+
+// suggestionRefreshLock is the advisory lock held during a refresh, so a
+// single replica refreshes at a time.
+const suggestionRefreshLock = 7262798
+
+// Suggestion is an account recommended to a user. MutualCount is the number
+// of followed users that follow the suggested account.
+type Suggestion struct {
+	User            User    `json:"user"`
+	Score           float64 `json:"score"`
+	MutualCount     int64   `json:"mutual_count"`
+	SharedTagsCount int64   `json:"shared_tags_count"`
+}
+
+type SuggestionStore struct {
+	db *sql.DB
+}
+
+func NewSuggestion(db *sql.DB) *SuggestionStore {
+	return &SuggestionStore{
+		db: db,
+	}
+}
+
+// Refresh recomputes the suggestions of every user from the follow graph.
+// Candidates are the friends of friends, scored by the number of mutual
+// follows, the tags shared by the posts of both users and the recent
+// activity of the candidate. It does nothing while another replica is
+// refreshing.
+func (s *SuggestionStore) Refresh(ctx context.Context) error {
+	query := `
+		WITH candidates AS (
+			SELECT f1.follower_id AS user_id, f2.user_id AS suggested_id, COUNT(*) AS mutual_count
+			FROM followers f1
+			JOIN followers f2 ON f2.follower_id = f1.user_id
+			WHERE f2.user_id <> f1.follower_id
+			GROUP BY f1.follower_id, f2.user_id
+		), user_tags AS MATERIALIZED (
+			SELECT DISTINCT p.user_id, t.tag
+			FROM posts p, unnest(p.tags) AS t(tag)
+		), shared_tags AS (
+			SELECT c.user_id, c.suggested_id, COUNT(*) AS shared_tags_count
+			FROM candidates c
+			JOIN user_tags a ON a.user_id = c.user_id
+			JOIN user_tags b ON b.user_id = c.suggested_id AND b.tag = a.tag
+			GROUP BY c.user_id, c.suggested_id
+		), recent_posts AS (
+			SELECT user_id, COUNT(*) AS recent_posts_count
+			FROM posts
+			WHERE created_at > NOW() - make_interval(secs => $1::float8)
+			GROUP BY user_id
+		), scored AS (
+			SELECT
+				c.user_id,
+				c.suggested_id,
+				c.mutual_count,
+				COALESCE(st.shared_tags_count, 0) AS shared_tags_count,
+				COALESCE(rp.recent_posts_count, 0) AS recent_posts_count
+			FROM candidates c
+			JOIN users u ON u.id = c.suggested_id AND u.is_active = true
+			LEFT JOIN shared_tags st ON st.user_id = c.user_id AND st.suggested_id = c.suggested_id
+			LEFT JOIN recent_posts rp ON rp.user_id = c.suggested_id
+			WHERE NOT EXISTS (
+				SELECT 1 FROM followers f
+				WHERE f.user_id = c.suggested_id AND f.follower_id = c.user_id
+			) AND NOT ` + blockedSQL("c.user_id", "c.suggested_id") + `
+		), ranked AS (
+			SELECT *,
+				mutual_count * $2::float8 + shared_tags_count * $3::float8 + LN(1 + recent_posts_count) * $4::float8 AS score
+			FROM scored
+		)
+		INSERT INTO follow_suggestions (user_id, suggested_id, score, mutual_count, shared_tags_count)
+		SELECT user_id, suggested_id, score, mutual_count, shared_tags_count
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY score DESC) AS rank
+			FROM ranked
+		) r
+		WHERE rank <= $5
+	`
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, suggestionRefreshTimeout)
+		defer cancel()
+
+		var locked bool
+		if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, suggestionRefreshLock).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM follow_suggestions`); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, query,
+			suggestionActivityWindow.Seconds(),
+			suggestionMutualWeight,
+			suggestionSharedTagWeight,
+			suggestionActivityWeight,
+			suggestionsPerUser,
+		)
+		return err
+	})
+}
+
+// GetByUserID returns the precomputed suggestions of a user. Accounts the
+// user followed, requested or blocked since the last refresh are left out.
+// Users without suggestions yet, like new users, get the most followed
+// accounts instead.
+func (s *SuggestionStore) GetByUserID(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at, fs.score, fs.mutual_count, fs.shared_tags_count
+		FROM follow_suggestions fs
+		JOIN users u ON u.id = fs.suggested_id
+		WHERE fs.user_id = $1 AND ` + suggestableSQL("$1", "u.id") + `
+		ORDER BY fs.score DESC
+		LIMIT $2
+	`
+
+	suggestions, err := s.get(ctx, query, userID, limit)
+	if err != nil || len(suggestions) > 0 {
+		return suggestions, err
+	}
+
+	query = `
+		SELECT u.id, u.username, u.created_at, 0, 0, 0
+		FROM users u
+		WHERE u.id <> $1 AND u.is_active = true AND ` + suggestableSQL("$1", "u.id") + `
+		ORDER BY u.followers_count DESC, u.id DESC
+		LIMIT $2
+	`
+
+	return s.get(ctx, query, userID, limit)
+}
+
+func (s *SuggestionStore) get(ctx context.Context, query string, userID int64, limit int) ([]Suggestion, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(
+			&suggestion.User.ID,
+			&suggestion.User.Username,
+			&suggestion.User.CreatedAt,
+			&suggestion.Score,
+			&suggestion.MutualCount,
+			&suggestion.SharedTagsCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	// SuspensionFull locks the user out: no login and no token accepted.
+	SuspensionFull = "suspension"
+	// SuspensionReadOnly lets the user log in and read, but not post nor
+	// comment.
+	SuspensionReadOnly = "read_only"
+)
+
+// Suspension restricts a user from StartsAt until EndsAt, for good when
+// EndsAt is nil, unless it is lifted before.
+type Suspension struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Kind      string     `json:"kind"`
+	Reason    string     `json:"reason"`
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	IssuedBy  *int64     `json:"issued_by,omitempty"`
+	LiftedAt  *time.Time `json:"lifted_at,omitempty"`
+	LiftedBy  *int64     `json:"lifted_by,omitempty"`
+	CreatedAt string     `json:"created_at"`
+}
+
+// ActiveAt reports whether the suspension is in effect at the given time.
+func (s *Suspension) ActiveAt(at time.Time) bool {
+	if s.LiftedAt != nil || at.Before(s.StartsAt) {
+		return false
+	}
+	return s.EndsAt == nil || at.Before(*s.EndsAt)
+}
+
+// Restriction returns the suspension in effect at the given time, a full
+// suspension rather than a read-only one, or nil when the user is free.
+func (u *User) Restriction(at time.Time) *Suspension {
+	var restriction *Suspension
+	for i := range u.Suspensions {
+		s := &u.Suspensions[i]
+		if !s.ActiveAt(at) {
+			continue
+		}
+		if s.Kind == SuspensionFull {
+			return s
+		}
+		restriction = s
+	}
+	return restriction
+}
+
+type SuspensionStore struct {
+	db *sql.DB
+}
+
+func NewSuspension(db *sql.DB) *SuspensionStore {
+	return &SuspensionStore{
+		db: db,
+	}
+}
+
+func (s *SuspensionStore) Create(ctx context.Context, suspension *Suspension) error {
+	return createSuspension(ctx, s.db, suspension)
+}
+
+func createSuspension(ctx context.Context, db queryRower, suspension *Suspension) error {
+	query := `
+		INSERT INTO user_suspensions (user_id, kind, reason, starts_at, ends_at, issued_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return db.QueryRowContext(
+		ctx,
+		query,
+		suspension.UserID,
+		suspension.Kind,
+		suspension.Reason,
+		suspension.StartsAt,
+		suspension.EndsAt,
+		suspension.IssuedBy,
+	).Scan(
+		&suspension.ID,
+		&suspension.CreatedAt,
+	)
+}
+
+// Lift ends the suspension of the user right away. It fails with ErrNotFound
+// when the suspension is already over.
+func (s *SuspensionStore) Lift(ctx context.Context, userID int64, suspensionID int64, liftedBy int64) error {
+	query := `
+		UPDATE user_suspensions SET lifted_at = NOW(), lifted_by = $3
+		WHERE id = $1 AND user_id = $2 AND lifted_at IS NULL AND (ends_at IS NULL OR ends_at > NOW())
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, suspensionID, userID, liftedBy)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetByUserID returns every suspension of the user, newest first.
+func (s *SuspensionStore) GetByUserID(ctx context.Context, userID int64) ([]Suspension, error) {
+	return getSuspensions(ctx, s.db, `user_id = $1`, userID)
+}
+
+// getPendingSuspensions returns the suspensions of the user that are in
+// effect or still to come.
+func getPendingSuspensions(ctx context.Context, db *sql.DB, userID int64) ([]Suspension, error) {
+	return getSuspensions(ctx, db, `user_id = $1 AND lifted_at IS NULL AND (ends_at IS NULL OR ends_at > NOW())`, userID)
+}
+
+func getSuspensions(ctx context.Context, db *sql.DB, condition string, userID int64) ([]Suspension, error) {
+	query := `
+		SELECT id, user_id, kind, reason, starts_at, ends_at, issued_by, lifted_at, lifted_by, created_at
+		FROM user_suspensions
+		WHERE ` + condition + `
+		ORDER BY id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suspensions := []Suspension{}
+	for rows.Next() {
+		var s Suspension
+		err := rows.Scan(
+			&s.ID,
+			&s.UserID,
+			&s.Kind,
+			&s.Reason,
+			&s.StartsAt,
+			&s.EndsAt,
+			&s.IssuedBy,
+			&s.LiftedAt,
+			&s.LiftedBy,
+			&s.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		suspensions = append(suspensions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suspensions, nil
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -23,8 +24,26 @@ type User struct {
 	Password  password `json:"-"`
 	CreatedAt string   `json:"created_at"`
 	IsActive  bool     `json:"is_active"`
+	IsPrivate bool     `json:"is_private"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+	Profile
+	// DeletionScheduledAt is set while the account waits for its deletion.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	// TokensValidAfter rejects the tokens issued before it, once the user
+	// was logged out everywhere.
+	TokensValidAfter *time.Time `json:"-"`
+	// Suspensions are the suspensions of the user in effect or still to
+	// come, see Restriction.
+	Suspensions []Suspension `json:"-"`
+}
+
+// UserStats holds the denormalized counters of a user, they are kept up to
+// date by database triggers.
+type UserStats struct {
+	FollowersCount int64 `json:"followers_count"`
+	FollowingCount int64 `json:"following_count"`
+	PostsCount     int64 `json:"posts_count"`
 }
 
 type password struct {
@@ -81,9 +100,50 @@ func (u *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		}
 	}
 
+	if user.Suspensions, err = getPendingSuspensions(ctx, u.db, user.ID); err != nil {
+		return nil, err
+	}
+
 	return &user, nil
 }
 
+// GetIDsByUsernames resolves usernames to IDs, leaving out the users that
+// have a block with the actor.
+func (u *UserStore) GetIDsByUsernames(ctx context.Context, usernames []string, actorID int64) (map[string]int64, error) {
+	query := `
+		SELECT id, username FROM users
+		WHERE username = ANY($1) AND is_active = true AND NOT ` + blockedSQL("$2", "id") + `
+	`
+
+	ids := map[string]int64{}
+	if len(usernames) == 0 {
+		return ids, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.QueryContext(ctx, query, pq.Array(usernames), actorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		ids[username] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
 func (u *UserStore) Delete(ctx context.Context, userID int64) error {
 	return withTx(ctx, u.db, func(tx *sql.Tx) error {
 		// Delete user
@@ -100,13 +160,16 @@ func (u *UserStore) Delete(ctx context.Context, userID int64) error {
 	})
 }
 
-func (u *UserStore) ActivateUser(ctx context.Context, token string) error {
-	return withTx(ctx, u.db, func(tx *sql.Tx) error {
+// ActivateUser activates the user the token was sent to and returns its ID.
+func (u *UserStore) ActivateUser(ctx context.Context, token string) (int64, error) {
+	var userID int64
+	err := withTx(ctx, u.db, func(tx *sql.Tx) error {
 		// 1. find the user that this token belong to
 		user, err := u.getUserByInvitationToken(ctx, tx, token)
 		if err != nil {
 			return err
 		}
+		userID = user.ID
 
 		// 2. update the user status
 		user.IsActive = true
@@ -121,6 +184,8 @@ func (u *UserStore) ActivateUser(ctx context.Context, token string) error {
 
 		return nil
 	})
+
+	return userID, err
 }
 
 func (u *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
@@ -165,28 +230,132 @@ func (u *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 }
 
 func (u *UserStore) GetByUserID(ctx context.Context, userID int64) (*User, error) {
+	user, err := u.getBy(ctx, "users.id = $1 AND users.deleted_at IS NULL", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Suspensions, err = getPendingSuspensions(ctx, u.db, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetByUsername returns the active user currently named username.
+func (u *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return u.getBy(ctx, "users.username = $1 AND users.is_active = true", username)
+}
+
+func (u *UserStore) getBy(ctx context.Context, condition string, arg any) (*User, error) {
 	query := `
-		SELECT users.id, username, email, password, created_at, roles.*
+		SELECT ` + userColumns + `
 		FROM users
 		JOIN roles ON (roles.id = users.role_id)
-		WHERE users.id = $1
-	`
+		WHERE ` + condition
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	var user User
-	err := u.db.QueryRowContext(ctx, query, userID).Scan(
+	if err := scanUser(u.db.QueryRowContext(ctx, query, arg), &user); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// userColumns are the columns read by scanUser, from users joined with roles.
+const userColumns = `users.id, username, email, password, created_at, is_active, is_private,
+			display_name, bio, website, location, avatar_url, deletion_scheduled_at,
+			tokens_valid_after, roles.*`
+
+func scanUser(row rowScanner, user *User) error {
+	return row.Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.Password.hash,
 		&user.CreatedAt,
+		&user.IsActive,
+		&user.IsPrivate,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Website,
+		&user.Location,
+		&user.AvatarURL,
+		&user.DeletionScheduledAt,
+		&user.TokensValidAfter,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Level,
 		&user.Role.Description,
 	)
+}
+
+// SetPrivacy makes the account private or public. Going public approves all
+// the pending follow requests.
+func (u *UserStore) SetPrivacy(ctx context.Context, userID int64, private bool) error {
+	return withTx(ctx, u.db, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users SET is_private = $2
+			WHERE id = $1
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID, private)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+		if private {
+			return nil
+		}
+
+		query = `
+			WITH approved AS (
+				DELETE FROM follow_requests
+				WHERE user_id = $1
+				RETURNING user_id, requester_id
+			)
+			INSERT INTO followers (user_id, follower_id)
+			SELECT user_id, requester_id FROM approved
+			ON CONFLICT DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, query, userID)
+		return err
+	})
+}
+
+func (u *UserStore) GetStats(ctx context.Context, userID int64) (*UserStats, error) {
+	query := `
+		SELECT followers_count, following_count, posts_count
+		FROM users
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var stats UserStats
+	err := u.db.QueryRowContext(ctx, query, userID).Scan(
+		&stats.FollowersCount,
+		&stats.FollowingCount,
+		&stats.PostsCount,
+	)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -196,7 +365,7 @@ func (u *UserStore) GetByUserID(ctx context.Context, userID int64) (*User, error
 		}
 	}
 
-	return &user, nil
+	return &stats, nil
 }
 
 func (u *UserStore) CreateAndInvite(ctx context.Context, token string, user *User, invitationExpirationDuration time.Duration) error {
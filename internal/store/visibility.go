@@ -0,0 +1,59 @@
+package store
+
+import "fmt"
+
+// The visibility rules below are shared by every query that lists content of
+// other users, so blocks, mutes and private accounts are enforced in one place.
+
+// blockedSQL is true when one of the two users blocked the other.
+func blockedSQL(userID string, otherUserID string) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM user_blocks ub
+		WHERE (ub.blocker_id = %[1]s AND ub.blocked_id = %[2]s)
+			OR (ub.blocker_id = %[2]s AND ub.blocked_id = %[1]s)
+	)`, userID, otherUserID)
+}
+
+// mutedSQL is true when the viewer muted the author.
+func mutedSQL(viewerID string, authorID string) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM user_mutes um
+		WHERE um.muter_id = %s AND um.muted_id = %s
+	)`, viewerID, authorID)
+}
+
+// hiddenSQL is true when the author is hidden from the viewer's feed and
+// notifications, because of a block or a mute.
+func hiddenSQL(viewerID string, authorID string) string {
+	return fmt.Sprintf("(%s OR %s)", blockedSQL(viewerID, authorID), mutedSQL(viewerID, authorID))
+}
+
+// visibleSQL is true when the viewer can see the content of the author: the
+// author is the viewer, has a public account or is followed by the viewer.
+func visibleSQL(viewerID string, authorID string) string {
+	return fmt.Sprintf(`(%[2]s = %[1]s OR NOT EXISTS (
+		SELECT 1 FROM users pu
+		WHERE pu.id = %[2]s AND pu.is_private = true
+	) OR EXISTS (
+		SELECT 1 FROM followers vf
+		WHERE vf.user_id = %[2]s AND vf.follower_id = %[1]s
+	))`, viewerID, authorID)
+}
+
+// suggestableSQL is true when the account can still be suggested to the user:
+// not followed nor requested by the user and without a block between them.
+func suggestableSQL(userID string, suggestedID string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+		SELECT 1 FROM followers sf
+		WHERE sf.user_id = %[2]s AND sf.follower_id = %[1]s
+	) AND NOT EXISTS (
+		SELECT 1 FROM follow_requests sr
+		WHERE sr.user_id = %[2]s AND sr.requester_id = %[1]s
+	) AND NOT %[3]s`, userID, suggestedID, blockedSQL(userID, suggestedID))
+}
+
+// moderatedSQL is true when a moderator hid the content from everyone but its
+// author.
+func moderatedSQL(viewerID string, hiddenAt string, authorID string) string {
+	return fmt.Sprintf("(%s IS NOT NULL AND %s <> %s)", hiddenAt, authorID, viewerID)
+}
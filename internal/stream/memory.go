@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryBroker is a single process broker, used when the cache is disabled
+// and in tests. The history of a topic is kept for historyTTL, the topics
+// without history nor subscribers are forgotten.
+type MemoryBroker struct {
+	mu          sync.Mutex
+	historySize int
+	historyTTL  time.Duration
+	bufferSize  int
+	lastMs      int64
+	seq         int64
+	lastSweep   time.Time
+	history     map[string][]Event
+	subscribers map[string][]*Subscription
+}
+
+func NewMemoryBroker(historySize int, historyTTL time.Duration, bufferSize int) *MemoryBroker {
+	historySize, historyTTL, bufferSize = withDefaults(historySize, historyTTL, bufferSize)
+	return &MemoryBroker{
+		historySize: historySize,
+		historyTTL:  historyTTL,
+		bufferSize:  bufferSize,
+		history:     map[string][]Event{},
+		subscribers: map[string][]*Subscription{},
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, eventType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := Event{ID: b.nextID(), Topic: topic, Type: eventType, Data: raw}
+	b.sweep(time.Now())
+	b.history[topic] = lastEvents(append(b.history[topic], event), b.historySize)
+
+	subscribers := b.subscribers[topic][:0]
+	for _, sub := range b.subscribers[topic] {
+		if sub.deliver(event) {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	b.setSubscribers(topic, subscribers)
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, topics []string, lastEventID string) (*Subscription, error) {
+	sub := newSubscription(b.bufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// replay and register under the same lock so no event is lost in between
+	if lastEventID != "" {
+		var replay []Event
+		since := time.Now().Add(-b.historyTTL)
+		for _, topic := range topics {
+			for _, event := range recentEvents(b.history[topic], since) {
+				if compareIDs(event.ID, lastEventID) > 0 {
+					replay = append(replay, event)
+				}
+			}
+		}
+		sort.Slice(replay, func(i, j int) bool {
+			return compareIDs(replay[i].ID, replay[j].ID) < 0
+		})
+		for _, event := range lastEvents(replay, b.bufferSize) {
+			sub.deliver(event)
+		}
+	}
+
+	for _, topic := range topics {
+		b.subscribers[topic] = append(b.subscribers[topic], sub)
+	}
+	sub.onClose = func() { b.unsubscribe(sub, topics) }
+
+	return sub, nil
+}
+
+// unsubscribe removes the closed subscription from its topics.
+func (b *MemoryBroker) unsubscribe(sub *Subscription, topics []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, topic := range topics {
+		subscribers := make([]*Subscription, 0, len(b.subscribers[topic]))
+		for _, other := range b.subscribers[topic] {
+			if other != sub {
+				subscribers = append(subscribers, other)
+			}
+		}
+		b.setSubscribers(topic, subscribers)
+	}
+}
+
+func (b *MemoryBroker) setSubscribers(topic string, subscribers []*Subscription) {
+	if len(subscribers) == 0 {
+		delete(b.subscribers, topic)
+		return
+	}
+	b.subscribers[topic] = subscribers
+}
+
+// sweep drops the history older than historyTTL, once per historyTTL.
+func (b *MemoryBroker) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < b.historyTTL {
+		return
+	}
+	b.lastSweep = now
+	since := now.Add(-b.historyTTL)
+	for topic, events := range b.history {
+		if events = recentEvents(events, since); len(events) == 0 {
+			delete(b.history, topic)
+		} else {
+			b.history[topic] = events
+		}
+	}
+}
+
+// recentEvents drops the events published before since, the events are in
+// chronological order.
+func recentEvents(events []Event, since time.Time) []Event {
+	for i, event := range events {
+		if eventTime(event).After(since) {
+			return events[i:]
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) nextID() string {
+	ms := time.Now().UnixMilli()
+	if ms <= b.lastMs {
+		ms = b.lastMs
+		b.seq++
+	} else {
+		b.lastMs = ms
+		b.seq = 0
+	}
+	return fmt.Sprintf("%d-%d", ms, b.seq)
+}
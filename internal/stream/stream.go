@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventFeed         = "feed"
+	EventNotification = "notification"
+	EventComment      = "comment"
+	EventMessage      = "message"
+
+	DefaultHistorySize = 500
+	DefaultHistoryTTL  = time.Hour
+	DefaultBufferSize  = 64
+)
+
+type Event struct {
+	ID    string          `json:"id"`
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Broker fans events out to the subscribers of a topic. Event IDs are
+// "<milliseconds>-<sequence>" so a subscriber can resume after the last
+// event it has seen.
+type Broker interface {
+	Publish(ctx context.Context, topic string, eventType string, data any) error
+	Subscribe(ctx context.Context, topics []string, lastEventID string) (*Subscription, error)
+}
+
+func UserTopic(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func PostTopic(postID int64) string {
+	return fmt.Sprintf("post:%d", postID)
+}
+
+// Subscription buffers the events of a subscriber. When the buffer is full
+// the subscription is closed and marked as overflowed, the client is expected
+// to reconnect with the last event ID it received. Close must be called in
+// any case, it releases the subscription from the broker.
+type Subscription struct {
+	mu       sync.Mutex
+	events   chan Event
+	closed   bool
+	released bool
+	overflow bool
+	onClose  func()
+}
+
+func newSubscription(bufferSize int) *Subscription {
+	return &Subscription{
+		events: make(chan Event, bufferSize),
+	}
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Overflowed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overflow
+}
+
+func (s *Subscription) Close() {
+	s.mu.Lock()
+	s.closeLocked()
+	release := !s.released
+	s.released = true
+	s.mu.Unlock()
+
+	if release && s.onClose != nil {
+		s.onClose()
+	}
+}
+
+// deliver hands an event to the subscriber without blocking the publisher.
+// The subscription overflowing is closed, it is released by Close.
+func (s *Subscription) deliver(event Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	select {
+	case s.events <- event:
+		return true
+	default:
+	}
+
+	s.overflow = true
+	s.closeLocked()
+	return false
+}
+
+func (s *Subscription) closeLocked() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.events)
+}
+
+// compareIDs orders two event IDs, an empty ID is before every other ID.
+func compareIDs(a string, b string) int {
+	aMs, aSeq := parseID(a)
+	bMs, bSeq := parseID(b)
+	switch {
+	case aMs != bMs:
+		return compareUint(aMs, bMs)
+	default:
+		return compareUint(aSeq, bSeq)
+	}
+}
+
+func parseID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msInt, _ := strconv.ParseUint(ms, 10, 64)
+	seqInt, _ := strconv.ParseUint(seq, 10, 64)
+	return msInt, seqInt
+}
+
+func compareUint(a uint64, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func withDefaults(historySize int, historyTTL time.Duration, bufferSize int) (int, time.Duration, int) {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	if historyTTL <= 0 {
+		historyTTL = DefaultHistoryTTL
+	}
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return historySize, historyTTL, bufferSize
+}
+
+// lastEvents keeps at most n events, dropping the oldest ones.
+func lastEvents(events []Event, n int) []Event {
+	if len(events) <= n {
+		return events
+	}
+	return events[len(events)-n:]
+}
+
+// eventTime is when the event was published, from its ID.
+func eventTime(event Event) time.Time {
+	ms, _ := parseID(event.ID)
+	return time.UnixMilli(int64(ms))
+}
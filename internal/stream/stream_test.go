@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should deliver events of subscribed topics only", func(t *testing.T) {
+		broker := NewMemoryBroker(10, time.Minute, 10)
+		sub, err := broker.Subscribe(ctx, []string{UserTopic(1)}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+
+		broker.Publish(ctx, UserTopic(2), EventFeed, "ignored")
+		broker.Publish(ctx, UserTopic(1), EventFeed, "hello")
+
+		event := <-sub.Events()
+		if event.Topic != UserTopic(1) || string(event.Data) != `"hello"` {
+			t.Errorf("WANT hello on %s BUT GOT %v", UserTopic(1), event)
+		}
+		if len(sub.Events()) != 0 {
+			t.Errorf("WANT no more events BUT GOT %d", len(sub.Events()))
+		}
+	})
+
+	t.Run("should replay events after the last event ID", func(t *testing.T) {
+		broker := NewMemoryBroker(10, time.Minute, 10)
+		for _, data := range []string{"a", "b", "c"} {
+			broker.Publish(ctx, PostTopic(1), EventComment, data)
+		}
+		first := broker.history[PostTopic(1)][0]
+
+		sub, err := broker.Subscribe(ctx, []string{PostTopic(1)}, first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+
+		if len(sub.Events()) != 2 {
+			t.Errorf("WANT 2 replayed events BUT GOT %d", len(sub.Events()))
+		}
+	})
+
+	t.Run("should close slow subscribers", func(t *testing.T) {
+		broker := NewMemoryBroker(10, time.Minute, 1)
+		sub, err := broker.Subscribe(ctx, []string{UserTopic(1)}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		broker.Publish(ctx, UserTopic(1), EventFeed, "a")
+		broker.Publish(ctx, UserTopic(1), EventFeed, "b")
+
+		if !sub.Overflowed() {
+			t.Errorf("WANT overflowed subscription")
+		}
+	})
+
+	t.Run("should forget the closed subscriptions", func(t *testing.T) {
+		broker := NewMemoryBroker(10, time.Minute, 10)
+		sub, err := broker.Subscribe(ctx, []string{UserTopic(1), PostTopic(1)}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sub.Close()
+		if len(broker.subscribers) != 0 {
+			t.Errorf("WANT no subscribers BUT GOT %v", broker.subscribers)
+		}
+	})
+
+	t.Run("should forget the history past its TTL", func(t *testing.T) {
+		broker := NewMemoryBroker(10, time.Minute, 10)
+		broker.Publish(ctx, UserTopic(1), EventFeed, "old")
+		broker.history[UserTopic(1)][0].ID = "1-0"
+		broker.lastSweep = time.Time{}
+
+		broker.Publish(ctx, UserTopic(2), EventFeed, "new")
+		if _, ok := broker.history[UserTopic(1)]; ok {
+			t.Errorf("WANT the history of %s dropped BUT GOT %v", UserTopic(1), broker.history[UserTopic(1)])
+		}
+		if len(broker.history[UserTopic(2)]) != 1 {
+			t.Errorf("WANT the new event kept BUT GOT %v", broker.history[UserTopic(2)])
+		}
+	})
+}
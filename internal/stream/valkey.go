@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ValkeyBroker shares events between API replicas. Every event is appended
+// to a capped Valkey stream per topic, used to resume subscribers, and
+// published on the pub/sub channel of the topic for live delivery. The
+// stream of a topic expires historyTTL after its last event.
+type ValkeyBroker struct {
+	rdb         *redis.Client
+	historySize int
+	historyTTL  time.Duration
+	bufferSize  int
+}
+
+func NewValkeyBroker(rdb *redis.Client, historySize int, historyTTL time.Duration, bufferSize int) *ValkeyBroker {
+	historySize, historyTTL, bufferSize = withDefaults(historySize, historyTTL, bufferSize)
+	return &ValkeyBroker{
+		rdb:         rdb,
+		historySize: historySize,
+		historyTTL:  historyTTL,
+		bufferSize:  bufferSize,
+	}
+}
+
+func (b *ValkeyBroker) Publish(ctx context.Context, topic string, eventType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	id, err := b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey(topic),
+		MaxLen: int64(b.historySize),
+		Approx: true,
+		Values: map[string]any{"type": eventType, "data": string(raw)},
+	}).Result()
+	if err != nil {
+		return err
+	}
+	if err := b.rdb.Expire(ctx, streamKey(topic), b.historyTTL).Err(); err != nil {
+		return err
+	}
+
+	message, err := json.Marshal(Event{ID: id, Topic: topic, Type: eventType, Data: raw})
+	if err != nil {
+		return err
+	}
+	return b.rdb.Publish(ctx, channelKey(topic), message).Err()
+}
+
+func (b *ValkeyBroker) Subscribe(ctx context.Context, topics []string, lastEventID string) (*Subscription, error) {
+	channels := make([]string, len(topics))
+	for i, topic := range topics {
+		channels[i] = channelKey(topic)
+	}
+
+	// wait for the subscription before replaying so no event is lost in between
+	pubsub := b.rdb.Subscribe(ctx, channels...)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	sub := newSubscription(b.bufferSize)
+	sub.onClose = func() { pubsub.Close() }
+
+	lastSeen := map[string]string{}
+	for _, topic := range topics {
+		lastSeen[topic] = lastEventID
+	}
+	if lastEventID != "" {
+		replay, err := b.replay(ctx, topics, lastEventID)
+		if err != nil {
+			pubsub.Close()
+			return nil, err
+		}
+		for _, event := range lastEvents(replay, b.bufferSize) {
+			sub.deliver(event)
+			lastSeen[event.Topic] = event.ID
+		}
+	}
+
+	messages := pubsub.Channel()
+	go func() {
+		defer sub.Close()
+		for message := range messages {
+			var event Event
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				continue
+			}
+			// skip the events already sent by the replay
+			if compareIDs(event.ID, lastSeen[event.Topic]) <= 0 {
+				continue
+			}
+			if !sub.deliver(event) {
+				return
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+func (b *ValkeyBroker) replay(ctx context.Context, topics []string, lastEventID string) ([]Event, error) {
+	var replay []Event
+	for _, topic := range topics {
+		messages, err := b.rdb.XRange(ctx, streamKey(topic), "("+lastEventID, "+").Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			eventType, _ := message.Values["type"].(string)
+			data, _ := message.Values["data"].(string)
+			replay = append(replay, Event{
+				ID:    message.ID,
+				Topic: topic,
+				Type:  eventType,
+				Data:  json.RawMessage(data),
+			})
+		}
+	}
+
+	sort.Slice(replay, func(i, j int) bool {
+		return compareIDs(replay[i].ID, replay[j].ID) < 0
+	})
+	return replay, nil
+}
+
+func streamKey(topic string) string {
+	return "stream:" + topic
+}
+
+func channelKey(topic string) string {
+	return "events:" + topic
+}
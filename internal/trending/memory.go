@@ -0,0 +1,49 @@
+package trending
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps the boards of a single process, used when the cache is
+// disabled and in tests.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	boards map[string]*Board
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		boards: map[string]*Board{},
+	}
+}
+
+func (s *MemoryStore) Replace(ctx context.Context, window string, board *Board) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.boards[window] = board
+	return nil
+}
+
+func (s *MemoryStore) Posts(ctx context.Context, window string, scope Scope, limit int) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	board, ok := s.boards[window]
+	if !ok {
+		return []Entry{}, nil
+	}
+	return top(board.Posts[scope], limit), nil
+}
+
+func (s *MemoryStore) Tags(ctx context.Context, window string, locale string, limit int) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	board, ok := s.boards[window]
+	if !ok {
+		return []Entry{}, nil
+	}
+	return top(board.Tags[locale], limit), nil
+}
@@ -0,0 +1,178 @@
+// Package trending ranks posts and tags by recent activity. Every activity on
+// a post adds to its score a weight that halves every half-life of the window,
+// the score of a tag is the sum of the scores of its posts.
+package trending
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	KindComment = "comment"
+
+	// MaxEntries caps the length of every leaderboard.
+	MaxEntries = 100
+)
+
+// Weights of each kind of activity. Kinds missing here are not counted.
+var Weights = map[string]float64{
+	KindComment: 1,
+}
+
+// Window is a sliding window over which the activity is ranked.
+type Window struct {
+	Name     string
+	Length   time.Duration
+	HalfLife time.Duration
+}
+
+var Windows = []Window{
+	{Name: "1h", Length: time.Hour, HalfLife: 15 * time.Minute},
+	{Name: "24h", Length: 24 * time.Hour, HalfLife: 6 * time.Hour},
+	{Name: "7d", Length: 7 * 24 * time.Hour, HalfLife: 2 * 24 * time.Hour},
+}
+
+const DefaultWindow = "24h"
+
+func WindowByName(name string) (Window, bool) {
+	for _, w := range Windows {
+		if w.Name == name {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+// Longest is the length of the widest window, the activity older than that is
+// never counted.
+func Longest() time.Duration {
+	var longest time.Duration
+	for _, w := range Windows {
+		longest = max(longest, w.Length)
+	}
+	return longest
+}
+
+// Activity is one interaction with a post.
+type Activity struct {
+	PostID int64
+	Tags   []string
+	Locale string
+	Kind   string
+	At     time.Time
+}
+
+// Entry is a ranked post ID or tag.
+type Entry struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// Scope selects a leaderboard of posts, empty fields match everything.
+type Scope struct {
+	Locale string
+	Tag    string
+}
+
+// Board holds the leaderboards of a window: posts by scope and tags by locale.
+type Board struct {
+	Posts map[Scope][]Entry
+	Tags  map[string][]Entry
+}
+
+// Store keeps the latest board of every window.
+type Store interface {
+	Replace(ctx context.Context, window string, board *Board) error
+	Posts(ctx context.Context, window string, scope Scope, limit int) ([]Entry, error)
+	Tags(ctx context.Context, window string, locale string, limit int) ([]Entry, error)
+}
+
+// Compute ranks the activities falling in the window ending at now.
+func Compute(activities []Activity, w Window, now time.Time) *Board {
+	type post struct {
+		tags   []string
+		locale string
+		score  float64
+	}
+
+	posts := map[int64]*post{}
+	for _, a := range activities {
+		age := now.Sub(a.At)
+		weight, ok := Weights[a.Kind]
+		if !ok || age < 0 || age > w.Length {
+			continue
+		}
+
+		p, ok := posts[a.PostID]
+		if !ok {
+			p = &post{tags: a.Tags, locale: a.Locale}
+			posts[a.PostID] = p
+		}
+		p.score += weight * math.Exp2(-float64(age)/float64(w.HalfLife))
+	}
+
+	postScores := map[Scope]map[string]float64{}
+	tagScores := map[string]map[string]float64{}
+	add := func(scores map[string]float64, member string, score float64) map[string]float64 {
+		if scores == nil {
+			scores = map[string]float64{}
+		}
+		scores[member] += score
+		return scores
+	}
+
+	for id, p := range posts {
+		member := strconv.FormatInt(id, 10)
+		locales := []string{""}
+		if p.locale != "" {
+			locales = append(locales, p.locale)
+		}
+
+		for _, locale := range locales {
+			scope := Scope{Locale: locale}
+			postScores[scope] = add(postScores[scope], member, p.score)
+			for _, tag := range p.tags {
+				scope := Scope{Locale: locale, Tag: tag}
+				postScores[scope] = add(postScores[scope], member, p.score)
+				tagScores[locale] = add(tagScores[locale], tag, p.score)
+			}
+		}
+	}
+
+	board := &Board{Posts: map[Scope][]Entry{}, Tags: map[string][]Entry{}}
+	for scope, scores := range postScores {
+		board.Posts[scope] = rank(scores)
+	}
+	for locale, scores := range tagScores {
+		board.Tags[locale] = rank(scores)
+	}
+	return board
+}
+
+func rank(scores map[string]float64) []Entry {
+	entries := make([]Entry, 0, len(scores))
+	for member, score := range scores {
+		entries = append(entries, Entry{Member: member, Score: score})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		return entries[i].Member < entries[j].Member
+	})
+	if len(entries) > MaxEntries {
+		entries = entries[:MaxEntries]
+	}
+	return entries
+}
+
+func top(entries []Entry, limit int) []Entry {
+	if limit < len(entries) {
+		entries = entries[:limit]
+	}
+	return append([]Entry{}, entries...)
+}
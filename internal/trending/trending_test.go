@@ -0,0 +1,94 @@
+package trending
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCompute(t *testing.T) {
+	now := time.Now()
+	day, _ := WindowByName("24h")
+
+	t.Run("should halve the weight of an activity every half-life", func(t *testing.T) {
+		board := Compute([]Activity{
+			{PostID: 1, Kind: KindComment, At: now},
+			{PostID: 2, Kind: KindComment, At: now.Add(-day.HalfLife)},
+		}, day, now)
+
+		posts := board.Posts[Scope{}]
+		if len(posts) != 2 || posts[0].Member != "1" || posts[1].Member != "2" {
+			t.Fatalf("WANT posts 1 then 2 BUT GOT %v", posts)
+		}
+		if math.Abs(posts[1].Score-0.5) > 1e-9 {
+			t.Errorf("WANT score 0.5 BUT GOT %f", posts[1].Score)
+		}
+	})
+
+	t.Run("should ignore activities out of the window or of unknown kinds", func(t *testing.T) {
+		board := Compute([]Activity{
+			{PostID: 1, Kind: KindComment, At: now.Add(-day.Length - time.Minute)},
+			{PostID: 2, Kind: "unknown", At: now},
+		}, day, now)
+
+		if len(board.Posts[Scope{}]) != 0 {
+			t.Errorf("WANT no posts BUT GOT %v", board.Posts[Scope{}])
+		}
+	})
+
+	t.Run("should rank posts and tags by locale and tag", func(t *testing.T) {
+		board := Compute([]Activity{
+			{PostID: 1, Tags: []string{"go"}, Locale: "en", Kind: KindComment, At: now},
+			{PostID: 1, Tags: []string{"go"}, Locale: "en", Kind: KindComment, At: now},
+			{PostID: 2, Tags: []string{"go", "rust"}, Locale: "vi", Kind: KindComment, At: now},
+		}, day, now)
+
+		if got := board.Posts[Scope{Tag: "rust"}]; len(got) != 1 || got[0].Member != "2" {
+			t.Errorf("WANT post 2 for rust BUT GOT %v", got)
+		}
+		if got := board.Posts[Scope{Locale: "en", Tag: "go"}]; len(got) != 1 || got[0].Member != "1" {
+			t.Errorf("WANT post 1 for en and go BUT GOT %v", got)
+		}
+		tags := board.Tags[""]
+		if len(tags) != 2 || tags[0].Member != "go" || tags[0].Score != 3 {
+			t.Errorf("WANT go first with score 3 BUT GOT %v", tags)
+		}
+		if got := board.Tags["vi"]; len(got) != 2 {
+			t.Errorf("WANT 2 tags for vi BUT GOT %v", got)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	t.Run("should return nothing before the first refresh", func(t *testing.T) {
+		posts, err := s.Posts(ctx, DefaultWindow, Scope{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 0 {
+			t.Errorf("WANT no posts BUT GOT %v", posts)
+		}
+	})
+
+	t.Run("should limit the entries", func(t *testing.T) {
+		board := &Board{
+			Posts: map[Scope][]Entry{{}: {{Member: "1", Score: 2}, {Member: "2", Score: 1}}},
+			Tags:  map[string][]Entry{},
+		}
+		if err := s.Replace(ctx, DefaultWindow, board); err != nil {
+			t.Fatal(err)
+		}
+
+		posts, err := s.Posts(ctx, DefaultWindow, Scope{}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 1 || posts[0].Member != "1" {
+			t.Errorf("WANT post 1 BUT GOT %v", posts)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package trending
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ValkeyStore shares the boards between API replicas, every leaderboard is a
+// sorted set. A refresh writes a new generation of sorted sets and then
+// switches the current generation of the window, so readers never see a
+// half written board and the leaderboards gone from the new board vanish with
+// the previous generation.
+type ValkeyStore struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// DefaultTTL is used when no ttl is given.
+const DefaultTTL = time.Hour
+
+// NewValkeyStore keeps every generation for ttl, which must outlast the
+// refresh interval.
+func NewValkeyStore(rdb *redis.Client, ttl time.Duration) *ValkeyStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &ValkeyStore{
+		rdb: rdb,
+		ttl: ttl,
+	}
+}
+
+func (s *ValkeyStore) Replace(ctx context.Context, window string, board *Board) error {
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for scope, entries := range board.Posts {
+			s.write(ctx, pipe, postsKey(window, generation, scope), entries)
+		}
+		for locale, entries := range board.Tags {
+			s.write(ctx, pipe, tagsKey(window, generation, locale), entries)
+		}
+		pipe.Set(ctx, currentKey(window), generation, s.ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *ValkeyStore) Posts(ctx context.Context, window string, scope Scope, limit int) ([]Entry, error) {
+	generation, err := s.current(ctx, window)
+	if err != nil || generation == "" {
+		return []Entry{}, err
+	}
+	return s.read(ctx, postsKey(window, generation, scope), limit)
+}
+
+func (s *ValkeyStore) Tags(ctx context.Context, window string, locale string, limit int) ([]Entry, error) {
+	generation, err := s.current(ctx, window)
+	if err != nil || generation == "" {
+		return []Entry{}, err
+	}
+	return s.read(ctx, tagsKey(window, generation, locale), limit)
+}
+
+func (s *ValkeyStore) write(ctx context.Context, pipe redis.Pipeliner, key string, entries []Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	members := make([]*redis.Z, len(entries))
+	for i, entry := range entries {
+		members[i] = &redis.Z{Score: entry.Score, Member: entry.Member}
+	}
+	pipe.ZAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, s.ttl)
+}
+
+func (s *ValkeyStore) read(ctx context.Context, key string, limit int) ([]Entry, error) {
+	members, err := s.rdb.ZRevRangeWithScores(ctx, key, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, len(members))
+	for i, member := range members {
+		entries[i] = Entry{Member: fmt.Sprint(member.Member), Score: member.Score}
+	}
+	return entries, nil
+}
+
+func (s *ValkeyStore) current(ctx context.Context, window string) (string, error) {
+	generation, err := s.rdb.Get(ctx, currentKey(window)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return generation, err
+}
+
+func currentKey(window string) string {
+	return "trending:" + window + ":current"
+}
+
+func postsKey(window string, generation string, scope Scope) string {
+	return fmt.Sprintf("trending:%s:%s:posts:%s:%s", window, generation, scope.Locale, scope.Tag)
+}
+
+func tagsKey(window string, generation string, locale string) string {
+	return fmt.Sprintf("trending:%s:%s:tags:%s", window, generation, locale)
+}